@@ -0,0 +1,282 @@
+// Package cloudinit composes the cloud-init user data servers are recreated
+// with from the user data they were created with and the network
+// configuration of their floating ips.
+package cloudinit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+const (
+	// RendererNetplan persists the addresses in a netplan config, as used
+	// by the Ubuntu images.
+	RendererNetplan = "netplan"
+	// RendererNetworkd persists the addresses in a systemd-networkd drop-in
+	// of the network cloud-init configures for the interface.
+	RendererNetworkd = "networkd"
+)
+
+// MaxSize is the size limit of user data the api accepts.
+const MaxSize = 32 * 1024
+
+// DefaultInterface is the public interface of cloud servers.
+const DefaultInterface = "eth0"
+
+// mergeHow makes the generated config append its files and commands to the
+// ones of the user data instead of replacing them.
+const mergeHow = "list(append)+dict(no_replace,recurse_list)+str()"
+
+// Config is the input of Compose.
+type Config struct {
+	// UserData is the user data supplied for the server, in any format
+	// cloud-init accepts as user data.
+	UserData string
+	// Addresses are configured on Interface, usually the floating ips of
+	// the server.
+	Addresses []net.IPNet
+	// Renderer is RendererNetplan or RendererNetworkd, empty means netplan.
+	Renderer string
+	// Interface is the interface the addresses are configured on, empty
+	// means DefaultInterface.
+	Interface string
+}
+
+// FloatingIPAddress returns the address a floating ip is configured with:
+// the ip with a /32 prefix for ipv4, and the first address of the /64
+// network for ipv6.
+func FloatingIPAddress(fIP *hcloud.FloatingIP) net.IPNet {
+	if fIP.Type == hcloud.FloatingIPTypeIPv6 && fIP.Network != nil {
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, fIP.Network.IP.To16())
+		ip[net.IPv6len-1] |= 1
+		return net.IPNet{IP: ip, Mask: fIP.Network.Mask}
+	}
+	return net.IPNet{IP: fIP.IP, Mask: net.CIDRMask(32, 32)}
+}
+
+// Compose returns the user data of cfg.UserData with the network config of
+// cfg.Addresses. If both are set they become the parts of a multipart
+// message, user data that already is one gets the network config as
+// another part.
+func Compose(cfg Config) (string, error) {
+	network, err := NetworkConfig(cfg)
+	if err != nil {
+		return "", err
+	}
+	var userData string
+	switch {
+	case len(cfg.UserData) == 0:
+		userData = network
+	case len(network) == 0:
+		if _, err := userDataParts(cfg.UserData); err != nil {
+			return "", err
+		}
+		userData = cfg.UserData
+	default:
+		parts, err := userDataParts(cfg.UserData)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part{
+			header:  partHeader("text/cloud-config", "floating-ips.cfg"),
+			content: network,
+		})
+		userData, err = multipartMessage(parts)
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(userData) > MaxSize {
+		return "", fmt.Errorf("user data has %d bytes, at most %d are allowed", len(userData), MaxSize)
+	}
+	return userData, nil
+}
+
+// Validate returns an error if cloud-init does not accept userData or it
+// exceeds the size limit.
+func Validate(userData string) error {
+	if len(userData) == 0 {
+		return nil
+	}
+	if _, err := userDataParts(userData); err != nil {
+		return err
+	}
+	if len(userData) > MaxSize {
+		return fmt.Errorf("user data has %d bytes, at most %d are allowed", len(userData), MaxSize)
+	}
+	return nil
+}
+
+// NetworkConfig returns a cloud config that persists the addresses of cfg
+// and applies them, or an empty string if there are none.
+func NetworkConfig(cfg Config) (string, error) {
+	if len(cfg.Addresses) == 0 {
+		return "", nil
+	}
+	iface := cfg.Interface
+	if len(iface) == 0 {
+		iface = DefaultInterface
+	}
+	var path, content string
+	var commands [][]string
+	switch cfg.Renderer {
+	case "", RendererNetplan:
+		path = "/etc/netplan/60-floating-ip.yaml"
+		content = netplanConfig(iface, cfg.Addresses)
+		commands = [][]string{{"netplan", "apply"}}
+	case RendererNetworkd:
+		// cloud-init names the network of the interface 10-cloud-init-<name>
+		path = fmt.Sprintf("/etc/systemd/network/10-cloud-init-%s.network.d/60-floating-ip.conf", iface)
+		content = networkdConfig(cfg.Addresses)
+		commands = [][]string{{"networkctl", "reload"}, {"networkctl", "reconfigure", iface}}
+	default:
+		return "", fmt.Errorf("unknown network renderer %s, use %s or %s", cfg.Renderer, RendererNetplan, RendererNetworkd)
+	}
+
+	var b strings.Builder
+	b.WriteString("#cloud-config\n")
+	fmt.Fprintf(&b, "merge_how: %q\n", mergeHow)
+	b.WriteString("write_files:\n")
+	fmt.Fprintf(&b, "- path: %s\n", path)
+	b.WriteString("  permissions: \"0600\"\n")
+	b.WriteString("  content: |\n")
+	for _, line := range strings.Split(strings.TrimSuffix(content, "\n"), "\n") {
+		fmt.Fprintf(&b, "    %s\n", line)
+	}
+	b.WriteString("runcmd:\n")
+	for _, command := range commands {
+		fmt.Fprintf(&b, "- [%s]\n", strings.Join(command, ", "))
+	}
+	return b.String(), nil
+}
+
+func netplanConfig(iface string, addresses []net.IPNet) string {
+	var b strings.Builder
+	b.WriteString("network:\n")
+	b.WriteString("  version: 2\n")
+	b.WriteString("  ethernets:\n")
+	fmt.Fprintf(&b, "    %s:\n", iface)
+	b.WriteString("      addresses:\n")
+	for _, address := range addresses {
+		fmt.Fprintf(&b, "      - %q\n", address.String())
+	}
+	return b.String()
+}
+
+func networkdConfig(addresses []net.IPNet) string {
+	var b strings.Builder
+	b.WriteString("[Network]\n")
+	for _, address := range addresses {
+		fmt.Fprintf(&b, "Address=%s\n", address.String())
+	}
+	return b.String()
+}
+
+// part is a part of a multipart user data message.
+type part struct {
+	header  textproto.MIMEHeader
+	content string
+}
+
+func partHeader(contentType, filename string) textproto.MIMEHeader {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType(contentType, map[string]string{"charset": "utf-8"}))
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	return header
+}
+
+// contentType returns the mime type cloud-init handles userData as, taken
+// from its first line.
+func contentType(userData string) (string, error) {
+	prefixes := []struct {
+		prefix      string
+		contentType string
+	}{
+		// longer prefixes first, #cloud-config also starts #cloud-config-archive
+		{"#cloud-config-archive", "text/cloud-config-archive"},
+		{"#cloud-config", "text/cloud-config"},
+		{"#cloud-boothook", "text/cloud-boothook"},
+		{"#include", "text/x-include-url"},
+		{"#part-handler", "text/part-handler"},
+		{"## template: jinja", "text/jinja2"},
+		{"#!", "text/x-shellscript"},
+		{"Content-Type:", "multipart/mixed"},
+	}
+	for _, p := range prefixes {
+		if strings.HasPrefix(userData, p.prefix) {
+			return p.contentType, nil
+		}
+	}
+	firstLine, _, _ := strings.Cut(userData, "\n")
+	return "", fmt.Errorf("unsupported user data starting with %q, use a cloud config, a script or a multipart message", firstLine)
+}
+
+// userDataParts returns the parts of userData, which is a single part unless
+// it is a multipart message.
+func userDataParts(userData string) ([]part, error) {
+	typ, err := contentType(userData)
+	if err != nil {
+		return nil, err
+	}
+	if typ != "multipart/mixed" {
+		return []part{{header: partHeader(typ, "user-data"), content: userData}}, nil
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(userData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read multipart user data: %w", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read multipart user data: %w", err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, fmt.Errorf("user data of type %s is not a multipart message", mediaType)
+	}
+	var parts []part
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := r.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read multipart user data: %w", err)
+		}
+		content, err := io.ReadAll(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read multipart user data: %w", err)
+		}
+		parts = append(parts, part{header: p.Header, content: string(content)})
+	}
+	return parts, nil
+}
+
+// multipartMessage returns the parts as a multipart message.
+func multipartMessage(parts []part) (string, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, p := range parts {
+		pw, err := w.CreatePart(p.header)
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.WriteString(pw, p.content); err != nil {
+			return "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	header := fmt.Sprintf("Content-Type: %s\nMIME-Version: 1.0\n\n", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": w.Boundary()}))
+	return header + body.String(), nil
+}
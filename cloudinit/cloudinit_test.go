@@ -0,0 +1,193 @@
+package cloudinit
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+)
+
+func testAddresses(t *testing.T) []net.IPNet {
+	t.Helper()
+	ipv4 := hcloud.FloatingIPFromSchema(schema.FloatingIP{Type: "ipv4", IP: "198.51.100.10"})
+	ipv6 := hcloud.FloatingIPFromSchema(schema.FloatingIP{Type: "ipv6", IP: "2001:db8:1::/64"})
+	return []net.IPNet{FloatingIPAddress(ipv4), FloatingIPAddress(ipv6)}
+}
+
+func TestFloatingIPAddress(t *testing.T) {
+	addresses := testAddresses(t)
+	if got := addresses[0].String(); got != "198.51.100.10/32" {
+		t.Errorf("ipv4 address %s, want 198.51.100.10/32", got)
+	}
+	if got := addresses[1].String(); got != "2001:db8:1::1/64" {
+		t.Errorf("ipv6 address %s, want 2001:db8:1::1/64", got)
+	}
+}
+
+func TestNetworkConfig(t *testing.T) {
+	tests := []struct {
+		renderer string
+		want     []string
+	}{
+		{
+			renderer: RendererNetplan,
+			want: []string{
+				"- path: /etc/netplan/60-floating-ip.yaml\n",
+				"    network:\n      version: 2\n      ethernets:\n        eth0:\n          addresses:\n",
+				"          - \"198.51.100.10/32\"\n          - \"2001:db8:1::1/64\"\n",
+				"- [netplan, apply]\n",
+			},
+		},
+		{
+			renderer: RendererNetworkd,
+			want: []string{
+				"- path: /etc/systemd/network/10-cloud-init-eth0.network.d/60-floating-ip.conf\n",
+				"    [Network]\n    Address=198.51.100.10/32\n    Address=2001:db8:1::1/64\n",
+				"- [networkctl, reload]\n- [networkctl, reconfigure, eth0]\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.renderer, func(t *testing.T) {
+			got, err := NetworkConfig(Config{Addresses: testAddresses(t), Renderer: tt.renderer})
+			if err != nil {
+				t.Fatalf("network config failed: %v", err)
+			}
+			if !strings.HasPrefix(got, "#cloud-config\n") {
+				t.Errorf("network config is no cloud config:\n%s", got)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("network config does not contain %q:\n%s", want, got)
+				}
+			}
+		})
+	}
+	if _, err := NetworkConfig(Config{Addresses: testAddresses(t), Renderer: "ifupdown"}); err == nil {
+		t.Error("unknown renderer accepted")
+	}
+	if got, err := NetworkConfig(Config{}); err != nil || len(got) > 0 {
+		t.Errorf("network config without addresses is %q, %v, want none", got, err)
+	}
+}
+
+// readParts returns the content types and contents of the multipart user
+// data.
+func readParts(t *testing.T, userData string) ([]string, []string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(userData))
+	if err != nil {
+		t.Fatalf("user data is no message: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("user data has content type %s, %v, want multipart/mixed", mediaType, err)
+	}
+	var types, contents []string
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("could not read part: %v", err)
+		}
+		content, err := io.ReadAll(p)
+		if err != nil {
+			t.Fatalf("could not read part: %v", err)
+		}
+		typ, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		types = append(types, typ)
+		contents = append(contents, string(content))
+	}
+	return types, contents
+}
+
+func TestCompose(t *testing.T) {
+	network, err := NetworkConfig(Config{Addresses: testAddresses(t)})
+	if err != nil {
+		t.Fatalf("network config failed: %v", err)
+	}
+	cloudConfig := "#cloud-config\npackages:\n- nginx\nruncmd:\n- [systemctl, start, nginx]\n"
+	script := "#!/bin/sh\necho hello\n"
+
+	t.Run("network only", func(t *testing.T) {
+		got, err := Compose(Config{Addresses: testAddresses(t)})
+		if err != nil || got != network {
+			t.Errorf("composed %q, %v, want the network config", got, err)
+		}
+	})
+	t.Run("user data only", func(t *testing.T) {
+		got, err := Compose(Config{UserData: script})
+		if err != nil || got != script {
+			t.Errorf("composed %q, %v, want the user data", got, err)
+		}
+	})
+	t.Run("cloud config", func(t *testing.T) {
+		got, err := Compose(Config{UserData: cloudConfig, Addresses: testAddresses(t)})
+		if err != nil {
+			t.Fatalf("compose failed: %v", err)
+		}
+		types, contents := readParts(t, got)
+		if strings.Join(types, ",") != "text/cloud-config,text/cloud-config" {
+			t.Fatalf("parts of types %v, want two cloud configs", types)
+		}
+		if contents[0] != cloudConfig || contents[1] != network {
+			t.Errorf("parts %q, want the user data and the network config", contents)
+		}
+		if !strings.Contains(contents[1], "merge_how:") {
+			t.Error("network config replaces the lists of the user data")
+		}
+	})
+	t.Run("script", func(t *testing.T) {
+		got, err := Compose(Config{UserData: script, Addresses: testAddresses(t)})
+		if err != nil {
+			t.Fatalf("compose failed: %v", err)
+		}
+		types, contents := readParts(t, got)
+		if strings.Join(types, ",") != "text/x-shellscript,text/cloud-config" || contents[0] != script {
+			t.Errorf("parts %v %q, want the script and the network config", types, contents)
+		}
+	})
+	t.Run("multipart", func(t *testing.T) {
+		userData, err := Compose(Config{UserData: script, Addresses: testAddresses(t)})
+		if err != nil {
+			t.Fatalf("compose failed: %v", err)
+		}
+		got, err := Compose(Config{UserData: userData, Addresses: testAddresses(t)[:1]})
+		if err != nil {
+			t.Fatalf("compose failed: %v", err)
+		}
+		types, contents := readParts(t, got)
+		if len(types) != 3 || contents[0] != script || contents[1] != network {
+			t.Fatalf("parts %v %q, want the parts of the user data and the network config", types, contents)
+		}
+		if !strings.Contains(contents[2], "198.51.100.10/32") || strings.Contains(contents[2], "2001:db8") {
+			t.Errorf("last part %q, want the new network config", contents[2])
+		}
+	})
+	t.Run("unsupported", func(t *testing.T) {
+		if _, err := Compose(Config{UserData: "hello", Addresses: testAddresses(t)}); err == nil {
+			t.Error("unsupported user data accepted")
+		}
+		if err := Validate("hello"); err == nil {
+			t.Error("unsupported user data valid")
+		}
+	})
+	t.Run("too large", func(t *testing.T) {
+		userData := "#!/bin/sh\n" + strings.Repeat("#", MaxSize)
+		if _, err := Compose(Config{UserData: userData}); err == nil {
+			t.Error("too large user data accepted")
+		}
+		if err := Validate(userData); err == nil {
+			t.Error("too large user data valid")
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"hetzner-freezer/resolver"
+)
+
+func NewAutoFreezeCommand(ctx context.Context, log *logrus.Logger) *cobra.Command {
+	var project string
+	var token string
+	var storage storeFlags
+	var freeze freezeFlags
+	var opts resolver.AutoFreezeOptions
+	cmd := &cobra.Command{
+		Use:   "auto-freeze",
+		Short: "Freeze servers that were idle for a while according to their metrics",
+		Run: func(cmd *cobra.Command, args []string) {
+			store, err := storage.newStore(ctx)
+			if err != nil {
+				log.Errorf("could not open dump storage: %v", err)
+				return
+			}
+			p := resolver.NewProvider(log, project, newClient(token), store)
+
+			opts.Freeze = freeze.opts
+			report, err := p.AutoFreeze(ctx, opts)
+			if err != nil {
+				log.Errorf("could not auto freeze servers: %v", err)
+				return
+			}
+			logAutoFreezeReport(log, report, opts.DryRun)
+		},
+	}
+	cmd.PersistentFlags().StringVar(&opts.Selector, "selector", "", "label selector of the servers to check, e.g. env=demo")
+	cmd.PersistentFlags().DurationVar(&opts.Window, "idle-window", 24*time.Hour, "how long a server has to be idle to be frozen")
+	cmd.PersistentFlags().Float64Var(&opts.CPUThreshold, "cpu-threshold", 5, "cpu usage in percent an idle server stays below")
+	cmd.PersistentFlags().Float64Var(&opts.NetworkThreshold, "network-threshold", 10240, "bandwidth in bytes per second, in and out together, an idle server stays below")
+	cmd.PersistentFlags().StringVar(&opts.ExemptLabel, "exempt-label", resolver.AutoFreezeExemptLabel, "label that exempts servers from the auto freeze, whatever its value")
+	cmd.PersistentFlags().IntVar(&opts.Parallelism, "parallelism", defaultParallelism, "number of servers frozen at the same time")
+	cmd.PersistentFlags().BoolVar(&opts.DryRun, "dry-run", false, "report the idle servers without freezing them")
+	cmd.PersistentFlags().StringVar(&project, "project", "", "hetzner project name")
+	cmd.PersistentFlags().StringVar(&token, "token", "", "hetzner API token")
+	storage.register(cmd)
+	freeze.register(cmd)
+	if err := cmd.MarkPersistentFlagRequired("selector"); err != nil {
+		log.Fatal(err)
+	} else if err := cmd.MarkPersistentFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	} else if err := cmd.MarkPersistentFlagRequired("token"); err != nil {
+		log.Fatal(err)
+	}
+	return cmd
+}
+
+func logAutoFreezeReport(log *logrus.Logger, report *resolver.AutoFreezeReport, dryRun bool) {
+	for _, svr := range report.Servers {
+		switch {
+		case svr.Frozen && svr.Err != nil:
+			log.Warnf("server %s: frozen, dump %s, savings unknown: %v", svr.ServerName, svr.DumpID, svr.Err)
+		case svr.Err != nil:
+			log.Errorf("server %s: failed: %v", svr.ServerName, svr.Err)
+		case svr.Frozen:
+			log.Infof("server %s: frozen, dump %s, saves %.2f per month", svr.ServerName, svr.DumpID, svr.MonthlySavings)
+		case svr.Idle && dryRun:
+			log.Infof("server %s: would be frozen, saves %.2f per month", svr.ServerName, svr.MonthlySavings)
+		}
+	}
+	if dryRun {
+		log.Infof("%d of %d servers idle, freezing them would save an estimated %.2f per month", len(report.Idle()), len(report.Servers), report.Savings(true))
+		return
+	}
+	frozen := lo.CountBy(report.Servers, func(item resolver.AutoFreezeResult) bool { return item.Frozen })
+	log.Infof("%d of %d servers frozen, saving an estimated %.2f per month", frozen, len(report.Servers), report.Savings(false))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"hetzner-freezer/resolver"
+)
+
+func NewCheckCommand(ctx context.Context, log *logrus.Logger) *cobra.Command {
+	var serverName string
+	var serverDumpID string
+	var project string
+	var token string
+	var storage storeFlags
+	var unfreeze unfreezeFlags
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check that a server can be unfrozen",
+		Run: func(cmd *cobra.Command, args []string) {
+			store, err := storage.newStore(ctx)
+			if err != nil {
+				log.Errorf("could not open dump storage: %v", err)
+				return
+			}
+			p := resolver.NewProvider(log, project, newClient(token), store)
+
+			err = p.CheckServer(ctx, serverName, serverDumpID, unfreeze.options())
+			var preflightErr *resolver.PreflightError
+			if errors.As(err, &preflightErr) {
+				for _, problem := range preflightErr.Problems {
+					log.Error(problem)
+				}
+				log.Errorf("server %s can not be unfrozen", serverName)
+				return
+			} else if err != nil {
+				log.Errorf("could not check server: %v", err)
+				return
+			}
+			log.Infof("server %s can be unfrozen", serverName)
+		},
+	}
+	cmd.PersistentFlags().StringVar(&serverName, "server-name", "", "hetzner server name")
+	cmd.PersistentFlags().StringVar(&serverDumpID, "server-dump-id", "", "hetzner server dump id")
+	cmd.PersistentFlags().StringVar(&project, "project", "", "hetzner project name")
+	cmd.PersistentFlags().StringVar(&token, "token", "", "hetzner API token")
+	storage.register(cmd)
+	unfreeze.register(cmd)
+	if err := cmd.MarkPersistentFlagRequired("server-name"); err != nil {
+		log.Fatal(err)
+	} else if err := cmd.MarkPersistentFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	} else if err := cmd.MarkPersistentFlagRequired("token"); err != nil {
+		log.Fatal(err)
+	}
+	return cmd
+}
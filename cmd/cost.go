@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"hetzner-freezer/resolver"
+)
+
+func NewCostCommand(ctx context.Context, log *logrus.Logger) *cobra.Command {
+	var serverName string
+	var project string
+	var token string
+	var label string
+	var output string
+	var storage storeFlags
+	cmd := &cobra.Command{
+		Use:   "cost",
+		Short: "Estimate the costs of frozen servers and what freezing them saved",
+		Run: func(cmd *cobra.Command, args []string) {
+			store, err := storage.newStore(ctx)
+			if err != nil {
+				log.Errorf("could not open dump storage: %v", err)
+				return
+			}
+			projects := []string{project}
+			if len(project) == 0 {
+				projects, err = store.ListProjects(ctx)
+				if err != nil {
+					log.Errorf("could not list projects: %v", err)
+					return
+				}
+			}
+			pricing, resp, err := newClient(token).Pricing.Get(ctx)
+			if err != nil {
+				log.Errorf("could not get prices: %v", err)
+				return
+			}
+			defer resp.Body.Close()
+			var costs []resolver.FreezeCost
+			for _, prj := range projects {
+				// the token only tells whether the servers of its project exist
+				var client *hcloud.Client
+				if prj == project {
+					client = newClient(token)
+				}
+				p := resolver.NewProvider(log, prj, client, store)
+				prjCosts, err := p.FreezeCosts(ctx, serverName, pricing)
+				if err != nil {
+					log.Errorf("could not estimate costs of project %s: %v", prj, err)
+					return
+				}
+				costs = append(costs, prjCosts...)
+			}
+			if err := printCosts(output, label, costs, resolver.SummarizeCosts(costs, label)); err != nil {
+				log.Errorf("could not print costs: %v", err)
+			}
+		},
+	}
+	cmd.PersistentFlags().StringVar(&serverName, "server-name", "", "hetzner server name, estimates all servers if empty")
+	cmd.PersistentFlags().StringVar(&project, "project", "", "hetzner project name, estimates all projects if empty")
+	cmd.PersistentFlags().StringVar(&token, "token", "", "hetzner API token, used to get the prices and check whether the servers of the project exist")
+	cmd.PersistentFlags().StringVar(&label, "group-by-label", "", "label key to aggregate the savings of each project by its values")
+	cmd.PersistentFlags().StringVar(&output, "output", outputTable, "output format: table or json")
+	storage.register(cmd)
+	if err := cmd.MarkPersistentFlagRequired("token"); err != nil {
+		log.Fatal(err)
+	}
+	return cmd
+}
+
+func printCosts(output string, label string, costs []resolver.FreezeCost, summaries []resolver.CostSummary) error {
+	switch output {
+	case outputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		return enc.Encode(struct {
+			Freezes   []resolver.FreezeCost  `json:"freezes"`
+			Summaries []resolver.CostSummary `json:"summaries"`
+		}{costs, summaries})
+	case outputTable:
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PROJECT\tSERVER\tDUMP ID\tFROZEN AT\tUNFROZEN AT\tRUNNING/MONTH\tFROZEN/MONTH\tSAVED\tNOTE")
+		for _, cost := range costs {
+			unfrozen := "-"
+			if cost.UnfrozenAt != nil {
+				unfrozen = cost.UnfrozenAt.Format("2006-01-02 15:04:05")
+			} else if cost.Frozen {
+				unfrozen = "frozen"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%.2f %s\t%.2f %s\t%.2f %s\t%s\n",
+				cost.Project, cost.ServerName, cost.DumpID, cost.FrozenAt.Format("2006-01-02 15:04:05"), unfrozen,
+				cost.Running.Total(), cost.Currency, cost.WhileFrozen.Total(), cost.Currency, cost.Saved, cost.Currency, cost.Note)
+		}
+		fmt.Fprintln(w)
+		if len(label) > 0 {
+			fmt.Fprintf(w, "PROJECT\t%s\tFROZEN\tSAVING/MONTH\tSAVED\n", label)
+		} else {
+			fmt.Fprintln(w, "PROJECT\tFROZEN\tSAVING/MONTH\tSAVED")
+		}
+		for _, s := range summaries {
+			if len(label) > 0 {
+				fmt.Fprintf(w, "%s\t%s\t", s.Project, s.Label)
+			} else {
+				fmt.Fprintf(w, "%s\t", s.Project)
+			}
+			fmt.Fprintf(w, "%d\t%.2f %s\t%.2f %s\n", s.Frozen, s.MonthlySavings, s.Currency, s.Saved, s.Currency)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown output format %s", output)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"hetzner-freezer/resolver"
+	"hetzner-freezer/scheduler"
+)
+
+func NewDaemonCommand(ctx context.Context, log *logrus.Logger) *cobra.Command {
+	var scheduleFile string
+	var project string
+	var token string
+	var storage storeFlags
+	var freeze freezeFlags
+	var unfreeze unfreezeFlags
+	var opts scheduler.Options
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Freeze and unfreeze servers on the schedules of a schedule file",
+		Run: func(cmd *cobra.Command, args []string) {
+			schedule, err := scheduler.Load(scheduleFile)
+			if err != nil {
+				log.Errorf("could not load schedule: %v", err)
+				return
+			}
+			store, err := storage.newStore(ctx)
+			if err != nil {
+				log.Errorf("could not open dump storage: %v", err)
+				return
+			}
+			p := resolver.NewProvider(log, project, newClient(token), store)
+
+			opts.Freeze = freeze.opts
+			opts.Unfreeze = unfreeze.options()
+			opts.Unfreeze.SSH = freeze.opts.SSH
+			if err := scheduler.NewDaemon(log, p, schedule, opts).Run(ctx); err != nil {
+				log.Errorf("daemon failed: %v", err)
+			}
+		},
+	}
+	cmd.PersistentFlags().StringVar(&scheduleFile, "schedule", "", "schedule file with the freeze and unfreeze times of servers")
+	cmd.PersistentFlags().StringVar(&opts.StateFile, "state-file", "hetzner-freezer-state.json", "file the daemon records the runs of the schedules in, only one daemon can use it")
+	cmd.PersistentFlags().DurationVar(&opts.CatchUp, "catch-up", time.Hour, "how late a run missed while the daemon was stopped is still started")
+	cmd.PersistentFlags().IntVar(&opts.Parallelism, "parallelism", defaultParallelism, "number of servers of a selector processed at the same time")
+	cmd.PersistentFlags().StringVar(&project, "project", "", "hetzner project name")
+	cmd.PersistentFlags().StringVar(&token, "token", "", "hetzner API token")
+	storage.register(cmd)
+	freeze.register(cmd)
+	unfreeze.registerOptions(cmd)
+	if err := cmd.MarkPersistentFlagRequired("schedule"); err != nil {
+		log.Fatal(err)
+	} else if err := cmd.MarkPersistentFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	} else if err := cmd.MarkPersistentFlagRequired("token"); err != nil {
+		log.Fatal(err)
+	}
+	return cmd
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"hetzner-freezer/resolver"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+func NewListCommand(ctx context.Context, log *logrus.Logger) *cobra.Command {
+	var serverName string
+	var project string
+	var token string
+	var output string
+	var storage storeFlags
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List projects, frozen servers and their dumps",
+		Run: func(cmd *cobra.Command, args []string) {
+			store, err := storage.newStore(ctx)
+			if err != nil {
+				log.Errorf("could not open dump storage: %v", err)
+				return
+			}
+			projects := []string{project}
+			if len(project) == 0 {
+				projects, err = store.ListProjects(ctx)
+				if err != nil {
+					log.Errorf("could not list projects: %v", err)
+					return
+				}
+			}
+			var client *hcloud.Client
+			if len(token) > 0 {
+				client = newClient(token)
+			}
+			var infos []resolver.DumpInfo
+			for _, prj := range projects {
+				p := resolver.NewProvider(log, prj, client, store)
+				prjInfos, err := p.ListDumps(ctx, serverName)
+				if err != nil {
+					log.Errorf("could not list dumps of project %s: %v", prj, err)
+					return
+				}
+				infos = append(infos, prjInfos...)
+			}
+			for _, info := range infos {
+				if info.Status == resolver.StatusError {
+					log.Warnf("could not load dump %s of server %s: %s", info.DumpID, info.ServerName, info.Error)
+				}
+			}
+			if err := printDumps(output, infos); err != nil {
+				log.Errorf("could not print dumps: %v", err)
+			}
+		},
+	}
+	cmd.PersistentFlags().StringVar(&serverName, "server-name", "", "hetzner server name, lists all servers if empty")
+	cmd.PersistentFlags().StringVar(&project, "project", "", "hetzner project name, lists all projects if empty")
+	cmd.PersistentFlags().StringVar(&token, "token", "", "hetzner API token, used to check whether the servers exist")
+	cmd.PersistentFlags().StringVar(&output, "output", outputTable, "output format: table or json")
+	storage.register(cmd)
+	cmd.MarkFlagsRequiredTogether("token", "project")
+	return cmd
+}
+
+func printDumps(output string, infos []resolver.DumpInfo) error {
+	switch output {
+	case outputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		return enc.Encode(infos)
+	case outputTable:
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PROJECT\tSERVER\tDUMP ID\tCREATED\tOPERATION\tSTATUS\tTYPE\tDATACENTER\tSNAPSHOT\tSIZE (GB)\tIPS\tEXISTS")
+		for _, info := range infos {
+			exists := "unknown"
+			if info.ServerExists != nil {
+				exists = fmt.Sprintf("%t", *info.ServerExists)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%.2f\t%s\t%s\n",
+				info.Project, info.ServerName, info.DumpID, info.CreatedAt.Format("2006-01-02 15:04:05"),
+				info.Operation, info.Status, info.ServerType, info.Datacenter,
+				info.SnapshotID, info.SnapshotSize, strings.Join(info.IPs, ","), exists)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown output format %s", output)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/samber/lo"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"hetzner-freezer/resolver"
@@ -12,6 +13,7 @@ import (
 
 const backOffDuration = 5 * time.Second
 const pollBackOffDuration = 5 * time.Second
+const defaultParallelism = 3
 
 func main() {
 	ctx := signals.SetupSignalHandler()
@@ -22,6 +24,12 @@ func main() {
 		NewFreezeCommand(ctx, logger),
 		NewUnfreezeCommand(ctx, logger),
 		NewServerDumpCommand(ctx, logger),
+		NewListCommand(ctx, logger),
+		NewPruneCommand(ctx, logger),
+		NewCheckCommand(ctx, logger),
+		NewDaemonCommand(ctx, logger),
+		NewAutoFreezeCommand(ctx, logger),
+		NewCostCommand(ctx, logger),
 	)
 	if err := root.Execute(); err != nil {
 		logger.Fatal(err)
@@ -31,22 +39,63 @@ func main() {
 	logrus.Exit(0)
 }
 
+func newClient(token string) *hcloud.Client {
+	return hcloud.NewClient(hcloud.WithToken(token),
+		hcloud.WithBackoffFunc(func(_ int) time.Duration { return backOffDuration }),
+		hcloud.WithPollBackoffFunc(func(r int) time.Duration { return pollBackOffDuration }))
+}
+
 func NewFreezeCommand(ctx context.Context, log *logrus.Logger) *cobra.Command {
 	var serverName string
+	var selector string
+	var parallelism int
 	var project string
 	var token string
+	var dryRun bool
+	var storage storeFlags
+	var freeze freezeFlags
 	cmd := &cobra.Command{
 		Use:   "freeze",
 		Short: "Run hetzner freezer",
 		Run: func(cmd *cobra.Command, args []string) {
 
-			client := hcloud.NewClient(hcloud.WithToken(token),
-				hcloud.WithBackoffFunc(func(_ int) time.Duration { return backOffDuration }),
-				hcloud.WithPollBackoffFunc(func(r int) time.Duration { return pollBackOffDuration }))
+			client := newClient(token)
 
-			p := resolver.NewProvider(log, project, client)
+			store, err := storage.newStore(ctx)
+			if err != nil {
+				log.Errorf("could not open dump storage: %v", err)
+				return
+			}
+			p := resolver.NewProvider(log, project, client, store)
 
-			fingerPrintID, err := p.FreezeServer(ctx, serverName)
+			if len(selector) > 0 && dryRun {
+				plans, err := p.PlanFreezeGroup(ctx, selector, freeze.opts)
+				if err != nil {
+					log.Errorf("could not plan freeze: %v", err)
+					return
+				}
+				logGroupPlans(log, plans)
+				return
+			}
+			if len(selector) > 0 {
+				res, err := p.FreezeGroup(ctx, selector, parallelism, freeze.opts)
+				if err != nil {
+					log.Errorf("could not freeze servers: %v", err)
+					return
+				}
+				logGroupResult(log, res)
+				return
+			}
+			if dryRun {
+				lines, err := p.PlanFreeze(ctx, serverName, freeze.opts)
+				if err != nil {
+					log.Errorf("could not plan freeze: %v", err)
+					return
+				}
+				logPlan(log, lines)
+				return
+			}
+			fingerPrintID, err := p.FreezeServer(ctx, serverName, freeze.opts)
 			if err != nil {
 				log.Errorf("could not freeze server: %v", err)
 				return
@@ -55,11 +104,16 @@ func NewFreezeCommand(ctx context.Context, log *logrus.Logger) *cobra.Command {
 		},
 	}
 	cmd.PersistentFlags().StringVar(&serverName, "server-name", "", "hetzner server name")
+	cmd.PersistentFlags().StringVar(&selector, "selector", "", "label selector of servers to freeze together, e.g. env=staging")
+	cmd.PersistentFlags().IntVar(&parallelism, "parallelism", defaultParallelism, "number of servers processed at the same time")
 	cmd.PersistentFlags().StringVar(&project, "project", "", "hetzner project name")
 	cmd.PersistentFlags().StringVar(&token, "token", "", "hetzner API token")
-	if err := cmd.MarkPersistentFlagRequired("server-name"); err != nil {
-		log.Fatal(err)
-	} else if err := cmd.MarkPersistentFlagRequired("project"); err != nil {
+	cmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "print the plan without changing anything")
+	storage.register(cmd)
+	freeze.register(cmd)
+	cmd.MarkFlagsOneRequired("server-name", "selector")
+	cmd.MarkFlagsMutuallyExclusive("server-name", "selector")
+	if err := cmd.MarkPersistentFlagRequired("project"); err != nil {
 		log.Fatal(err)
 	} else if err := cmd.MarkPersistentFlagRequired("token"); err != nil {
 		log.Fatal(err)
@@ -70,20 +124,56 @@ func NewFreezeCommand(ctx context.Context, log *logrus.Logger) *cobra.Command {
 func NewUnfreezeCommand(ctx context.Context, log *logrus.Logger) *cobra.Command {
 	var serverName string
 	var serverDumpID string
+	var selector string
+	var groupID string
+	var parallelism int
 	var project string
 	var token string
+	var dryRun bool
+	var storage storeFlags
+	var unfreeze unfreezeFlags
 	cmd := &cobra.Command{
 		Use:   "unfreeze",
 		Short: "Run hetzner freezer",
 		Run: func(cmd *cobra.Command, args []string) {
 
-			client := hcloud.NewClient(hcloud.WithToken(token),
-				hcloud.WithBackoffFunc(func(_ int) time.Duration { return backOffDuration }),
-				hcloud.WithPollBackoffFunc(func(r int) time.Duration { return pollBackOffDuration }))
+			client := newClient(token)
 
-			p := resolver.NewProvider(log, project, client)
+			store, err := storage.newStore(ctx)
+			if err != nil {
+				log.Errorf("could not open dump storage: %v", err)
+				return
+			}
+			p := resolver.NewProvider(log, project, client, store)
 
-			err := p.UnfreezeServer(ctx, serverName, serverDumpID)
+			if len(selector) > 0 && dryRun {
+				plans, err := p.PlanUnfreezeGroup(ctx, selector, groupID, unfreeze.options())
+				if err != nil {
+					log.Errorf("could not plan unfreeze: %v", err)
+					return
+				}
+				logGroupPlans(log, plans)
+				return
+			}
+			if len(selector) > 0 {
+				res, err := p.UnfreezeGroup(ctx, selector, groupID, parallelism, unfreeze.options())
+				if err != nil {
+					log.Errorf("could not unfreeze servers: %v", err)
+					return
+				}
+				logGroupResult(log, res)
+				return
+			}
+			if dryRun {
+				lines, err := p.PlanUnfreeze(ctx, serverName, serverDumpID, unfreeze.options())
+				if err != nil {
+					log.Errorf("could not plan unfreeze: %v", err)
+					return
+				}
+				logPlan(log, lines)
+				return
+			}
+			err = p.UnfreezeServer(ctx, serverName, serverDumpID, unfreeze.options())
 			if err != nil {
 				log.Errorf("could not unfreeze server: %v", err)
 				return
@@ -92,11 +182,18 @@ func NewUnfreezeCommand(ctx context.Context, log *logrus.Logger) *cobra.Command
 	}
 	cmd.PersistentFlags().StringVar(&serverName, "server-name", "", "hetzner server name")
 	cmd.PersistentFlags().StringVar(&serverDumpID, "server-dump-id", "", "hetzner server dump id")
+	cmd.PersistentFlags().StringVar(&selector, "selector", "", "label selector the servers were frozen with")
+	cmd.PersistentFlags().StringVar(&groupID, "group-id", "", "id of the frozen group, defaults to the latest group of the selector")
+	cmd.PersistentFlags().IntVar(&parallelism, "parallelism", defaultParallelism, "number of servers processed at the same time")
 	cmd.PersistentFlags().StringVar(&project, "project", "", "hetzner project name")
 	cmd.PersistentFlags().StringVar(&token, "token", "", "hetzner API token")
-	if err := cmd.MarkPersistentFlagRequired("server-name"); err != nil {
-		log.Fatal(err)
-	} else if err := cmd.MarkPersistentFlagRequired("project"); err != nil {
+	cmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "print the plan without changing anything")
+	storage.register(cmd)
+	unfreeze.register(cmd)
+	cmd.MarkFlagsOneRequired("server-name", "selector")
+	cmd.MarkFlagsMutuallyExclusive("server-name", "selector")
+	cmd.MarkFlagsMutuallyExclusive("server-dump-id", "selector")
+	if err := cmd.MarkPersistentFlagRequired("project"); err != nil {
 		log.Fatal(err)
 	} else if err := cmd.MarkPersistentFlagRequired("token"); err != nil {
 		log.Fatal(err)
@@ -108,17 +205,31 @@ func NewServerDumpCommand(ctx context.Context, log *logrus.Logger) *cobra.Comman
 	var serverName string
 	var project string
 	var token string
+	var dryRun bool
+	var storage storeFlags
 	cmd := &cobra.Command{
 		Use:   "dump",
 		Short: "Run hetzner server dump",
 		Run: func(cmd *cobra.Command, args []string) {
 
-			client := hcloud.NewClient(hcloud.WithToken(token),
-				hcloud.WithBackoffFunc(func(_ int) time.Duration { return backOffDuration }),
-				hcloud.WithPollBackoffFunc(func(r int) time.Duration { return pollBackOffDuration }))
+			client := newClient(token)
 
-			p := resolver.NewProvider(log, project, client)
+			store, err := storage.newStore(ctx)
+			if err != nil {
+				log.Errorf("could not open dump storage: %v", err)
+				return
+			}
+			p := resolver.NewProvider(log, project, client, store)
 
+			if dryRun {
+				lines, err := p.PlanServerDump(ctx, serverName)
+				if err != nil {
+					log.Errorf("could not plan dump: %v", err)
+					return
+				}
+				logPlan(log, lines)
+				return
+			}
 			fingerPrintID, err := p.CreateServerDump(ctx, serverName)
 			if err != nil {
 				log.Errorf("could not freeze server: %v", err)
@@ -130,6 +241,8 @@ func NewServerDumpCommand(ctx context.Context, log *logrus.Logger) *cobra.Comman
 	cmd.PersistentFlags().StringVar(&serverName, "server-name", "", "hetzner server name")
 	cmd.PersistentFlags().StringVar(&project, "project", "", "hetzner project name")
 	cmd.PersistentFlags().StringVar(&token, "token", "", "hetzner API token")
+	cmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "print the plan without changing anything")
+	storage.register(cmd)
 	if err := cmd.MarkPersistentFlagRequired("server-name"); err != nil {
 		log.Fatal(err)
 	} else if err := cmd.MarkPersistentFlagRequired("project"); err != nil {
@@ -139,3 +252,32 @@ func NewServerDumpCommand(ctx context.Context, log *logrus.Logger) *cobra.Comman
 	}
 	return cmd
 }
+
+func logPlan(log *logrus.Logger, lines []string) {
+	for i, line := range lines {
+		log.Infof("%d. %s", i+1, line)
+	}
+}
+
+func logGroupPlans(log *logrus.Logger, plans []resolver.ServerPlan) {
+	for _, plan := range plans {
+		if plan.Err != nil {
+			log.Errorf("server %s: could not plan: %v", plan.ServerName, plan.Err)
+			continue
+		}
+		log.Infof("server %s:", plan.ServerName)
+		logPlan(log, plan.Lines)
+	}
+}
+
+func logGroupResult(log *logrus.Logger, res *resolver.GroupResult) {
+	for _, svr := range res.Servers {
+		if svr.Err != nil {
+			log.Errorf("server %s: failed: %v", svr.ServerName, svr.Err)
+			continue
+		}
+		log.Infof("server %s: done, dump %s", svr.ServerName, svr.DumpID)
+	}
+	failed := lo.CountBy(res.Servers, func(item resolver.ServerResult) bool { return item.Err != nil })
+	log.Infof("group %s: %d of %d servers succeeded", res.GroupID, len(res.Servers)-failed, len(res.Servers))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+	"hetzner-freezer/cloudinit"
+	"hetzner-freezer/resolver"
+)
+
+// freezeFlags configure how servers are frozen.
+type freezeFlags struct {
+	opts resolver.FreezeOptions
+}
+
+func (f *freezeFlags) register(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&f.opts.VolumeMode, "volumes", resolver.VolumeModeKeep, "keep volumes detached, or archive their data into the dump and delete them (keep|archive)")
+	cmd.PersistentFlags().StringVar(&f.opts.IPPolicy, "primary-ips", resolver.IPPolicyKeep, "keep primary ips, release them, or keep the ipv4 and release the ipv6 (keep|release|keep-ipv4)")
+	cmd.PersistentFlags().BoolVar(&f.opts.Force, "force", false, "lift the delete protection of protected servers to freeze them, unfreeze restores it")
+	cmd.PersistentFlags().StringSliceVar(&f.opts.SSHKeys, "ssh-key", nil, "names of the ssh keys of the server, defaults to the keys labeled hetzner-freezer/server=<server name> or the keys of the previous dump")
+	cmd.PersistentFlags().StringVar(&f.opts.UserDataFile, "user-data-file", "", "file with the cloud-init user data the server was created with, defaults to the user data of the previous dump")
+	registerSSHFlags(cmd, &f.opts.SSH)
+}
+
+// unfreezeFlags configure how servers are recreated from their dumps.
+type unfreezeFlags struct {
+	opts        resolver.UnfreezeOptions
+	targetToken string
+}
+
+// options returns the unfreeze options, with a client of the target project
+// if a target token is set.
+func (f *unfreezeFlags) options() resolver.UnfreezeOptions {
+	opts := f.opts
+	if len(f.targetToken) > 0 {
+		opts.Target = newClient(f.targetToken)
+	}
+	return opts
+}
+
+func (f *unfreezeFlags) register(cmd *cobra.Command) {
+	f.registerOptions(cmd)
+	cmd.PersistentFlags().StringVar(&f.opts.UserDataFile, "user-data-file", "", "file with cloud-init user data to recreate servers with instead of the dumped one")
+	registerSSHFlags(cmd, &f.opts.SSH)
+}
+
+// registerOptions adds the unfreeze flags without the ssh and user data
+// flags, which commands that also freeze share with the freeze.
+func (f *unfreezeFlags) registerOptions(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVar(&f.opts.VolumesByName, "volumes-by-name", false, "attach volumes that no longer exist under their dumped id to the volume with the same name")
+	cmd.PersistentFlags().StringVar(&f.opts.ServerType, "server-type", "", "server type to recreate servers with instead of the dumped one")
+	cmd.PersistentFlags().StringVar(&f.opts.Datacenter, "datacenter", "", "datacenter to recreate servers in instead of the dumped one")
+	cmd.PersistentFlags().StringVar(&f.opts.Location, "location", "", "location to recreate servers in, any of its datacenters offering the server type is used")
+	cmd.PersistentFlags().StringSliceVar(&f.opts.FallbackServerTypes, "fallback-server-types", nil, "server types to try in order if the server type does not fit the snapshot or is unavailable")
+	cmd.MarkFlagsMutuallyExclusive("datacenter", "location")
+	cmd.PersistentFlags().StringVar(&f.targetToken, "target-token", "", "hetzner API token of another project to unfreeze into, resources are mapped by name")
+	cmd.PersistentFlags().StringVar(&f.opts.TargetImage, "target-image", "", "image id or name in the target project to create servers from, snapshots cannot be transferred")
+	cmd.PersistentFlags().StringVar(&f.opts.NetworkRenderer, "network-renderer", cloudinit.RendererNetplan, "network config the floating ips are persisted in (netplan|networkd)")
+}
+
+// registerSSHFlags adds the flags to log into servers, which archiving and
+// restoring volume data requires.
+func registerSSHFlags(cmd *cobra.Command, opts *resolver.SSHOptions) {
+	cmd.PersistentFlags().StringVar(&opts.User, "ssh-user", "root", "user to log into servers to archive or restore volume data")
+	cmd.PersistentFlags().StringVar(&opts.PrivateKeyFile, "ssh-private-key", "", "private key file to log into servers")
+	cmd.PersistentFlags().StringVar(&opts.KnownHostsFile, "ssh-known-hosts", "", "known hosts file to verify server host keys, ~/.ssh/known_hosts if empty")
+	cmd.PersistentFlags().BoolVar(&opts.InsecureIgnoreHostKey, "ssh-insecure-ignore-host-key", false, "do not verify server host keys, volume data may go to and come from any host answering on the address of the server")
+	cmd.MarkFlagsMutuallyExclusive("ssh-known-hosts", "ssh-insecure-ignore-host-key")
+	cmd.PersistentFlags().IntVar(&opts.Port, "ssh-port", 22, "ssh port of servers")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"hetzner-freezer/resolver"
+)
+
+func NewPruneCommand(ctx context.Context, log *logrus.Logger) *cobra.Command {
+	var serverName string
+	var project string
+	var token string
+	var policy resolver.PrunePolicy
+	var dryRun bool
+	var storage storeFlags
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete old dumps and their snapshots",
+		Run: func(cmd *cobra.Command, args []string) {
+			store, err := storage.newStore(ctx)
+			if err != nil {
+				log.Errorf("could not open dump storage: %v", err)
+				return
+			}
+			p := resolver.NewProvider(log, project, newClient(token), store)
+
+			pruned, err := p.Prune(ctx, serverName, policy, dryRun)
+			if err != nil {
+				log.Errorf("could not prune dumps: %v", err)
+				return
+			}
+			if dryRun {
+				log.Infof("%d dumps would be removed", len(pruned))
+				return
+			}
+			log.Infof("%d dumps removed", len(pruned))
+		},
+	}
+	cmd.PersistentFlags().StringVar(&serverName, "server-name", "", "hetzner server name, prunes all servers if empty")
+	cmd.PersistentFlags().StringVar(&project, "project", "", "hetzner project name")
+	cmd.PersistentFlags().StringVar(&token, "token", "", "hetzner API token")
+	cmd.PersistentFlags().IntVar(&policy.KeepLast, "keep-last", 0, "keep the latest n dumps of every server")
+	cmd.PersistentFlags().DurationVar(&policy.KeepWithin, "keep-within", 0, "keep dumps newer than the duration, e.g. 720h")
+	cmd.PersistentFlags().BoolVar(&policy.KeepFrozen, "keep-frozen", true, "keep the dump a frozen server would be unfrozen from")
+	cmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "print what would be removed without removing it")
+	storage.register(cmd)
+	cmd.MarkFlagsOneRequired("keep-last", "keep-within")
+	if err := cmd.MarkPersistentFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	} else if err := cmd.MarkPersistentFlagRequired("token"); err != nil {
+		log.Fatal(err)
+	}
+	return cmd
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"hetzner-freezer/dump"
+)
+
+const (
+	storageFile = "file"
+	storageS3   = "s3"
+)
+
+// storeFlags select and configure the storage dumps are kept in.
+type storeFlags struct {
+	storage   string
+	outputDir string
+	s3        dump.S3Options
+}
+
+func (f *storeFlags) register(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&f.storage, "storage", storageFile, "dump storage backend: file or s3")
+	cmd.PersistentFlags().StringVar(&f.outputDir, "output-dir", "output", "directory of the file storage")
+	cmd.PersistentFlags().StringVar(&f.s3.Endpoint, "s3-endpoint", "", "s3 endpoint, e.g. fsn1.your-objectstorage.com")
+	cmd.PersistentFlags().StringVar(&f.s3.Bucket, "s3-bucket", "", "s3 bucket name")
+	cmd.PersistentFlags().StringVar(&f.s3.Region, "s3-region", "", "s3 region")
+	cmd.PersistentFlags().StringVar(&f.s3.AccessKey, "s3-access-key", "", "s3 access key")
+	cmd.PersistentFlags().StringVar(&f.s3.SecretKey, "s3-secret-key", "", "s3 secret key")
+	cmd.PersistentFlags().StringVar(&f.s3.Prefix, "s3-prefix", "output", "key prefix of dumps in the s3 bucket")
+	cmd.PersistentFlags().BoolVar(&f.s3.Insecure, "s3-insecure", false, "connect to s3 without tls")
+}
+
+func (f *storeFlags) newStore(ctx context.Context) (dump.Store, error) {
+	switch f.storage {
+	case storageFile:
+		return dump.NewFileStore(f.outputDir), nil
+	case storageS3:
+		if len(f.s3.Endpoint) == 0 || len(f.s3.Bucket) == 0 {
+			return nil, fmt.Errorf("--s3-endpoint and --s3-bucket are required for s3 storage")
+		}
+		return dump.NewS3Store(ctx, f.s3)
+	default:
+		return nil, fmt.Errorf("unknown storage %s", f.storage)
+	}
+}
@@ -0,0 +1,82 @@
+package dump
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+)
+
+const volumesDir = "volumes"
+
+// VolumeArchive describes the archived contents of a volume that a freeze
+// deleted. The archive is a gzipped tarball of the mounted filesystem.
+type VolumeArchive struct {
+	VolumeName string `json:"volume_name"`
+	MountPoint string `json:"mount_point"`
+	Filesystem string `json:"filesystem"`
+	// UUID is the filesystem uuid, which fstab entries may refer to.
+	UUID   string `json:"uuid,omitempty"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+func volumeArchiveKey(dumpPath, volumeName, ext string) string {
+	return path.Join(dumpPath, volumesDir, fmt.Sprintf("%s.%s", volumeName, ext))
+}
+
+func (s *store) PutVolumeArchive(ctx context.Context, project, serverName, dumpID string, a *VolumeArchive, data io.Reader) error {
+	stagingPath := s.stagingPath(project, serverName, dumpID)
+	counter := &countingWriter{hash: sha256.New()}
+	key := volumeArchiveKey(stagingPath, a.VolumeName, "tar.gz")
+	if err := s.bucket.writeFrom(ctx, key, io.TeeReader(data, counter)); err != nil {
+		return fmt.Errorf("failed to write archive of volume %s: %w", a.VolumeName, err)
+	}
+	a.Size = counter.n
+	a.SHA256 = hex.EncodeToString(counter.hash.Sum(nil))
+	bb, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("failed to process archive of volume %s: %w", a.VolumeName, err)
+	}
+	write := func(_ string, bb []byte) error {
+		return s.bucket.write(ctx, volumeArchiveKey(stagingPath, a.VolumeName, "json"), bb)
+	}
+	if err := storePart(write, a.VolumeName, bb); err != nil {
+		return fmt.Errorf("failed to write archive of volume %s: %w", a.VolumeName, err)
+	}
+	return nil
+}
+
+func (s *store) GetVolumeArchive(ctx context.Context, project, serverName, dumpID, volumeName string) (*VolumeArchive, error) {
+	bb, err := s.bucket.read(ctx, volumeArchiveKey(NewServerDumpPath(s.dir, project, serverName, dumpID), volumeName, "json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load archive of volume %s: %w", volumeName, err)
+	}
+	a := VolumeArchive{}
+	if err := json.Unmarshal(bb, &a); err != nil {
+		return nil, fmt.Errorf("failed to read archive of volume %s: %w", volumeName, err)
+	}
+	return &a, nil
+}
+
+func (s *store) OpenVolumeArchive(ctx context.Context, project, serverName, dumpID, volumeName string) (io.ReadCloser, error) {
+	data, err := s.bucket.open(ctx, volumeArchiveKey(NewServerDumpPath(s.dir, project, serverName, dumpID), volumeName, "tar.gz"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive of volume %s: %w", volumeName, err)
+	}
+	return data, nil
+}
+
+type countingWriter struct {
+	n    int64
+	hash hash.Hash
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return w.hash.Write(p)
+}
@@ -0,0 +1,115 @@
+package dump
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/spf13/afero"
+)
+
+// NewFileStore returns a Store that keeps dumps in the directory dir of the
+// local file system.
+func NewFileStore(dir string) Store {
+	return &store{dir: dir, bucket: &fileBucket{fs: afero.NewOsFs()}}
+}
+
+// NewMemoryStore returns a Store that keeps dumps in memory.
+func NewMemoryStore() Store {
+	return &store{bucket: &fileBucket{fs: afero.NewMemMapFs()}}
+}
+
+type fileBucket struct {
+	fs afero.Fs
+}
+
+func (b *fileBucket) read(_ context.Context, key string) ([]byte, error) {
+	return afero.ReadFile(b.fs, key)
+}
+
+func (b *fileBucket) write(_ context.Context, key string, data []byte) error {
+	return b.writeFile(key, func(f afero.File) error {
+		_, err := f.Write(data)
+		return err
+	})
+}
+
+func (b *fileBucket) writeFrom(_ context.Context, key string, data io.Reader) error {
+	return b.writeFile(key, func(f afero.File) error {
+		_, err := io.Copy(f, data)
+		return err
+	})
+}
+
+// writeFile creates the file and flushes it to disk once fill wrote it.
+func (b *fileBucket) writeFile(key string, fill func(f afero.File) error) error {
+	if err := b.fs.MkdirAll(path.Dir(key), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create %s: %w", path.Dir(key), err)
+	}
+	f, err := b.fs.Create(key)
+	if err != nil {
+		return fmt.Errorf("failed to create '%s': %w", key, err)
+	}
+	if err := fill(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write '%s': %w", key, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync '%s': %w", key, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close '%s': %w", key, err)
+	}
+	return nil
+}
+
+func (b *fileBucket) open(_ context.Context, key string) (io.ReadCloser, error) {
+	return b.fs.Open(key)
+}
+
+func (b *fileBucket) list(_ context.Context, prefix string) ([]string, error) {
+	infos, err := afero.ReadDir(b.fs, prefix)
+	if err != nil {
+		if isNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not read dir %s: %w", prefix, err)
+	}
+	var names []string
+	for _, info := range infos {
+		if info.IsDir() {
+			names = append(names, info.Name())
+		}
+	}
+	return names, nil
+}
+
+func (b *fileBucket) remove(_ context.Context, prefix string) error {
+	return b.fs.RemoveAll(prefix)
+}
+
+func (b *fileBucket) rename(_ context.Context, from, to string) error {
+	if err := b.fs.MkdirAll(path.Dir(to), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create %s: %w", path.Dir(to), err)
+	}
+	if err := b.fs.Rename(from, to); err != nil {
+		return fmt.Errorf("failed to rename '%s': %w", from, err)
+	}
+	b.syncDir(path.Dir(from))
+	b.syncDir(path.Dir(to))
+	return nil
+}
+
+// syncDir flushes the entries of the directory to disk. Not every platform
+// can sync directories, so errors are ignored.
+func (b *fileBucket) syncDir(dir string) {
+	f, err := b.fs.Open(dir)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_ = f.Sync()
+}
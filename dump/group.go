@@ -0,0 +1,70 @@
+package dump
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+)
+
+// groupsDir holds the group manifests of a project. It can not clash with a
+// server directory since server names can not contain underscores.
+const groupsDir = "_groups"
+
+const groupManifestName = "manifest"
+
+// GroupManifest records which dump belongs to which server of a group of
+// servers frozen together by a label selector.
+type GroupManifest struct {
+	ID        string        `json:"id"`
+	Selector  string        `json:"selector"`
+	CreatedAt time.Time     `json:"created_at"`
+	Servers   []GroupMember `json:"servers"`
+}
+
+type GroupMember struct {
+	ServerName string `json:"server_name"`
+	ServerID   int64  `json:"server_id"`
+	DumpID     string `json:"dump_id,omitempty"`
+	// Status is pending until the freeze of the server finished, empty in
+	// manifests of earlier versions.
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func NewGroupPath(dir, project, groupID string) string {
+	return NewServerPath(dir, project, path.Join(groupsDir, groupID))
+}
+
+func (s *store) PutGroup(ctx context.Context, project string, g *GroupManifest) error {
+	bb, err := json.Marshal(g)
+	if err != nil {
+		return fmt.Errorf("failed to process group manifest: %w", err)
+	}
+	key := path.Join(NewGroupPath(s.dir, project, g.ID), fmt.Sprintf("%s.json", groupManifestName))
+	write := func(_ string, bb []byte) error {
+		return s.bucket.write(ctx, key, bb)
+	}
+	if err := storePart(write, groupManifestName, bb); err != nil {
+		return fmt.Errorf("failed to write group manifest: %w", err)
+	}
+	return nil
+}
+
+func (s *store) GetGroup(ctx context.Context, project, groupID string) (*GroupManifest, error) {
+	key := path.Join(NewGroupPath(s.dir, project, groupID), fmt.Sprintf("%s.json", groupManifestName))
+	bb, err := s.bucket.read(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load group manifest %s: %w", groupID, err)
+	}
+	g := GroupManifest{}
+	if err := json.Unmarshal(bb, &g); err != nil {
+		return nil, fmt.Errorf("failed to read group manifest %s: %w", groupID, err)
+	}
+	return &g, nil
+}
+
+func (s *store) ListGroups(ctx context.Context, project string) ([]string, error) {
+	return s.bucket.list(ctx, NewServerPath(s.dir, project, groupsDir))
+}
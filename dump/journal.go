@@ -0,0 +1,75 @@
+package dump
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+)
+
+const journalName = "journal"
+
+const (
+	OperationFreeze   = "freeze"
+	OperationUnfreeze = "unfreeze"
+)
+
+// Journal records the progress of an unfinished freeze or unfreeze of a server.
+// It is stored next to the dumps of the server and removed once the operation
+// completes.
+type Journal struct {
+	Operation string   `json:"operation"`
+	DumpID    string   `json:"dump_id"`
+	ServerID  int64    `json:"server_id"`
+	Steps     []string `json:"steps"`
+	// VolumeMode is the volume mode of a freeze, which a resumed freeze has
+	// to use as well.
+	VolumeMode string `json:"volume_mode,omitempty"`
+	// IPPolicy is the primary ip policy of a freeze, which a resumed freeze
+	// has to use as well.
+	IPPolicy string `json:"ip_policy,omitempty"`
+	// ServerType and Datacenter are the names an unfreeze picked, which a
+	// resumed unfreeze has to use as well.
+	ServerType string `json:"server_type,omitempty"`
+	Datacenter string `json:"datacenter,omitempty"`
+}
+
+func (s *store) journalKey(project, serverName string) string {
+	return path.Join(NewServerPath(s.dir, project, serverName), fmt.Sprintf("%s.json", journalName))
+}
+
+func (s *store) LoadJournal(ctx context.Context, project, serverName string) (*Journal, error) {
+	bb, err := s.bucket.read(ctx, s.journalKey(project, serverName))
+	if err != nil {
+		if isNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load journal: %w", err)
+	}
+	j := Journal{}
+	if err := json.Unmarshal(bb, &j); err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	return &j, nil
+}
+
+func (s *store) StoreJournal(ctx context.Context, project, serverName string, j *Journal) error {
+	bb, err := json.Marshal(j)
+	if err != nil {
+		return fmt.Errorf("failed to process journal: %w", err)
+	}
+	write := func(_ string, bb []byte) error {
+		return s.bucket.write(ctx, s.journalKey(project, serverName), bb)
+	}
+	if err := storePart(write, journalName, bb); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return nil
+}
+
+func (s *store) RemoveJournal(ctx context.Context, project, serverName string) error {
+	if err := s.bucket.remove(ctx, s.journalKey(project, serverName)); err != nil {
+		return fmt.Errorf("failed to remove journal: %w", err)
+	}
+	return nil
+}
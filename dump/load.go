@@ -2,49 +2,73 @@ package dump
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"os"
-
-	"github.com/spf13/afero"
 )
 
-func LoadServer(path string) (*ServerDump, error) {
-	p := afero.NewBasePathFs(afero.NewOsFs(), path)
-	return loadServer(p)
-}
+// ErrCorrupt is wrapped by the errors of loading a dump whose parts are
+// missing or do not match their checksums.
+var ErrCorrupt = errors.New("dump is corrupt")
 
-func loadServer(p afero.Fs) (*ServerDump, error) {
+func loadServer(read func(name string) ([]byte, error)) (*ServerDump, error) {
 	s := ServerDump{}
-	var err error
-	load := func(name string, target interface{}) {
+	bb, err := read(partsName)
+	if isNotExist(err) {
+		return loadUnversioned(read, &s)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load parts manifest: %w", err)
+	}
+	m := partsManifest{}
+	if err := json.Unmarshal(bb, &m); err != nil {
+		return nil, fmt.Errorf("failed to read parts manifest: %w: %w", ErrCorrupt, err)
+	}
+	if m.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("dump has schema version %d, this version supports up to %d", m.SchemaVersion, SchemaVersion)
+	}
+
+	for _, part := range serverParts(&s) {
+		sum, ok := m.Checksums[part.name]
+		if !ok {
+			return nil, fmt.Errorf("part '%s' is not in the parts manifest: %w", part.name, ErrCorrupt)
+		}
+		bb, err := read(part.name)
+		if isNotExist(err) {
+			return nil, fmt.Errorf("part '%s' is missing: %w", part.name, ErrCorrupt)
+		}
 		if err != nil {
-			return
+			return nil, fmt.Errorf("failed to load '%s': %w", part.name, err)
 		}
-		if loadErr := loadPart(p, name, target); loadErr != nil {
-			err = fmt.Errorf("failed to load '%s': %w", name, loadErr)
+		if got := checksum(bb); got != sum {
+			return nil, fmt.Errorf("part '%s' has checksum %s, want %s: %w", part.name, got, sum, ErrCorrupt)
+		}
+		if err := json.Unmarshal(bb, part.value); err != nil {
+			return nil, fmt.Errorf("failed to read from '%s': %w: %w", part.name, ErrCorrupt, err)
 		}
 	}
-
-	load("server", &s.Server)
-	load("floatingIPs", &s.FloatingIPs)
-	load("sshKeys", &s.SSHKeys)
-	load("snapshot", &s.Snapshot)
-
+	migrate(&s, m.SchemaVersion)
 	return &s, nil
 }
 
-func loadPart(path afero.Fs, name string, target interface{}) error {
-	f, err := path.Open(fmt.Sprintf("%s.json", name))
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
+// loadUnversioned loads a dump written before dumps had a parts manifest.
+// Its parts have no checksums, and parts added later are missing.
+func loadUnversioned(read func(name string) ([]byte, error), s *ServerDump) (*ServerDump, error) {
+	for _, part := range serverParts(s) {
+		if err := loadPart(read, part.name, part.value); err != nil {
+			return nil, fmt.Errorf("failed to load '%s': %w", part.name, err)
 		}
-		return fmt.Errorf("failed to check if '%s' exists: %w", name, err)
 	}
-	defer f.Close()
-	bb, err := io.ReadAll(f)
+	migrate(s, 0)
+	s.Unversioned = true
+	return s, nil
+}
+
+func loadPart(read func(name string) ([]byte, error), name string, target interface{}) error {
+	bb, err := read(name)
 	if err != nil {
+		if isNotExist(err) {
+			return nil
+		}
 		return fmt.Errorf("failed read %s: %w", name, err)
 	}
 
@@ -0,0 +1,87 @@
+package dump
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+)
+
+const manifestName = "manifest"
+
+const OperationDump = "dump"
+
+const (
+	// StatusPending marks the dump of a freeze that has not finished yet.
+	StatusPending  = "pending"
+	StatusComplete = "complete"
+	// StatusFailed marks a server of a group whose freeze failed.
+	StatusFailed = "failed"
+)
+
+// idLayout sorts lexicographically in creation order.
+const idLayout = "20060102T150405.000000000Z"
+
+// Manifest describes a dump.
+type Manifest struct {
+	DumpID      string    `json:"dump_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	ToolVersion string    `json:"tool_version"`
+	ServerID    int64     `json:"server_id"`
+	ServerName  string    `json:"server_name"`
+	SnapshotID  int64     `json:"snapshot_id"`
+	Operation   string    `json:"operation"`
+	Status      string    `json:"status"`
+	// UnfrozenAt is when the server was first unfrozen from the dump, nil
+	// if it was not or the unfreeze was not recorded.
+	UnfrozenAt *time.Time `json:"unfrozen_at,omitempty"`
+}
+
+var (
+	idMu   sync.Mutex
+	lastID time.Time
+)
+
+// NewID returns a unique id that sorts after all ids returned before.
+func NewID() string {
+	idMu.Lock()
+	defer idMu.Unlock()
+	now := time.Now().UTC()
+	if !now.After(lastID) {
+		now = lastID.Add(time.Nanosecond)
+	}
+	lastID = now
+	return now.Format(idLayout)
+}
+
+func (s *store) manifestKey(project, serverName, dumpID string) string {
+	return path.Join(NewServerDumpPath(s.dir, project, serverName, dumpID), fmt.Sprintf("%s.json", manifestName))
+}
+
+func (s *store) PutManifest(ctx context.Context, project, serverName string, m *Manifest) error {
+	bb, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to process manifest: %w", err)
+	}
+	write := func(_ string, bb []byte) error {
+		return s.bucket.write(ctx, s.manifestKey(project, serverName, m.DumpID), bb)
+	}
+	if err := storePart(write, manifestName, bb); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+func (s *store) GetManifest(ctx context.Context, project, serverName, dumpID string) (*Manifest, error) {
+	bb, err := s.bucket.read(ctx, s.manifestKey(project, serverName, dumpID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load manifest of dump %s: %w", dumpID, err)
+	}
+	m := Manifest{}
+	if err := json.Unmarshal(bb, &m); err != nil {
+		return nil, fmt.Errorf("failed to read manifest of dump %s: %w", dumpID, err)
+	}
+	return &m, nil
+}
@@ -0,0 +1,36 @@
+package dump
+
+// SchemaVersion is the version of the format of the dumps written by this
+// version of the tool. Dumps written before the format was versioned are
+// version 0 and migrated on load.
+const SchemaVersion = 1
+
+// migrations upgrade a loaded dump from the version of their index to the
+// next one.
+var migrations = []func(s *ServerDump){
+	migrateUnversioned,
+}
+
+// migrate upgrades the dump from version to SchemaVersion. Only the loaded
+// dump is upgraded, the stored files are left as they are, so migrations run
+// on every load and must not depend on anything but the dump.
+func migrate(s *ServerDump, version int) {
+	for v := version; v < SchemaVersion; v++ {
+		migrations[v](s)
+	}
+}
+
+// migrateUnversioned fills in what unversioned dumps left implicit. Dumps
+// written before volume specs were recorded only know the volume ids, their
+// names are left empty since they are unknown. Dumps without ssh key
+// selection recorded every key of the project.
+func migrateUnversioned(s *ServerDump) {
+	if len(s.Volumes) == 0 {
+		for _, id := range s.Server.Volumes {
+			s.Volumes = append(s.Volumes, Volume{ID: id, Location: s.Server.Datacenter.Location.Name})
+		}
+	}
+	if len(s.SSHKeySelection.Source) == 0 {
+		s.SSHKeySelection.Source = SSHKeySourceProject
+	}
+}
@@ -11,7 +11,70 @@ type ServerDump struct {
 	Server      schema.Server
 	FloatingIPs []schema.FloatingIP
 	SSHKeys     []schema.SSHKey
-	Snapshot    schema.Image
+	// SSHKeySelection records how SSHKeys were chosen.
+	SSHKeySelection SSHKeySelection
+	Snapshot        schema.Image
+	Volumes         []Volume
+	PrimaryIPs      PrimaryIPs
+	ReverseDNS      []ReverseDNS
+	// Firewalls and Networks define the firewalls and private networks of
+	// the server in the order of Server.PublicNet.Firewalls and
+	// Server.PrivateNet, so missing ones can be recreated. The placement
+	// group is defined by Server.PlacementGroup.
+	Firewalls []schema.Firewall
+	Networks  []schema.Network
+	// UserData is the cloud-init user data the server was created with, the
+	// api does not return it. Unfreeze adds the floating ip config to it.
+	UserData string
+	// Unversioned is set if the dump was loaded from files written before
+	// dumps had a parts manifest. It is not stored.
+	Unversioned bool
+}
+
+// SSHKeySourceProject records every ssh key of the project, which dumps did
+// before the keys of the server were chosen.
+const SSHKeySourceProject = "project"
+
+// SSHKeySelection records how the ssh keys of the dumped server were chosen.
+type SSHKeySelection struct {
+	// Source is where the keys were taken from.
+	Source string `json:"source,omitempty"`
+}
+
+// ReverseDNS is a reverse dns entry of a primary or floating ip of the dumped
+// server.
+type ReverseDNS struct {
+	// Family is ipv4 or ipv6.
+	Family string `json:"family"`
+	// FloatingIPID is set for entries of floating ips, entries of primary ips
+	// belong to the server.
+	FloatingIPID int64  `json:"floating_ip_id,omitempty"`
+	IP           string `json:"ip"`
+	DNSPtr       string `json:"dns_ptr"`
+}
+
+// PrimaryIPs records what a freeze did with the primary ips of the server.
+// The addresses and reverse dns entries are in the dumped server.
+type PrimaryIPs struct {
+	// Policy is the primary ip policy of the freeze, empty for dumps that
+	// kept them.
+	Policy string `json:"policy,omitempty"`
+}
+
+// Volume describes a volume that was attached to the dumped server, so it can
+// be attached again on unfreeze.
+type Volume struct {
+	ID int64 `json:"id"`
+	// Name is empty in dumps written before volume specs were recorded.
+	Name        string `json:"name"`
+	Size        int    `json:"size"`
+	Location    string `json:"location"`
+	Format      string `json:"format,omitempty"`
+	Automount   bool   `json:"automount"`
+	LinuxDevice string `json:"linux_device"`
+	// Archived is set if the freeze archived the data of the volume into the
+	// dump and deleted the volume.
+	Archived bool `json:"archived,omitempty"`
 }
 
 func NewServerDumpPath(dir, project, serverName, dumpID string) string {
@@ -21,6 +84,13 @@ func NewServerDumpPath(dir, project, serverName, dumpID string) string {
 	return fmt.Sprintf("%s/%s/%s/%s", dir, project, serverName, dumpID)
 }
 
+func NewProjectPath(dir, project string) string {
+	if len(dir) == 0 {
+		dir = defaultPath
+	}
+	return fmt.Sprintf("%s/%s", dir, project)
+}
+
 func NewServerPath(dir, project, serverName string) string {
 	if len(dir) == 0 {
 		dir = defaultPath
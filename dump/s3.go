@@ -0,0 +1,180 @@
+package dump
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/samber/lo"
+)
+
+// S3Options configure a Store backed by an S3 compatible object storage like
+// Hetzner Object Storage or MinIO.
+type S3Options struct {
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	// Prefix is the key prefix dumps are stored under.
+	Prefix   string
+	Insecure bool
+}
+
+// maxCopySize is the largest object S3 copies with a single request.
+const maxCopySize = 5 << 30
+
+// NewS3Store returns a Store that keeps dumps in an S3 bucket.
+func NewS3Store(ctx context.Context, opts S3Options) (Store, error) {
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, ""),
+		Secure: !opts.Insecure,
+		Region: opts.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+	exists, err := client.BucketExists(ctx, opts.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("could not check bucket %s: %w", opts.Bucket, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("bucket %s does not exist", opts.Bucket)
+	}
+	return &store{dir: opts.Prefix, bucket: &s3Bucket{client: client, bucket: opts.Bucket, copyLimit: maxCopySize}}, nil
+}
+
+type s3Bucket struct {
+	client *minio.Client
+	bucket string
+	// copyLimit is the size above which objects are copied in parts.
+	copyLimit int64
+}
+
+func (b *s3Bucket) read(ctx context.Context, key string) ([]byte, error) {
+	obj, err := b.client.GetObject(ctx, b.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, b.wrapErr(key, err)
+	}
+	defer obj.Close()
+	bb, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, b.wrapErr(key, err)
+	}
+	return bb, nil
+}
+
+func (b *s3Bucket) write(ctx context.Context, key string, data []byte) error {
+	_, err := b.client.PutObject(ctx, b.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: "application/json",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload '%s': %w", key, err)
+	}
+	return nil
+}
+
+func (b *s3Bucket) writeFrom(ctx context.Context, key string, data io.Reader) error {
+	// a size of -1 uploads in parts until data is drained
+	_, err := b.client.PutObject(ctx, b.bucket, key, data, -1, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload '%s': %w", key, err)
+	}
+	return nil
+}
+
+func (b *s3Bucket) open(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := b.client.GetObject(ctx, b.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, b.wrapErr(key, err)
+	}
+	// errors like a missing key only surface on the first request
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, b.wrapErr(key, err)
+	}
+	return obj, nil
+}
+
+func (b *s3Bucket) list(ctx context.Context, prefix string) ([]string, error) {
+	prefix = strings.TrimSuffix(prefix, "/") + "/"
+	var names []string
+	for obj := range b.client.ListObjects(ctx, b.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("failed to list '%s': %w", prefix, obj.Err)
+		}
+		// without recursion sub-directories are returned as common prefixes
+		if strings.HasSuffix(obj.Key, "/") {
+			names = append(names, strings.TrimSuffix(strings.TrimPrefix(obj.Key, prefix), "/"))
+		}
+	}
+	return names, nil
+}
+
+func (b *s3Bucket) remove(ctx context.Context, prefix string) error {
+	keys := []string{prefix}
+	for obj := range b.client.ListObjects(ctx, b.bucket, minio.ListObjectsOptions{
+		Prefix:    strings.TrimSuffix(prefix, "/") + "/",
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return fmt.Errorf("failed to list '%s': %w", prefix, obj.Err)
+		}
+		keys = append(keys, obj.Key)
+	}
+	for _, key := range keys {
+		err := b.client.RemoveObject(ctx, b.bucket, key, minio.RemoveObjectOptions{})
+		if err != nil && minio.ToErrorResponse(err).Code != "NoSuchKey" {
+			return fmt.Errorf("failed to remove '%s': %w", key, err)
+		}
+	}
+	return nil
+}
+
+func (b *s3Bucket) rename(ctx context.Context, from, to string) error {
+	from = strings.TrimSuffix(from, "/") + "/"
+	var keys []string
+	sizes := map[string]int64{}
+	for obj := range b.client.ListObjects(ctx, b.bucket, minio.ListObjectsOptions{Prefix: from, Recursive: true}) {
+		if obj.Err != nil {
+			return fmt.Errorf("failed to list '%s': %w", from, obj.Err)
+		}
+		keys = append(keys, obj.Key)
+		sizes[obj.Key] = obj.Size
+	}
+	// objects cannot be moved at once, a dump is complete once its marker is
+	marker := from + fmt.Sprintf("%s.json", completeName)
+	if lo.Contains(keys, marker) {
+		keys = append(lo.Without(keys, marker), marker)
+	}
+	for _, key := range keys {
+		dst := minio.CopyDestOptions{Bucket: b.bucket, Object: path.Join(to, strings.TrimPrefix(key, from))}
+		src := minio.CopySrcOptions{Bucket: b.bucket, Object: key}
+		var err error
+		if sizes[key] > b.copyLimit {
+			// volume archives can exceed what a single copy allows
+			_, err = b.client.ComposeObject(ctx, dst, src)
+		} else {
+			_, err = b.client.CopyObject(ctx, dst, src)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to copy '%s' to '%s': %w", key, dst.Object, err)
+		}
+	}
+	return b.remove(ctx, strings.TrimSuffix(from, "/"))
+}
+
+func (b *s3Bucket) wrapErr(key string, err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return fmt.Errorf("'%s': %w", key, os.ErrNotExist)
+	}
+	return fmt.Errorf("failed to download '%s': %w", key, err)
+}
@@ -0,0 +1,352 @@
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testBucket = "freezer"
+
+// fakeS3 is an in-process fake of the parts of the S3 api the s3 bucket uses:
+// objects, multipart uploads, copies and v2 listings with a delimiter.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	// copies records the destinations of copied objects in order.
+	copies []string
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}}
+}
+
+// newS3TestStore returns a store backed by a fake S3 server, or by the MinIO
+// server of FREEZER_TEST_S3_ENDPOINT if it is set. The fake is nil then.
+func newS3TestStore(t *testing.T) (*store, *fakeS3) {
+	t.Helper()
+	opts := S3Options{
+		Endpoint:  os.Getenv("FREEZER_TEST_S3_ENDPOINT"),
+		Bucket:    os.Getenv("FREEZER_TEST_S3_BUCKET"),
+		Region:    "us-east-1",
+		AccessKey: os.Getenv("FREEZER_TEST_S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("FREEZER_TEST_S3_SECRET_KEY"),
+		// every test gets its own prefix in a shared bucket
+		Prefix:   fmt.Sprintf("test-%d", time.Now().UnixNano()),
+		Insecure: true,
+	}
+	var fake *fakeS3
+	if len(opts.Endpoint) == 0 {
+		fake = newFakeS3()
+		srv := httptest.NewServer(fake)
+		t.Cleanup(srv.Close)
+		opts.Endpoint = strings.TrimPrefix(srv.URL, "http://")
+		opts.Bucket = testBucket
+		opts.Prefix = ""
+	}
+	s, err := NewS3Store(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("could not create s3 store: %v", err)
+	}
+	return s.(*store), fake
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != testBucket {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	q := r.URL.Query()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case len(key) == 0 && r.Method == http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case len(key) == 0 && r.Method == http.MethodGet:
+		f.list(w, q.Get("prefix"), q.Get("delimiter"))
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		id := strconv.Itoa(len(f.uploads) + 1)
+		f.uploads[id] = map[int][]byte{}
+		writeS3XML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadID string `xml:"UploadId"`
+		}{Bucket: bucket, Key: key, UploadID: id})
+	case r.Method == http.MethodPut && q.Has("uploadId") && len(r.Header.Get("X-Amz-Copy-Source")) > 0:
+		src, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		data, ok := f.objects[strings.TrimPrefix(strings.TrimPrefix(src, "/"), testBucket+"/")]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("X-Amz-Copy-Source-Range"), "bytes=%d-%d", &start, &end); err != nil || end >= len(data) {
+			writeS3Error(w, http.StatusBadRequest, "InvalidRange")
+			return
+		}
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		f.uploads[q.Get("uploadId")][n] = data[start : end+1]
+		f.copies = append(f.copies, key)
+		writeS3XML(w, struct {
+			XMLName      xml.Name `xml:"CopyPartResult"`
+			ETag         string
+			LastModified string
+		}{ETag: fmt.Sprintf(`"%d"`, n), LastModified: time.Now().UTC().Format(time.RFC3339)})
+	case r.Method == http.MethodPut && q.Has("uploadId"):
+		data, err := readS3Body(r)
+		if err != nil {
+			writeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		f.uploads[q.Get("uploadId")][n] = data
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, n))
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		parts := f.uploads[q.Get("uploadId")]
+		var data []byte
+		for n := 1; n <= len(parts); n++ {
+			data = append(data, parts[n]...)
+		}
+		f.objects[key] = data
+		delete(f.uploads, q.Get("uploadId"))
+		writeS3XML(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string
+			Key     string
+			ETag    string
+		}{Bucket: bucket, Key: key, ETag: `"upload"`})
+	case r.Method == http.MethodDelete && q.Has("uploadId"):
+		delete(f.uploads, q.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && len(r.Header.Get("X-Amz-Copy-Source")) > 0:
+		src, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		data, ok := f.objects[strings.TrimPrefix(strings.TrimPrefix(src, "/"), testBucket+"/")]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		f.objects[key] = data
+		f.copies = append(f.copies, key)
+		writeS3XML(w, struct {
+			XMLName      xml.Name `xml:"CopyObjectResult"`
+			ETag         string
+			LastModified string
+		}{ETag: `"copy"`, LastModified: time.Now().UTC().Format(time.RFC3339)})
+	case r.Method == http.MethodPut:
+		data, err := readS3Body(r)
+		if err != nil {
+			writeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		f.objects[key] = data
+		w.Header().Set("ETag", `"object"`)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", `"object"`)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(data)
+		}
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// list answers a v2 listing, keys below the delimiter after the prefix are
+// rolled up into common prefixes.
+func (f *fakeS3) list(w http.ResponseWriter, prefix, delimiter string) {
+	type object struct {
+		Key          string
+		Size         int
+		ETag         string
+		LastModified string
+	}
+	type commonPrefix struct {
+		Prefix string
+	}
+	res := struct {
+		XMLName        xml.Name `xml:"ListBucketResult"`
+		Name           string
+		Prefix         string
+		KeyCount       int
+		MaxKeys        int
+		IsTruncated    bool
+		Contents       []object
+		CommonPrefixes []commonPrefix
+	}{Name: testBucket, Prefix: prefix, MaxKeys: 1000}
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	seen := map[string]bool{}
+	for _, key := range keys {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		if i := strings.Index(rest, delimiter); len(delimiter) > 0 && i >= 0 {
+			p := prefix + rest[:i+len(delimiter)]
+			if !seen[p] {
+				seen[p] = true
+				res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: p})
+			}
+			continue
+		}
+		res.Contents = append(res.Contents, object{Key: key, Size: len(f.objects[key]), ETag: `"object"`, LastModified: time.Now().UTC().Format(time.RFC3339)})
+	}
+	res.KeyCount = len(res.Contents) + len(res.CommonPrefixes)
+	writeS3XML(w, res)
+}
+
+// readS3Body returns the payload of an upload, which is chunked with a
+// signature per chunk on unencrypted connections.
+func readS3Body(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	var data bytes.Buffer
+	br := bufio.NewReader(r.Body)
+	for {
+		header, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(header), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return data.Bytes(), nil
+		}
+		if _, err := io.CopyN(&data, br, size); err != nil {
+			return nil, err
+		}
+		if _, err := br.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func writeS3XML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: code})
+}
+
+func TestS3BucketListsCommonPrefixes(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newS3TestStore(t)
+	for _, key := range []string{"a/b/1.json", "a/b/2.json", "a/c/d/3.json", "a/4.json", "ab/5.json"} {
+		if err := s.bucket.write(ctx, path.Join(s.dir, key), []byte("{}")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names, err := s.bucket.list(ctx, path.Join(s.dir, "a"))
+	if err != nil {
+		t.Fatalf("could not list: %v", err)
+	}
+	if !slices.Equal(names, []string{"b", "c"}) {
+		t.Errorf("listed %v, want the sub-directories b and c", names)
+	}
+}
+
+func TestS3BucketRenamesMarkerLast(t *testing.T) {
+	ctx := context.Background()
+	s, fake := newS3TestStore(t)
+	if fake == nil {
+		t.Skip("the order of copies is only recorded by the fake")
+	}
+	if err := s.Put(ctx, testProject, testServer, testDumpID, testDump()); err != nil {
+		t.Fatalf("could not store dump: %v", err)
+	}
+	marker := path.Join(NewServerDumpPath(s.dir, testProject, testServer, testDumpID), completeName+".json")
+	if len(fake.copies) < 2 || fake.copies[len(fake.copies)-1] != marker {
+		t.Errorf("copied %v, want %s last", fake.copies, marker)
+	}
+	if staged, _ := s.staged(ctx, testProject, testServer); len(staged) > 0 {
+		t.Errorf("dumps %v left in staging", staged)
+	}
+}
+
+func TestS3BucketRemovesPrefix(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newS3TestStore(t)
+	keys := []string{"a/b", "a/b/1.json", "a/b/c/2.json", "a/bc/3.json", "a/4.json"}
+	for _, key := range keys {
+		if err := s.bucket.write(ctx, path.Join(s.dir, key), []byte("{}")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.bucket.remove(ctx, path.Join(s.dir, "a/b")); err != nil {
+		t.Fatalf("could not remove: %v", err)
+	}
+	for i, key := range keys {
+		_, err := s.bucket.read(ctx, path.Join(s.dir, key))
+		if removed := errors.Is(err, os.ErrNotExist); removed != (i < 3) {
+			t.Errorf("%s removed %v, want %v", key, removed, i < 3)
+		}
+	}
+}
+
+func TestS3BucketRenamesLargeObjectsInParts(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newS3TestStore(t)
+	b := s.bucket.(*s3Bucket)
+	// copy everything but the marker in parts
+	b.copyLimit = 4
+	objects := map[string]string{"volume-data.tar.gz": "volume data", "complete.json": "{}"}
+	for name, data := range objects {
+		if err := b.write(ctx, path.Join(s.dir, "staging", name), []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.rename(ctx, path.Join(s.dir, "staging"), path.Join(s.dir, "dump")); err != nil {
+		t.Fatalf("could not rename: %v", err)
+	}
+	for name, data := range objects {
+		got, err := b.read(ctx, path.Join(s.dir, "dump", name))
+		if err != nil || string(got) != data {
+			t.Errorf("%s is %q (%v), want %q", name, got, err, data)
+		}
+		if _, err := b.read(ctx, path.Join(s.dir, "staging", name)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s left in staging: %v", name, err)
+		}
+	}
+}
@@ -2,44 +2,325 @@ package dump
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/spf13/afero"
+	"io"
 	"os"
+	"path"
+	"time"
+
+	"github.com/samber/lo"
 )
 
-func StoreServer(path string, s *ServerDump) error {
-	p := afero.NewBasePathFs(afero.NewOsFs(), path)
-	return storeServer(p, s)
+// Store persists server dumps and journals, addressed by project, server name
+// and dump id.
+type Store interface {
+	Put(ctx context.Context, project, serverName, dumpID string, s *ServerDump) error
+	Get(ctx context.Context, project, serverName, dumpID string) (*ServerDump, error)
+	// ListProjects returns the names of all projects with dumps.
+	ListProjects(ctx context.Context) ([]string, error)
+	// ListServers returns the names of all servers of the project with dumps.
+	ListServers(ctx context.Context, project string) ([]string, error)
+	// List returns the ids of all dumps of the server that were written
+	// completely.
+	List(ctx context.Context, project, serverName string) ([]string, error)
+	Delete(ctx context.Context, project, serverName, dumpID string) error
+
+	PutManifest(ctx context.Context, project, serverName string, m *Manifest) error
+	// GetManifest returns an error wrapping os.ErrNotExist if the dump has no
+	// manifest.
+	GetManifest(ctx context.Context, project, serverName, dumpID string) (*Manifest, error)
+
+	// LoadJournal returns the journal of the server or nil if there is none.
+	LoadJournal(ctx context.Context, project, serverName string) (*Journal, error)
+	StoreJournal(ctx context.Context, project, serverName string, j *Journal) error
+	RemoveJournal(ctx context.Context, project, serverName string) error
+
+	PutGroup(ctx context.Context, project string, g *GroupManifest) error
+	GetGroup(ctx context.Context, project, groupID string) (*GroupManifest, error)
+	// ListGroups returns the ids of all group manifests of the project.
+	ListGroups(ctx context.Context, project string) ([]string, error)
+
+	// PutVolumeArchive stores the archived data of a volume in the dump and
+	// sets the size and checksum of the archive. Archives are staged until
+	// the dump is put.
+	PutVolumeArchive(ctx context.Context, project, serverName, dumpID string, a *VolumeArchive, data io.Reader) error
+	GetVolumeArchive(ctx context.Context, project, serverName, dumpID, volumeName string) (*VolumeArchive, error)
+	// OpenVolumeArchive returns a reader of the archived data of the volume,
+	// which the caller must close.
+	OpenVolumeArchive(ctx context.Context, project, serverName, dumpID, volumeName string) (io.ReadCloser, error)
+}
+
+// bucket is a flat key value storage that a Store keeps its files in. Keys are
+// slash separated paths.
+type bucket interface {
+	// read returns an error wrapping os.ErrNotExist if the key does not exist.
+	read(ctx context.Context, key string) ([]byte, error)
+	write(ctx context.Context, key string, data []byte) error
+	// writeFrom streams data of unknown size to the key.
+	writeFrom(ctx context.Context, key string, data io.Reader) error
+	// open returns an error wrapping os.ErrNotExist if the key does not exist.
+	open(ctx context.Context, key string) (io.ReadCloser, error)
+	// list returns the names of the direct sub-directories of prefix.
+	list(ctx context.Context, prefix string) ([]string, error)
+	// remove deletes the key and everything below it.
+	remove(ctx context.Context, prefix string) error
+	// rename moves everything below from to to, which must not exist. File
+	// buckets move it atomically, others copy the keys, the completion marker
+	// of a dump last, and then remove from.
+	rename(ctx context.Context, from, to string) error
+}
+
+type store struct {
+	dir    string
+	bucket bucket
+}
+
+func (s *store) Put(ctx context.Context, project, serverName, dumpID string, d *ServerDump) error {
+	dumpPath := NewServerDumpPath(s.dir, project, serverName, dumpID)
+	stagingPath := s.stagingPath(project, serverName, dumpID)
+	if err := s.unplace(ctx, project, serverName, dumpID); err != nil {
+		return err
+	}
+	write := func(name string, bb []byte) error {
+		return s.bucket.write(ctx, path.Join(stagingPath, fmt.Sprintf("%s.json", name)), bb)
+	}
+	if err := storeServer(write, d); err != nil {
+		return err
+	}
+	bb, err := json.Marshal(&completion{DumpID: dumpID, CompletedAt: time.Now().UTC()})
+	if err != nil {
+		return fmt.Errorf("failed to process completion marker: %w", err)
+	}
+	if err := storePart(write, completeName, bb); err != nil {
+		return fmt.Errorf("failed to write completion marker: %w", err)
+	}
+	if err := s.bucket.rename(ctx, stagingPath, dumpPath); err != nil {
+		return fmt.Errorf("failed to move dump into place: %w", err)
+	}
+	return nil
+}
+
+// unplace moves a dump that an earlier put of the same id moved into place
+// back to the staging directory, so that a rerun replaces it along with the
+// files stored with it, like volume archives. A dump that was only partly
+// moved into place is removed, its staged copy is complete.
+func (s *store) unplace(ctx context.Context, project, serverName, dumpID string) error {
+	names, err := s.bucket.list(ctx, NewServerPath(s.dir, project, serverName))
+	if err != nil {
+		return err
+	}
+	if !lo.Contains(names, dumpID) {
+		return nil
+	}
+	staged, err := s.staged(ctx, project, serverName)
+	if err != nil {
+		return err
+	}
+	dumpPath := NewServerDumpPath(s.dir, project, serverName, dumpID)
+	stagingPath := s.stagingPath(project, serverName, dumpID)
+	complete, err := s.complete(ctx, dumpPath, lo.Contains(staged, dumpID))
+	if err != nil {
+		return err
+	}
+	if !complete {
+		if err := s.bucket.remove(ctx, dumpPath); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", dumpPath, err)
+		}
+		return nil
+	}
+	if err := s.bucket.remove(ctx, stagingPath); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", stagingPath, err)
+	}
+	if err := s.bucket.rename(ctx, dumpPath, stagingPath); err != nil {
+		return fmt.Errorf("failed to move dump %s back to staging: %w", dumpID, err)
+	}
+	return nil
+}
+
+func (s *store) Get(ctx context.Context, project, serverName, dumpID string) (*ServerDump, error) {
+	dumpPath := NewServerDumpPath(s.dir, project, serverName, dumpID)
+	staged, err := s.staged(ctx, project, serverName)
+	if err != nil {
+		return nil, err
+	}
+	complete, err := s.complete(ctx, dumpPath, lo.Contains(staged, dumpID))
+	if err != nil {
+		return nil, err
+	}
+	if !complete {
+		return nil, fmt.Errorf("dump %s is incomplete", dumpID)
+	}
+	return loadServer(func(name string) ([]byte, error) {
+		return s.bucket.read(ctx, path.Join(dumpPath, fmt.Sprintf("%s.json", name)))
+	})
+}
+
+func (s *store) ListProjects(ctx context.Context) ([]string, error) {
+	dir := s.dir
+	if len(dir) == 0 {
+		dir = defaultPath
+	}
+	return s.bucket.list(ctx, dir)
+}
+
+func (s *store) ListServers(ctx context.Context, project string) ([]string, error) {
+	names, err := s.bucket.list(ctx, NewProjectPath(s.dir, project))
+	if err != nil {
+		return nil, err
+	}
+	return lo.Without(names, groupsDir), nil
 }
 
-func storeServer(p afero.Fs, s *ServerDump) error {
-	var err error
-	store := func(name string, obj interface{}) {
-		bb, err := json.Marshal(obj)
+func (s *store) List(ctx context.Context, project, serverName string) ([]string, error) {
+	names, err := s.bucket.list(ctx, NewServerPath(s.dir, project, serverName))
+	if err != nil {
+		return nil, err
+	}
+	staged, err := s.staged(ctx, project, serverName)
+	if err != nil {
+		return nil, err
+	}
+	var dumpIDs []string
+	for _, dumpID := range lo.Without(names, stagingDir) {
+		complete, err := s.complete(ctx, NewServerDumpPath(s.dir, project, serverName, dumpID), lo.Contains(staged, dumpID))
 		if err != nil {
-			err = fmt.Errorf("failed to process '%s': %w", name, err)
-			return
+			return nil, err
+		}
+		if complete {
+			dumpIDs = append(dumpIDs, dumpID)
 		}
-		if storeErr := storePart(p, name, bb); storeErr != nil {
-			err = fmt.Errorf("failed to write to disc: %w", storeErr)
+	}
+	return dumpIDs, nil
+}
+
+func (s *store) Delete(ctx context.Context, project, serverName, dumpID string) error {
+	for _, dumpPath := range []string{s.stagingPath(project, serverName, dumpID), NewServerDumpPath(s.dir, project, serverName, dumpID)} {
+		if err := s.bucket.remove(ctx, dumpPath); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", dumpPath, err)
 		}
 	}
+	return nil
+}
 
-	store("server", &s.Server)
-	store("floatingIPs", &s.FloatingIPs)
-	store("sshKeys", &s.SSHKeys)
-	store("snapshot", &s.Snapshot)
+// stagingDir holds the dumps of a server while they are written, so that
+// half-written dumps are never in place.
+const stagingDir = ".staging"
+
+// completeName marks a dump whose parts were all written, it is written last.
+const completeName = "complete"
+
+// completion is the content of the completion marker of a dump.
+type completion struct {
+	DumpID      string    `json:"dump_id"`
+	CompletedAt time.Time `json:"completed_at"`
+}
 
+func (s *store) stagingPath(project, serverName, dumpID string) string {
+	return path.Join(NewServerPath(s.dir, project, serverName), stagingDir, dumpID)
+}
+
+// staged returns the ids of the dumps of the server that are being written
+// or were left behind by an interrupted put.
+func (s *store) staged(ctx context.Context, project, serverName string) ([]string, error) {
+	staged, err := s.bucket.list(ctx, path.Join(NewServerPath(s.dir, project, serverName), stagingDir))
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to list staged dumps: %w", err)
 	}
+	return staged, nil
+}
+
+// complete reports whether the dump was written completely. Dumps without
+// completion marker are incomplete if they are still staged or have a parts
+// manifest, otherwise they were written before dumps were staged.
+func (s *store) complete(ctx context.Context, dumpPath string, staged bool) (bool, error) {
+	exists := func(name string) (bool, error) {
+		_, err := s.bucket.read(ctx, path.Join(dumpPath, fmt.Sprintf("%s.json", name)))
+		if isNotExist(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to check '%s': %w", name, err)
+		}
+		return true, nil
+	}
+	marked, err := exists(completeName)
+	if err != nil || marked {
+		return marked, err
+	}
+	if staged {
+		return false, nil
+	}
+	versioned, err := exists(partsName)
+	return !versioned, err
+}
+
+const partsName = "parts"
 
+// partsManifest records the schema version of a dump and the sha256
+// checksums of its parts.
+type partsManifest struct {
+	SchemaVersion int               `json:"schema_version"`
+	Checksums     map[string]string `json:"checksums"`
+}
+
+type serverPart struct {
+	name  string
+	value interface{}
+}
+
+// serverParts returns the parts of the dump, each stored in its own file.
+func serverParts(s *ServerDump) []serverPart {
+	return []serverPart{
+		{"server", &s.Server},
+		{"floatingIPs", &s.FloatingIPs},
+		{"sshKeys", &s.SSHKeys},
+		{"sshKeySelection", &s.SSHKeySelection},
+		{"snapshot", &s.Snapshot},
+		{"volumes", &s.Volumes},
+		{"primaryIPs", &s.PrimaryIPs},
+		{"reverseDNS", &s.ReverseDNS},
+		{"firewalls", &s.Firewalls},
+		{"networks", &s.Networks},
+		{"userData", &s.UserData},
+	}
+}
+
+func storeServer(write func(name string, bb []byte) error, s *ServerDump) error {
+	checksums := map[string]string{}
+	record := func(name string, bb []byte) error {
+		if err := write(name, bb); err != nil {
+			return err
+		}
+		checksums[name] = checksum(bb)
+		return nil
+	}
+	for _, part := range serverParts(s) {
+		bb, err := json.Marshal(part.value)
+		if err != nil {
+			return fmt.Errorf("failed to process '%s': %w", part.name, err)
+		}
+		if err := storePart(record, part.name, bb); err != nil {
+			return fmt.Errorf("failed to write to disc: %w", err)
+		}
+	}
+
+	// the parts manifest is written last, so it only lists written parts
+	bb, err := json.Marshal(&partsManifest{SchemaVersion: SchemaVersion, Checksums: checksums})
+	if err != nil {
+		return fmt.Errorf("failed to process parts manifest: %w", err)
+	}
+	if err := storePart(write, partsName, bb); err != nil {
+		return fmt.Errorf("failed to write parts manifest: %w", err)
+	}
 	return nil
 }
 
-func storePart(parent afero.Fs, name string, bb []byte) error {
+func storePart(write func(name string, bb []byte) error, name string, bb []byte) error {
 	if len(bb) == 0 {
 		return nil
 	}
@@ -48,25 +329,17 @@ func storePart(parent afero.Fs, name string, bb []byte) error {
 	if err := json.Indent(&output, bb, "", "    "); err != nil {
 		return fmt.Errorf("failed to format '%s': %w", name, err)
 	}
-	f, err := parent.Create(fmt.Sprintf("%s.json", name))
-	if err != nil {
-		return fmt.Errorf("failed to create '%s': %w", fmt.Sprintf("%s.json", name), err)
-	}
-	_, err = f.Write(output.Bytes())
-	if err != nil {
+	if err := write(name, output.Bytes()); err != nil {
 		return fmt.Errorf("failed to write json output: %w", err)
 	}
 	return nil
 }
 
-func EnsureHasDirectory(path string) (string, error) {
-	_, err := os.Stat(path)
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
-		return "", fmt.Errorf("could not stat dir %s: %w", path, err)
-	}
-	err = os.MkdirAll(path, os.ModePerm)
-	if err != nil {
-		return "", fmt.Errorf("failed to create %s: %w", path, err)
-	}
-	return path, nil
+func checksum(bb []byte) string {
+	sum := sha256.Sum256(bb)
+	return hex.EncodeToString(sum[:])
+}
+
+func isNotExist(err error) bool {
+	return errors.Is(err, os.ErrNotExist)
 }
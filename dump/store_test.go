@@ -0,0 +1,211 @@
+package dump
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+	"github.com/spf13/afero"
+)
+
+const (
+	testProject = "project"
+	testServer  = "web"
+	testDumpID  = "20260101T000000.000000000Z"
+)
+
+func newTestStore() *store {
+	return &store{bucket: &fileBucket{fs: afero.NewMemMapFs()}}
+}
+
+// forEachStore runs the test against a store of each kind of bucket.
+func forEachStore(t *testing.T, test func(t *testing.T, s *store)) {
+	t.Run("file", func(t *testing.T) {
+		test(t, newTestStore())
+	})
+	t.Run("s3", func(t *testing.T) {
+		s, _ := newS3TestStore(t)
+		test(t, s)
+	})
+}
+
+func testDump() *ServerDump {
+	return &ServerDump{
+		Server:          schema.Server{ID: 1, Name: testServer, Volumes: []int64{7}},
+		SSHKeys:         []schema.SSHKey{{ID: 2, Name: "admin"}},
+		SSHKeySelection: SSHKeySelection{Source: "flag"},
+		Snapshot:        schema.Image{ID: 3},
+		Volumes:         []Volume{{ID: 7, Name: "data", Size: 10}},
+	}
+}
+
+func partKey(s *store, name string) string {
+	return path.Join(NewServerDumpPath(s.dir, testProject, testServer, testDumpID), name+".json")
+}
+
+func TestStoreChecksumsParts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *store) {
+		ctx := context.Background()
+		if err := s.Put(ctx, testProject, testServer, testDumpID, testDump()); err != nil {
+			t.Fatalf("could not store dump: %v", err)
+		}
+		loaded, err := s.Get(ctx, testProject, testServer, testDumpID)
+		if err != nil {
+			t.Fatalf("could not load dump: %v", err)
+		}
+		if loaded.Server.Name != testServer || loaded.SSHKeySelection.Source != "flag" || len(loaded.Volumes) != 1 || loaded.Volumes[0].Name != "data" {
+			t.Errorf("loaded dump %+v", loaded)
+		}
+
+		if err := s.bucket.write(ctx, partKey(s, "snapshot"), []byte(`{"id": 4}`)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Get(ctx, testProject, testServer, testDumpID); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("corrupted part loaded with error %v", err)
+		}
+		if err := s.bucket.remove(ctx, partKey(s, "snapshot")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Get(ctx, testProject, testServer, testDumpID); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("missing part loaded with error %v", err)
+		}
+	})
+}
+
+func TestStoreRejectsNewerSchema(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *store) {
+		ctx := context.Background()
+		if err := s.Put(ctx, testProject, testServer, testDumpID, testDump()); err != nil {
+			t.Fatalf("could not store dump: %v", err)
+		}
+		if err := s.bucket.write(ctx, partKey(s, partsName), []byte(`{"schema_version": 99}`)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Get(ctx, testProject, testServer, testDumpID); err == nil {
+			t.Error("dump of a newer schema loaded")
+		}
+	})
+}
+
+func TestStoreMigratesUnversionedDumps(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *store) {
+		ctx := context.Background()
+		// dumps of old versions had fewer parts and no parts manifest
+		legacy := map[string]string{
+			"server":      `{"id": 1, "name": "web", "volumes": [7], "datacenter": {"location": {"name": "fsn1"}}}`,
+			"floatingIPs": `[]`,
+			"sshKeys":     `[{"id": 2, "name": "admin"}]`,
+			"snapshot":    `{"id": 3}`,
+		}
+		for name, content := range legacy {
+			if err := s.bucket.write(ctx, partKey(s, name), []byte(content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		loaded, err := s.Get(ctx, testProject, testServer, testDumpID)
+		if err != nil {
+			t.Fatalf("could not load unversioned dump: %v", err)
+		}
+		if dumpIDs, err := s.List(ctx, testProject, testServer); err != nil || len(dumpIDs) != 1 {
+			t.Errorf("unversioned dumps %v listed, error %v", dumpIDs, err)
+		}
+		if !loaded.Unversioned {
+			t.Error("unversioned dump not marked")
+		}
+		if loaded.SSHKeySelection.Source != SSHKeySourceProject {
+			t.Errorf("ssh key source %q, want %q", loaded.SSHKeySelection.Source, SSHKeySourceProject)
+		}
+		if len(loaded.Volumes) != 1 || loaded.Volumes[0].ID != 7 || loaded.Volumes[0].Location != "fsn1" || len(loaded.Volumes[0].Name) > 0 {
+			t.Errorf("volumes %+v, want volume 7 in fsn1 without a name", loaded.Volumes)
+		}
+	})
+}
+
+func TestStoreReportsWriteErrors(t *testing.T) {
+	failing := errors.New("disc full")
+	err := storeServer(func(name string, bb []byte) error {
+		if name == "volumes" {
+			return failing
+		}
+		return nil
+	}, testDump())
+	if !errors.Is(err, failing) {
+		t.Errorf("store failed with %v, want the write error", err)
+	}
+}
+
+func TestStoreIgnoresIncompleteDumps(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *store) {
+		ctx := context.Background()
+		if err := s.Put(ctx, testProject, testServer, testDumpID, testDump()); err != nil {
+			t.Fatalf("could not store dump: %v", err)
+		}
+		if staged, _ := s.staged(ctx, testProject, testServer); len(staged) > 0 {
+			t.Errorf("dumps %v left in staging", staged)
+		}
+
+		// a put interrupted while writing the parts
+		interrupted := "20260102T000000.000000000Z"
+		stagingPath := s.stagingPath(testProject, testServer, interrupted)
+		if err := s.bucket.write(ctx, path.Join(stagingPath, "server.json"), []byte(`{"id": 1}`)); err != nil {
+			t.Fatal(err)
+		}
+		// a dump half copied into place by a bucket without atomic renames
+		halfCopied := "20260103T000000.000000000Z"
+		for _, key := range []string{
+			path.Join(s.stagingPath(testProject, testServer, halfCopied), "complete.json"),
+			path.Join(NewServerDumpPath(s.dir, testProject, testServer, halfCopied), "server.json"),
+		} {
+			if err := s.bucket.write(ctx, key, []byte(`{"id": 1}`)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		dumpIDs, err := s.List(ctx, testProject, testServer)
+		if err != nil {
+			t.Fatalf("could not list dumps: %v", err)
+		}
+		if len(dumpIDs) != 1 || dumpIDs[0] != testDumpID {
+			t.Errorf("dumps %v, want only the complete %s", dumpIDs, testDumpID)
+		}
+		if _, err := s.Get(ctx, testProject, testServer, halfCopied); err == nil {
+			t.Error("half copied dump loaded")
+		}
+	})
+}
+
+func TestStorePutReplacesPlacedDump(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *store) {
+		ctx := context.Background()
+		a := &VolumeArchive{VolumeName: "data"}
+		if err := s.PutVolumeArchive(ctx, testProject, testServer, testDumpID, a, strings.NewReader("archive")); err != nil {
+			t.Fatalf("could not store archive: %v", err)
+		}
+		if _, err := s.GetVolumeArchive(ctx, testProject, testServer, testDumpID, "data"); err == nil {
+			t.Error("archive of a staged dump loaded")
+		}
+		if err := s.Put(ctx, testProject, testServer, testDumpID, testDump()); err != nil {
+			t.Fatalf("could not store dump: %v", err)
+		}
+
+		// a rerun of an interrupted freeze puts the dump again
+		rerun := testDump()
+		rerun.Snapshot.ID = 4
+		if err := s.Put(ctx, testProject, testServer, testDumpID, rerun); err != nil {
+			t.Fatalf("could not store dump again: %v", err)
+		}
+		loaded, err := s.Get(ctx, testProject, testServer, testDumpID)
+		if err != nil {
+			t.Fatalf("could not load dump: %v", err)
+		}
+		if loaded.Snapshot.ID != 4 {
+			t.Errorf("snapshot %d, want the one of the rerun", loaded.Snapshot.ID)
+		}
+		if got, err := s.GetVolumeArchive(ctx, testProject, testServer, testDumpID, "data"); err != nil || got.Size != int64(len("archive")) {
+			t.Errorf("archive %+v after rerun, error %v", got, err)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package fakehcloud
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+	"github.com/samber/lo"
+)
+
+// inAddress reports whether ip is the address or in the network addr.
+func inAddress(addr string, ip string) bool {
+	parsed, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	if !strings.Contains(addr, "/") {
+		return addr == parsed.String()
+	}
+	prefix, err := netip.ParsePrefix(addr)
+	return err == nil && prefix.Contains(parsed)
+}
+
+// setPrimaryIPDNSPtr sets the reverse dns of ip on the primary ip and the
+// server it is assigned to. An empty ptr removes the entry.
+func (f *Fake) setPrimaryIPDNSPtr(pIP *schema.PrimaryIP, ip string, ptr string) {
+	var ptrs []schema.PrimaryIPDNSPTR
+	for _, entry := range pIP.DNSPtr {
+		if entry.IP != ip {
+			ptrs = append(ptrs, entry)
+		}
+	}
+	if len(ptr) > 0 {
+		ptrs = append(ptrs, schema.PrimaryIPDNSPTR{IP: ip, DNSPtr: ptr})
+	}
+	pIP.DNSPtr = append([]schema.PrimaryIPDNSPTR{}, ptrs...)
+	if svr, ok := f.servers[pIP.AssigneeID]; ok {
+		f.assignPrimaryIPTo(pIP, svr)
+	}
+}
+
+func (f *Fake) changeServerDNSPtr(w http.ResponseWriter, r *http.Request, id int64) {
+	svr, ok := f.servers[id]
+	if !ok {
+		writeNotFound(w, "server")
+		return
+	}
+	var req schema.ServerActionChangeDNSPtrRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	for _, pIPID := range []int64{svr.PublicNet.IPv4.ID, svr.PublicNet.IPv6.ID} {
+		pIP, ok := f.primaryIPs[pIPID]
+		if ok && inAddress(pIP.IP, req.IP) {
+			f.setPrimaryIPDNSPtr(pIP, req.IP, lo.FromPtr(req.DNSPtr))
+			writeJSON(w, http.StatusCreated, map[string]any{"action": f.newAction("change_dns_ptr", "server", id)})
+			return
+		}
+	}
+	writeError(w, http.StatusUnprocessableEntity, hcloud.ErrorCodeInvalidInput, "ip does not belong to the server")
+}
+
+func (f *Fake) changeFloatingIPDNSPtr(w http.ResponseWriter, r *http.Request, id int64) {
+	fIP, ok := f.floatingIPs[id]
+	if !ok {
+		writeNotFound(w, "floating ip")
+		return
+	}
+	var req schema.FloatingIPActionChangeDNSPtrRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if !inAddress(fIP.IP, req.IP) {
+		writeError(w, http.StatusUnprocessableEntity, hcloud.ErrorCodeInvalidInput, "ip does not belong to the floating ip")
+		return
+	}
+	ptrs := []schema.FloatingIPDNSPtr{}
+	for _, entry := range fIP.DNSPtr {
+		if entry.IP != req.IP {
+			ptrs = append(ptrs, entry)
+		}
+	}
+	if ptr := lo.FromPtr(req.DNSPtr); len(ptr) > 0 {
+		ptrs = append(ptrs, schema.FloatingIPDNSPtr{IP: req.IP, DNSPtr: ptr})
+	}
+	fIP.DNSPtr = ptrs
+	writeJSON(w, http.StatusCreated, map[string]any{"action": f.newAction("change_dns_ptr", "floating_ip", id)})
+}
@@ -0,0 +1,316 @@
+// Package fakehcloud is an in-process fake of the parts of the Hetzner Cloud
+// API the freezer uses. It keeps its state in memory, lets tests inject
+// failures and controls how fast actions progress.
+package fakehcloud
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+)
+
+type handler func(w http.ResponseWriter, r *http.Request, id int64)
+
+type route struct {
+	method  string
+	pattern []string
+	handle  handler
+}
+
+type failure struct {
+	method  string
+	pattern string
+	times   int
+	code    hcloud.ErrorCode
+}
+
+type action struct {
+	schema.Action
+	polls int
+	fail  bool
+	// done is called when the action succeeds
+	done func()
+}
+
+// Fake is a fake Hetzner Cloud API server.
+type Fake struct {
+	// ActionPolls is the number of times an action has to be polled before
+	// it finishes. Actions finish immediately if it is zero.
+	ActionPolls int
+
+	mu              sync.Mutex
+	srv             *httptest.Server
+	routes          []route
+	nextID          int64
+	failures        []*failure
+	actionFailures  map[string]int
+	requests        []string
+	actions         map[int64]*action
+	servers         map[int64]*schema.Server
+	userData        map[int64]string
+	serverSSHKeys   map[int64][]int64
+	serverLoads     map[int64]serverLoad
+	images          map[int64]*schema.Image
+	floatingIPs     map[int64]*schema.FloatingIP
+	primaryIPs      map[int64]*schema.PrimaryIP
+	sshKeys         map[int64]*schema.SSHKey
+	volumes         map[int64]*volume
+	networks        map[int64]*schema.Network
+	firewalls       map[int64]*schema.Firewall
+	placementGroups map[int64]*schema.PlacementGroup
+	datacenters     map[int64]*schema.Datacenter
+	serverTypes     map[int64]*schema.ServerType
+}
+
+// New starts a fake with a single location, datacenter and a few server
+// types.
+func New() *Fake {
+	f := &Fake{
+		nextID:          1000,
+		actionFailures:  make(map[string]int),
+		actions:         make(map[int64]*action),
+		servers:         make(map[int64]*schema.Server),
+		userData:        make(map[int64]string),
+		serverSSHKeys:   make(map[int64][]int64),
+		serverLoads:     make(map[int64]serverLoad),
+		images:          make(map[int64]*schema.Image),
+		floatingIPs:     make(map[int64]*schema.FloatingIP),
+		primaryIPs:      make(map[int64]*schema.PrimaryIP),
+		sshKeys:         make(map[int64]*schema.SSHKey),
+		volumes:         make(map[int64]*volume),
+		networks:        make(map[int64]*schema.Network),
+		firewalls:       make(map[int64]*schema.Firewall),
+		placementGroups: make(map[int64]*schema.PlacementGroup),
+		datacenters:     make(map[int64]*schema.Datacenter),
+		serverTypes:     make(map[int64]*schema.ServerType),
+	}
+	f.seed()
+	f.registerRoutes()
+	f.srv = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	return f
+}
+
+// URL is the endpoint to pass to hcloud.WithEndpoint.
+func (f *Fake) URL() string {
+	return f.srv.URL
+}
+
+// Client returns a client talking to the fake.
+func (f *Fake) Client() *hcloud.Client {
+	return hcloud.NewClient(
+		hcloud.WithEndpoint(f.URL()),
+		hcloud.WithToken("fake"),
+		hcloud.WithBackoffFunc(func(_ int) time.Duration { return 0 }),
+		hcloud.WithPollBackoffFunc(func(_ int) time.Duration { return 0 }),
+	)
+}
+
+func (f *Fake) Close() {
+	f.srv.Close()
+}
+
+// Fail makes the next times requests matching method and pattern fail with
+// code. Patterns use {id} for ids, e.g. "POST /primary_ips/{id}/actions/unassign".
+func (f *Fake) Fail(method, pattern string, times int, code hcloud.ErrorCode) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = append(f.failures, &failure{method: method, pattern: pattern, times: times, code: code})
+}
+
+// FailAction makes the next times actions with the command, e.g.
+// "create_image", end with an error status.
+func (f *Fake) FailAction(command string, times int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.actionFailures[command] = times
+}
+
+// Requests returns the method and path of every request served so far.
+func (f *Fake) Requests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+func (f *Fake) register(method, pattern string, h handler) {
+	f.routes = append(f.routes, route{method: method, pattern: strings.Split(strings.Trim(pattern, "/"), "/"), handle: h})
+}
+
+func (f *Fake) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	for _, rt := range f.routes {
+		if rt.method != r.Method {
+			continue
+		}
+		id, ok := match(rt.pattern, segments)
+		if !ok {
+			continue
+		}
+		if f.injectedFailure(w, r.Method, strings.Join(rt.pattern, "/")) {
+			return
+		}
+		rt.handle(w, r, id)
+		return
+	}
+	writeError(w, http.StatusNotFound, hcloud.ErrorCodeNotFound, "no such endpoint")
+}
+
+func match(pattern, segments []string) (int64, bool) {
+	if len(pattern) != len(segments) {
+		return 0, false
+	}
+	var id int64
+	for i, p := range pattern {
+		if p == "{id}" {
+			n, err := strconv.ParseInt(segments[i], 10, 64)
+			if err != nil {
+				return 0, false
+			}
+			id = n
+			continue
+		}
+		if p != segments[i] {
+			return 0, false
+		}
+	}
+	return id, true
+}
+
+func (f *Fake) injectedFailure(w http.ResponseWriter, method, pattern string) bool {
+	for _, fail := range f.failures {
+		if fail.times == 0 || fail.method != method || strings.Trim(fail.pattern, "/") != pattern {
+			continue
+		}
+		fail.times--
+		writeError(w, http.StatusUnprocessableEntity, fail.code, "injected failure")
+		return true
+	}
+	return false
+}
+
+func (f *Fake) newID() int64 {
+	f.nextID++
+	return f.nextID
+}
+
+// newAction starts an action for the resource. It finishes after
+// ActionPolls polls.
+func (f *Fake) newAction(command string, resourceType string, resourceID int64) schema.Action {
+	return f.newActionThen(command, resourceType, resourceID, nil)
+}
+
+// newActionThen is newAction with done called once the action succeeds.
+func (f *Fake) newActionThen(command string, resourceType string, resourceID int64, done func()) schema.Action {
+	a := &action{
+		Action: schema.Action{
+			ID:        f.newID(),
+			Command:   command,
+			Status:    string(hcloud.ActionStatusRunning),
+			Started:   time.Now(),
+			Resources: []schema.ActionResourceReference{{ID: resourceID, Type: resourceType}},
+		},
+		done: done,
+	}
+	if n := f.actionFailures[command]; n > 0 {
+		f.actionFailures[command] = n - 1
+		a.fail = true
+	}
+	f.actions[a.ID] = a
+	if f.ActionPolls == 0 {
+		f.progress(a)
+	}
+	return a.Action
+}
+
+func (f *Fake) progress(a *action) {
+	a.polls++
+	if a.polls < f.ActionPolls {
+		a.Progress = a.polls * 100 / f.ActionPolls
+		return
+	}
+	now := time.Now()
+	a.Finished = &now
+	if a.fail {
+		a.Status = string(hcloud.ActionStatusError)
+		a.Error = &schema.ActionError{Code: "action_failed", Message: "injected action failure"}
+		return
+	}
+	a.Status = string(hcloud.ActionStatusSuccess)
+	a.Progress = 100
+	if a.done != nil {
+		a.done()
+	}
+}
+
+func (f *Fake) getAction(w http.ResponseWriter, _ *http.Request, id int64) {
+	a, ok := f.actions[id]
+	if !ok {
+		writeNotFound(w, "action")
+		return
+	}
+	if a.Status == string(hcloud.ActionStatusRunning) {
+		f.progress(a)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"action": a.Action})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeList writes a single page list response.
+func writeList(w http.ResponseWriter, key string, items any) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		key: items,
+		"meta": schema.Meta{Pagination: &schema.MetaPagination{
+			Page:     1,
+			PerPage:  50,
+			LastPage: 1,
+		}},
+	})
+}
+
+func writeError(w http.ResponseWriter, status int, code hcloud.ErrorCode, message string) {
+	writeJSON(w, status, schema.ErrorResponse{Error: schema.Error{Code: string(code), Message: message}})
+}
+
+func writeNotFound(w http.ResponseWriter, resource string) {
+	writeError(w, http.StatusNotFound, hcloud.ErrorCodeNotFound, fmt.Sprintf("%s not found", resource))
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, target any) bool {
+	if err := json.NewDecoder(r.Body).Decode(target); err != nil {
+		writeError(w, http.StatusBadRequest, hcloud.ErrorCodeInvalidInput, err.Error())
+		return false
+	}
+	return true
+}
+
+// matchesLabels reports whether labels match a selector of comma separated
+// "key=value" and "key" terms.
+func matchesLabels(labels map[string]string, selector string) bool {
+	if len(selector) == 0 {
+		return true
+	}
+	for _, term := range strings.Split(selector, ",") {
+		key, value, hasValue := strings.Cut(strings.TrimSpace(term), "=")
+		actual, ok := labels[key]
+		if !ok || (hasValue && actual != value) {
+			return false
+		}
+	}
+	return true
+}
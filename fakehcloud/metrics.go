@@ -0,0 +1,83 @@
+package fakehcloud
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+)
+
+// serverLoad is the constant load the metrics of a server report.
+type serverLoad struct {
+	cpu       float64
+	bandwidth float64
+}
+
+// SetServerLoad makes the metrics of the server report the cpu usage in
+// percent and the bandwidth in bytes per second, in and out each, over any
+// period. Servers report no load by default.
+func (f *Fake) SetServerLoad(name string, cpu, bandwidth float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.serverLoads[f.serverByName(name).ID] = serverLoad{cpu: cpu, bandwidth: bandwidth}
+}
+
+// SetServerCreated changes when the server was created.
+func (f *Fake) SetServerCreated(name string, created time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.serverByName(name).Created = created
+}
+
+func (f *Fake) getServerMetrics(w http.ResponseWriter, r *http.Request, id int64) {
+	if _, ok := f.servers[id]; !ok {
+		writeNotFound(w, "server")
+		return
+	}
+	query := r.URL.Query()
+	start, err := time.Parse(time.RFC3339, query.Get("start"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, hcloud.ErrorCodeInvalidInput, "invalid start")
+		return
+	}
+	end, err := time.Parse(time.RFC3339, query.Get("end"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, hcloud.ErrorCodeInvalidInput, "invalid end")
+		return
+	}
+	step := 60
+	if s := query.Get("step"); len(s) > 0 {
+		if step, err = strconv.Atoi(s); err != nil || step <= 0 {
+			writeError(w, http.StatusBadRequest, hcloud.ErrorCodeInvalidInput, "invalid step")
+			return
+		}
+	}
+	load := f.serverLoads[id]
+	series := func(value float64) schema.ServerTimeSeriesVals {
+		var values []interface{}
+		for t := start; !t.After(end); t = t.Add(time.Duration(step) * time.Second) {
+			values = append(values, []interface{}{float64(t.Unix()), strconv.FormatFloat(value, 'f', -1, 64)})
+		}
+		return schema.ServerTimeSeriesVals{Values: values}
+	}
+	var resp schema.ServerGetMetricsResponse
+	resp.Metrics.Start = start
+	resp.Metrics.End = end
+	resp.Metrics.Step = float64(step)
+	resp.Metrics.TimeSeries = map[string]schema.ServerTimeSeriesVals{}
+	for _, typ := range query["type"] {
+		switch hcloud.ServerMetricType(typ) {
+		case hcloud.ServerMetricCPU:
+			resp.Metrics.TimeSeries["cpu"] = series(load.cpu)
+		case hcloud.ServerMetricNetwork:
+			resp.Metrics.TimeSeries["network.0.bandwidth.in"] = series(load.bandwidth)
+			resp.Metrics.TimeSeries["network.0.bandwidth.out"] = series(load.bandwidth)
+		default:
+			writeError(w, http.StatusBadRequest, hcloud.ErrorCodeInvalidInput, "unsupported metric type")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,48 @@
+package fakehcloud
+
+import (
+	"net/http"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+)
+
+// Net monthly prices of the fake in the location of its datacenter, gross
+// prices add VAT.
+const (
+	ImagePricePerGB      = "0.0119"
+	VolumePricePerGB     = "0.0440"
+	PrimaryIPv4Price     = "0.5000"
+	FloatingIPv4Price    = "3.0000"
+	FloatingIPv6Price    = "1.0000"
+	BackupPricePercent   = "20"
+	pricingCurrency      = "EUR"
+	pricingVATPercentage = "19.00"
+)
+
+func price(net string) schema.Price {
+	return schema.Price{Net: net, Gross: withVAT(net)}
+}
+
+func (f *Fake) getPricing(w http.ResponseWriter, _ *http.Request, _ int64) {
+	location := f.datacenters[DatacenterID].Location.Name
+	pricing := schema.Pricing{
+		Currency:     pricingCurrency,
+		VATRate:      pricingVATPercentage,
+		Image:        schema.PricingImage{PricePerGBMonth: price(ImagePricePerGB)},
+		Volume:       schema.PricingVolume{PricePerGBPerMonth: price(VolumePricePerGB)},
+		ServerBackup: schema.PricingServerBackup{Percentage: BackupPricePercent},
+		PrimaryIPs: []schema.PricingPrimaryIP{
+			{Type: "ipv4", Prices: []schema.PricingPrimaryIPTypePrice{{Location: location, PriceMonthly: price(PrimaryIPv4Price)}}},
+			{Type: "ipv6", Prices: []schema.PricingPrimaryIPTypePrice{{Location: location, PriceMonthly: price("0.0000")}}},
+		},
+		FloatingIPs: []schema.PricingFloatingIPType{
+			{Type: "ipv4", Prices: []schema.PricingFloatingIPTypePrice{{Location: location, PriceMonthly: price(FloatingIPv4Price)}}},
+			{Type: "ipv6", Prices: []schema.PricingFloatingIPTypePrice{{Location: location, PriceMonthly: price(FloatingIPv6Price)}}},
+		},
+	}
+	for _, id := range f.serverTypeIDs() {
+		st := f.serverTypes[id]
+		pricing.ServerTypes = append(pricing.ServerTypes, schema.PricingServerType{ID: st.ID, Name: st.Name, Prices: st.Prices})
+	}
+	writeJSON(w, http.StatusOK, schema.PricingGetResponse{Pricing: pricing})
+}
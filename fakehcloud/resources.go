@@ -0,0 +1,672 @@
+package fakehcloud
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+	"github.com/samber/lo"
+)
+
+// AddFloatingIP adds a floating ip, assigned to the server unless serverID
+// is zero. IPv6 floating ips are given as their /64 network.
+func (f *Fake) AddFloatingIP(ip string, serverID int64) schema.FloatingIP {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	typ := "ipv4"
+	if strings.Contains(ip, ":") {
+		typ = "ipv6"
+	}
+	fIP := &schema.FloatingIP{
+		ID:           f.newID(),
+		IP:           ip,
+		Type:         typ,
+		Name:         ip,
+		Created:      time.Now(),
+		HomeLocation: f.datacenters[DatacenterID].Location,
+		DNSPtr:       []schema.FloatingIPDNSPtr{},
+		Labels:       map[string]string{},
+	}
+	f.floatingIPs[fIP.ID] = fIP
+	if serverID != 0 {
+		f.assignFloatingIPTo(fIP, f.servers[serverID])
+	}
+	return *fIP
+}
+
+// FloatingIP returns the floating ip with the id or nil if there is none.
+func (f *Fake) FloatingIP(id int64) *schema.FloatingIP {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return copyOf(f.floatingIPs[id])
+}
+
+// PrimaryIP returns the primary ip with the id or nil if there is none.
+func (f *Fake) PrimaryIP(id int64) *schema.PrimaryIP {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return copyOf(f.primaryIPs[id])
+}
+
+// Image returns the image with the id or nil if there is none.
+func (f *Fake) Image(id int64) *schema.Image {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return copyOf(f.images[id])
+}
+
+// Images returns every image, e.g. to check that snapshots were cleaned up.
+func (f *Fake) Images() []schema.Image {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var images []schema.Image
+	for _, img := range sortedByID(f.images) {
+		images = append(images, *img)
+	}
+	return images
+}
+
+// AddImage adds a system image, e.g. the image a server is created from in
+// a project without the snapshot.
+func (f *Fake) AddImage(name string, diskSize float32) schema.Image {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	img := &schema.Image{
+		ID:           f.newID(),
+		Name:         &name,
+		Status:       string(hcloud.ImageStatusAvailable),
+		Type:         string(hcloud.ImageTypeSystem),
+		Description:  name,
+		DiskSize:     diskSize,
+		Created:      &now,
+		OSFlavor:     "ubuntu",
+		Architecture: string(hcloud.ArchitectureX86),
+		Labels:       map[string]string{},
+	}
+	f.images[img.ID] = img
+	return *img
+}
+
+// DeleteImage removes the image, as if it was deleted in the console.
+func (f *Fake) DeleteImage(id int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.images, id)
+}
+
+// AddSSHKey adds an ssh key to the project.
+func (f *Fake) AddSSHKey(name string) schema.SSHKey {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := &schema.SSHKey{
+		ID:          f.newID(),
+		Name:        name,
+		Fingerprint: fmt.Sprintf("fa:ke:%d", f.nextID),
+		PublicKey:   fmt.Sprintf("ssh-ed25519 AAAAfake%d %s", f.nextID, name),
+		Labels:      map[string]string{},
+		Created:     time.Now(),
+	}
+	f.sshKeys[key.ID] = key
+	return *key
+}
+
+// SetSSHKeyLabels replaces the labels of the ssh key.
+func (f *Fake) SetSSHKeyLabels(id int64, labels map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sshKeys[id].Labels = labels
+}
+
+// DeleteSSHKey removes the ssh key from the project.
+func (f *Fake) DeleteSSHKey(id int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.sshKeys, id)
+}
+
+// DeleteNetwork removes the network, as if it was deleted while the server
+// was frozen.
+func (f *Fake) DeleteNetwork(id int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.networks, id)
+}
+
+// DeleteFirewall removes the firewall.
+func (f *Fake) DeleteFirewall(id int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.firewalls, id)
+}
+
+// DeletePlacementGroup removes the placement group.
+func (f *Fake) DeletePlacementGroup(id int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.placementGroups, id)
+}
+
+// Firewall returns the firewall with the name or nil if there is none.
+func (f *Fake) Firewall(name string) *schema.Firewall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, fw := range f.firewalls {
+		if fw.Name == name {
+			return copyOf(fw)
+		}
+	}
+	return nil
+}
+
+// Network returns the network with the name or nil if there is none.
+func (f *Fake) Network(name string) *schema.Network {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, network := range f.networks {
+		if network.Name == name {
+			return copyOf(network)
+		}
+	}
+	return nil
+}
+
+// AddNetwork adds a private network with a single cloud subnet.
+func (f *Fake) AddNetwork(name string, ipRange string) schema.Network {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	network := &schema.Network{
+		ID:      f.newID(),
+		Name:    name,
+		Created: time.Now(),
+		IPRange: ipRange,
+		Subnets: []schema.NetworkSubnet{{
+			Type:        "cloud",
+			IPRange:     ipRange,
+			NetworkZone: f.datacenters[DatacenterID].Location.NetworkZone,
+		}},
+		Routes:  []schema.NetworkRoute{},
+		Servers: []int64{},
+		Labels:  map[string]string{},
+	}
+	f.networks[network.ID] = network
+	return *network
+}
+
+// AddFirewall adds an empty firewall.
+func (f *Fake) AddFirewall(name string) schema.Firewall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fw := &schema.Firewall{
+		ID:        f.newID(),
+		Name:      name,
+		Labels:    map[string]string{},
+		Created:   time.Now(),
+		Rules:     []schema.FirewallRule{},
+		AppliedTo: []schema.FirewallResource{},
+	}
+	f.firewalls[fw.ID] = fw
+	return *fw
+}
+
+// AddPlacementGroup adds a spread placement group.
+func (f *Fake) AddPlacementGroup(name string) schema.PlacementGroup {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pg := &schema.PlacementGroup{
+		ID:      f.newID(),
+		Name:    name,
+		Labels:  map[string]string{},
+		Created: time.Now(),
+		Servers: []int64{},
+		Type:    string(hcloud.PlacementGroupTypeSpread),
+	}
+	f.placementGroups[pg.ID] = pg
+	return *pg
+}
+
+// newPrimaryIP creates an unassigned primary ip in the datacenter.
+func (f *Fake) newPrimaryIP(ipType string, dc schema.Datacenter) *schema.PrimaryIP {
+	id := f.newID()
+	ip := fmt.Sprintf("203.0.113.%d", id%250+1)
+	if ipType == "ipv6" {
+		ip = fmt.Sprintf("2001:db8:%x::/64", id)
+	}
+	pIP := &schema.PrimaryIP{
+		ID:           id,
+		IP:           ip,
+		Labels:       map[string]string{},
+		Name:         fmt.Sprintf("primary-%s-%d", ipType, id),
+		Type:         ipType,
+		DNSPtr:       []schema.PrimaryIPDNSPTR{},
+		AssigneeType: "server",
+		Created:      time.Now(),
+		Datacenter:   dc,
+	}
+	f.primaryIPs[pIP.ID] = pIP
+	return pIP
+}
+
+func (f *Fake) assignPrimaryIPTo(pIP *schema.PrimaryIP, svr *schema.Server) {
+	pIP.AssigneeID = svr.ID
+	pIP.AssigneeType = "server"
+	if pIP.Type == "ipv6" {
+		ptrs := []schema.ServerPublicNetIPv6DNSPtr{}
+		for _, entry := range pIP.DNSPtr {
+			ptrs = append(ptrs, schema.ServerPublicNetIPv6DNSPtr{IP: entry.IP, DNSPtr: entry.DNSPtr})
+		}
+		svr.PublicNet.IPv6 = schema.ServerPublicNetIPv6{ID: pIP.ID, IP: pIP.IP, DNSPtr: ptrs}
+		return
+	}
+	svr.PublicNet.IPv4 = schema.ServerPublicNetIPv4{ID: pIP.ID, IP: pIP.IP}
+	for _, entry := range pIP.DNSPtr {
+		svr.PublicNet.IPv4.DNSPtr = entry.DNSPtr
+	}
+}
+
+func (f *Fake) unassignPrimaryIPFrom(pIP *schema.PrimaryIP) {
+	if svr, ok := f.servers[pIP.AssigneeID]; ok {
+		if svr.PublicNet.IPv4.ID == pIP.ID {
+			svr.PublicNet.IPv4 = schema.ServerPublicNetIPv4{}
+		}
+		if svr.PublicNet.IPv6.ID == pIP.ID {
+			svr.PublicNet.IPv6 = schema.ServerPublicNetIPv6{}
+		}
+	}
+	pIP.AssigneeID = 0
+}
+
+func (f *Fake) assignFloatingIPTo(fIP *schema.FloatingIP, svr *schema.Server) {
+	f.unassignFloatingIPFrom(fIP)
+	fIP.Server = &svr.ID
+	svr.PublicNet.FloatingIPs = append(svr.PublicNet.FloatingIPs, fIP.ID)
+}
+
+func (f *Fake) unassignFloatingIPFrom(fIP *schema.FloatingIP) {
+	if fIP.Server == nil {
+		return
+	}
+	if svr, ok := f.servers[*fIP.Server]; ok {
+		svr.PublicNet.FloatingIPs = without(svr.PublicNet.FloatingIPs, fIP.ID)
+	}
+	fIP.Server = nil
+}
+
+// nextNetworkIP returns an unused ip of the first subnet of the network.
+func (f *Fake) nextNetworkIP(networkID int64) string {
+	network, ok := f.networks[networkID]
+	if !ok {
+		return ""
+	}
+	prefix, err := netip.ParsePrefix(network.IPRange)
+	if err != nil {
+		return ""
+	}
+	used := map[string]bool{}
+	for _, svr := range f.servers {
+		for _, pNet := range svr.PrivateNet {
+			used[pNet.IP] = true
+		}
+	}
+	// the first address of a network is reserved for the gateway
+	ip := prefix.Addr().Next().Next()
+	for used[ip.String()] {
+		ip = ip.Next()
+	}
+	return ip.String()
+}
+
+func (f *Fake) listImages(w http.ResponseWriter, r *http.Request, _ int64) {
+	images := filterByName(f.images, r, func(img *schema.Image) string {
+		if img.Name == nil {
+			return ""
+		}
+		return *img.Name
+	})
+	if selector := r.URL.Query().Get("label_selector"); len(selector) > 0 {
+		images = lo.Filter(images, func(img schema.Image, _ int) bool { return matchesLabels(img.Labels, selector) })
+	}
+	if types := r.URL.Query()["type"]; len(types) > 0 {
+		images = lo.Filter(images, func(img schema.Image, _ int) bool { return lo.Contains(types, img.Type) })
+	}
+	writeList(w, "images", images)
+}
+
+func (f *Fake) getImage(w http.ResponseWriter, _ *http.Request, id int64) {
+	writeResource(w, "image", f.images, id)
+}
+
+func (f *Fake) deleteImage(w http.ResponseWriter, _ *http.Request, id int64) {
+	if _, ok := f.images[id]; !ok {
+		writeNotFound(w, "image")
+		return
+	}
+	delete(f.images, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *Fake) listFloatingIPs(w http.ResponseWriter, r *http.Request, _ int64) {
+	writeList(w, "floating_ips", filterByName(f.floatingIPs, r, func(fIP *schema.FloatingIP) string { return fIP.Name }))
+}
+
+func (f *Fake) getFloatingIP(w http.ResponseWriter, _ *http.Request, id int64) {
+	writeResource(w, "floating_ip", f.floatingIPs, id)
+}
+
+func (f *Fake) assignFloatingIP(w http.ResponseWriter, r *http.Request, id int64) {
+	fIP, ok := f.floatingIPs[id]
+	if !ok {
+		writeNotFound(w, "floating ip")
+		return
+	}
+	var req schema.FloatingIPActionAssignRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	svr, ok := f.servers[req.Server]
+	if !ok {
+		writeNotFound(w, "server")
+		return
+	}
+	f.assignFloatingIPTo(fIP, svr)
+	writeJSON(w, http.StatusCreated, map[string]any{"action": f.newAction("assign_floating_ip", "floating_ip", id)})
+}
+
+func (f *Fake) unassignFloatingIP(w http.ResponseWriter, _ *http.Request, id int64) {
+	fIP, ok := f.floatingIPs[id]
+	if !ok {
+		writeNotFound(w, "floating ip")
+		return
+	}
+	f.unassignFloatingIPFrom(fIP)
+	writeJSON(w, http.StatusCreated, map[string]any{"action": f.newAction("unassign_floating_ip", "floating_ip", id)})
+}
+
+func (f *Fake) listPrimaryIPs(w http.ResponseWriter, r *http.Request, _ int64) {
+	writeList(w, "primary_ips", filterByName(f.primaryIPs, r, func(pIP *schema.PrimaryIP) string { return pIP.Name }))
+}
+
+func (f *Fake) getPrimaryIP(w http.ResponseWriter, _ *http.Request, id int64) {
+	writeResource(w, "primary_ip", f.primaryIPs, id)
+}
+
+// assignPrimaryIP and unassignPrimaryIP require the server to be powered off,
+// like the real api does.
+func (f *Fake) assignPrimaryIP(w http.ResponseWriter, r *http.Request, id int64) {
+	pIP, ok := f.primaryIPs[id]
+	if !ok {
+		writeNotFound(w, "primary ip")
+		return
+	}
+	var req hcloud.PrimaryIPAssignOpts
+	if !readJSON(w, r, &req) {
+		return
+	}
+	svr, ok := f.servers[req.AssigneeID]
+	if !ok {
+		writeNotFound(w, "server")
+		return
+	}
+	if svr.Status != string(hcloud.ServerStatusOff) {
+		writeError(w, http.StatusUnprocessableEntity, hcloud.ErrorCodeServerNotStopped, "server must be powered off")
+		return
+	}
+	if pIP.AssigneeID != 0 {
+		writeError(w, http.StatusUnprocessableEntity, hcloud.ErrorCodeInvalidInput, "primary ip is already assigned")
+		return
+	}
+	f.assignPrimaryIPTo(pIP, svr)
+	writeJSON(w, http.StatusCreated, map[string]any{"action": f.newAction("assign_primary_ip", "primary_ip", id)})
+}
+
+func (f *Fake) unassignPrimaryIP(w http.ResponseWriter, _ *http.Request, id int64) {
+	pIP, ok := f.primaryIPs[id]
+	if !ok {
+		writeNotFound(w, "primary ip")
+		return
+	}
+	if svr, ok := f.servers[pIP.AssigneeID]; ok && svr.Status != string(hcloud.ServerStatusOff) {
+		writeError(w, http.StatusUnprocessableEntity, hcloud.ErrorCodeServerNotStopped, "server must be powered off")
+		return
+	}
+	f.unassignPrimaryIPFrom(pIP)
+	writeJSON(w, http.StatusCreated, map[string]any{"action": f.newAction("unassign_primary_ip", "primary_ip", id)})
+}
+
+func (f *Fake) deletePrimaryIP(w http.ResponseWriter, _ *http.Request, id int64) {
+	pIP, ok := f.primaryIPs[id]
+	if !ok {
+		writeNotFound(w, "primary ip")
+		return
+	}
+	if pIP.AssigneeID != 0 {
+		writeError(w, http.StatusUnprocessableEntity, hcloud.ErrorCodeInvalidInput, "primary ip is assigned")
+		return
+	}
+	delete(f.primaryIPs, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *Fake) listSSHKeys(w http.ResponseWriter, r *http.Request, _ int64) {
+	keys := filterByName(f.sshKeys, r, func(key *schema.SSHKey) string { return key.Name })
+	if fingerprint := r.URL.Query().Get("fingerprint"); len(fingerprint) > 0 {
+		keys = lo.Filter(keys, func(key schema.SSHKey, _ int) bool { return key.Fingerprint == fingerprint })
+	}
+	if selector := r.URL.Query().Get("label_selector"); len(selector) > 0 {
+		keys = lo.Filter(keys, func(key schema.SSHKey, _ int) bool { return matchesLabels(key.Labels, selector) })
+	}
+	writeList(w, "ssh_keys", keys)
+}
+
+func (f *Fake) getSSHKey(w http.ResponseWriter, _ *http.Request, id int64) {
+	writeResource(w, "ssh_key", f.sshKeys, id)
+}
+
+func (f *Fake) createSSHKey(w http.ResponseWriter, r *http.Request, _ int64) {
+	var req schema.SSHKeyCreateRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	for _, key := range f.sshKeys {
+		if key.Name == req.Name || key.PublicKey == req.PublicKey {
+			writeError(w, http.StatusConflict, hcloud.ErrorCodeUniquenessError, "SSH key with the same name or public key already exists")
+			return
+		}
+	}
+	key := &schema.SSHKey{
+		ID:          f.newID(),
+		Name:        req.Name,
+		Fingerprint: fmt.Sprintf("fa:ke:%d", f.nextID),
+		PublicKey:   req.PublicKey,
+		Labels:      map[string]string{},
+		Created:     time.Now(),
+	}
+	if req.Labels != nil {
+		key.Labels = *req.Labels
+	}
+	f.sshKeys[key.ID] = key
+	writeJSON(w, http.StatusCreated, map[string]any{"ssh_key": key})
+}
+
+func (f *Fake) listNetworks(w http.ResponseWriter, r *http.Request, _ int64) {
+	writeList(w, "networks", filterByName(f.networks, r, func(network *schema.Network) string { return network.Name }))
+}
+
+func (f *Fake) getNetwork(w http.ResponseWriter, _ *http.Request, id int64) {
+	writeResource(w, "network", f.networks, id)
+}
+
+func (f *Fake) createNetwork(w http.ResponseWriter, r *http.Request, _ int64) {
+	var req schema.NetworkCreateRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	for _, network := range f.networks {
+		if network.Name == req.Name {
+			writeError(w, http.StatusConflict, hcloud.ErrorCodeUniquenessError, "network with the same name already exists")
+			return
+		}
+	}
+	network := &schema.Network{
+		ID:                    f.newID(),
+		Name:                  req.Name,
+		Created:               time.Now(),
+		IPRange:               req.IPRange,
+		Subnets:               append([]schema.NetworkSubnet{}, req.Subnets...),
+		Routes:                append([]schema.NetworkRoute{}, req.Routes...),
+		Servers:               []int64{},
+		Labels:                map[string]string{},
+		ExposeRoutesToVSwitch: req.ExposeRoutesToVSwitch,
+	}
+	if req.Labels != nil {
+		network.Labels = *req.Labels
+	}
+	f.networks[network.ID] = network
+	writeJSON(w, http.StatusCreated, map[string]any{"network": network})
+}
+
+func (f *Fake) listFirewalls(w http.ResponseWriter, r *http.Request, _ int64) {
+	writeList(w, "firewalls", filterByName(f.firewalls, r, func(fw *schema.Firewall) string { return fw.Name }))
+}
+
+func (f *Fake) getFirewall(w http.ResponseWriter, _ *http.Request, id int64) {
+	writeResource(w, "firewall", f.firewalls, id)
+}
+
+func (f *Fake) createFirewall(w http.ResponseWriter, r *http.Request, _ int64) {
+	var req schema.FirewallCreateRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	for _, fw := range f.firewalls {
+		if fw.Name == req.Name {
+			writeError(w, http.StatusConflict, hcloud.ErrorCodeUniquenessError, "firewall with the same name already exists")
+			return
+		}
+	}
+	fw := &schema.Firewall{
+		ID:        f.newID(),
+		Name:      req.Name,
+		Labels:    map[string]string{},
+		Created:   time.Now(),
+		Rules:     []schema.FirewallRule{},
+		AppliedTo: []schema.FirewallResource{},
+	}
+	if req.Labels != nil {
+		fw.Labels = *req.Labels
+	}
+	for _, rule := range req.Rules {
+		fw.Rules = append(fw.Rules, schema.FirewallRule{
+			Direction:      rule.Direction,
+			SourceIPs:      rule.SourceIPs,
+			DestinationIPs: rule.DestinationIPs,
+			Protocol:       rule.Protocol,
+			Port:           rule.Port,
+			Description:    rule.Description,
+		})
+	}
+	for _, res := range req.ApplyTo {
+		applied := schema.FirewallResource{Type: res.Type, Server: res.Server}
+		if res.LabelSelector != nil {
+			applied.LabelSelector = &schema.FirewallResourceLabelSelector{Selector: res.LabelSelector.Selector}
+		}
+		fw.AppliedTo = append(fw.AppliedTo, applied)
+	}
+	f.firewalls[fw.ID] = fw
+	writeJSON(w, http.StatusCreated, map[string]any{"firewall": fw, "actions": []schema.Action{}})
+}
+
+func (f *Fake) listPlacementGroups(w http.ResponseWriter, r *http.Request, _ int64) {
+	writeList(w, "placement_groups", filterByName(f.placementGroups, r, func(pg *schema.PlacementGroup) string { return pg.Name }))
+}
+
+func (f *Fake) getPlacementGroup(w http.ResponseWriter, _ *http.Request, id int64) {
+	writeResource(w, "placement_group", f.placementGroups, id)
+}
+
+func (f *Fake) createPlacementGroup(w http.ResponseWriter, r *http.Request, _ int64) {
+	var req schema.PlacementGroupCreateRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	for _, pg := range f.placementGroups {
+		if pg.Name == req.Name {
+			writeError(w, http.StatusConflict, hcloud.ErrorCodeUniquenessError, "placement group with the same name already exists")
+			return
+		}
+	}
+	pg := &schema.PlacementGroup{
+		ID:      f.newID(),
+		Name:    req.Name,
+		Labels:  map[string]string{},
+		Created: time.Now(),
+		Servers: []int64{},
+		Type:    req.Type,
+	}
+	if req.Labels != nil {
+		pg.Labels = *req.Labels
+	}
+	f.placementGroups[pg.ID] = pg
+	writeJSON(w, http.StatusCreated, map[string]any{"placement_group": pg})
+}
+
+// writeResource writes the resource with the id under key, or a not_found
+// error.
+func writeResource[T any](w http.ResponseWriter, key string, items map[int64]*T, id int64) {
+	item, ok := items[id]
+	if !ok {
+		writeNotFound(w, key)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{key: item})
+}
+
+// filterByName returns the items ordered by id, only the ones with the name
+// given in the query if there is one.
+func filterByName[T any](items map[int64]*T, r *http.Request, name func(*T) string) []T {
+	want := r.URL.Query().Get("name")
+	filtered := []T{}
+	for _, item := range sortedByID(items) {
+		if len(want) > 0 && name(item) != want {
+			continue
+		}
+		filtered = append(filtered, *item)
+	}
+	return filtered
+}
+
+func sortedByID[T any](items map[int64]*T) []*T {
+	ids := make([]int64, 0, len(items))
+	for id := range items {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	sorted := make([]*T, 0, len(ids))
+	for _, id := range ids {
+		sorted = append(sorted, items[id])
+	}
+	return sorted
+}
+
+func copyOf[T any](item *T) *T {
+	if item == nil {
+		return nil
+	}
+	copied := *item
+	return &copied
+}
+
+func without(ids []int64, id int64) []int64 {
+	filtered := []int64{}
+	for _, existing := range ids {
+		if existing != id {
+			filtered = append(filtered, existing)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,641 @@
+package fakehcloud
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+	"github.com/samber/lo"
+)
+
+const (
+	// DatacenterID is the id of the datacenter the fake starts with.
+	DatacenterID int64 = 4
+	// LocationID is the id of the location of that datacenter.
+	LocationID int64 = 1
+)
+
+func (f *Fake) seed() {
+	for _, st := range []schema.ServerType{
+		{ID: 1, Name: "cx11", Cores: 1, Memory: 2, Disk: 20, StorageType: "local", CPUType: "shared", Architecture: "x86", Prices: prices("0.0052", "3.2900")},
+		{ID: 3, Name: "cx21", Cores: 2, Memory: 4, Disk: 40, StorageType: "local", CPUType: "shared", Architecture: "x86", Prices: prices("0.0093", "5.8300")},
+		{ID: 22, Name: "cpx11", Cores: 2, Memory: 2, Disk: 40, StorageType: "local", CPUType: "shared", Architecture: "x86", Prices: prices("0.0070", "4.3500")},
+		{ID: 45, Name: "cax11", Cores: 2, Memory: 4, Disk: 40, StorageType: "local", CPUType: "shared", Architecture: "arm", Prices: prices("0.0060", "3.7900")},
+	} {
+		st := st
+		f.serverTypes[st.ID] = &st
+	}
+	typeIDs := f.serverTypeIDs()
+	f.datacenters[DatacenterID] = &schema.Datacenter{
+		ID:          DatacenterID,
+		Name:        "fsn1-dc14",
+		Description: "Falkenstein 1 virtual DC 14",
+		Location: schema.Location{
+			ID:          LocationID,
+			Name:        "fsn1",
+			Country:     "DE",
+			City:        "Falkenstein",
+			NetworkZone: "eu-central",
+		},
+		ServerTypes: schema.DatacenterServerTypes{
+			Supported:             typeIDs,
+			AvailableForMigration: typeIDs,
+			Available:             typeIDs,
+		},
+	}
+}
+
+// prices returns the net prices of a server type in the location of the
+// fake, gross prices add 19% vat.
+func prices(hourly, monthly string) []schema.PricingServerTypePrice {
+	return []schema.PricingServerTypePrice{{
+		Location:     "fsn1",
+		PriceHourly:  schema.Price{Net: hourly, Gross: withVAT(hourly)},
+		PriceMonthly: schema.Price{Net: monthly, Gross: withVAT(monthly)},
+	}}
+}
+
+// VAT is the vat rate of the gross prices of the fake.
+const VAT = 0.19
+
+func withVAT(net string) string {
+	n, err := strconv.ParseFloat(net, 64)
+	if err != nil {
+		panic(err)
+	}
+	return strconv.FormatFloat(n*(1+VAT), 'f', 4, 64)
+}
+
+// SetServerTypeAvailable makes the server type available or sold out in the
+// datacenter.
+func (f *Fake) SetServerTypeAvailable(name string, available bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	st := f.lookupServerType(name)
+	dc := f.datacenters[DatacenterID]
+	dc.ServerTypes.Available = lo.Without(dc.ServerTypes.Available, st.ID)
+	if available {
+		dc.ServerTypes.Available = append(dc.ServerTypes.Available, st.ID)
+	}
+}
+
+func (f *Fake) serverTypeIDs() []int64 {
+	var ids []int64
+	for id := range f.serverTypes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (f *Fake) registerRoutes() {
+	f.register(http.MethodGet, "/actions/{id}", f.getAction)
+
+	f.register(http.MethodGet, "/servers", f.listServers)
+	f.register(http.MethodPost, "/servers", f.createServer)
+	f.register(http.MethodGet, "/servers/{id}", f.getServer)
+	f.register(http.MethodGet, "/servers/{id}/metrics", f.getServerMetrics)
+	f.register(http.MethodDelete, "/servers/{id}", f.deleteServer)
+	f.register(http.MethodPost, "/servers/{id}/actions/shutdown", f.shutdownServer)
+	f.register(http.MethodPost, "/servers/{id}/actions/poweroff", f.shutdownServer)
+	f.register(http.MethodPost, "/servers/{id}/actions/poweron", f.powerOnServer)
+	f.register(http.MethodPost, "/servers/{id}/actions/create_image", f.createImage)
+	f.register(http.MethodPost, "/servers/{id}/actions/attach_to_network", f.attachToNetwork)
+	f.register(http.MethodPost, "/servers/{id}/actions/change_dns_ptr", f.changeServerDNSPtr)
+	f.register(http.MethodPost, "/servers/{id}/actions/change_protection", f.changeProtection)
+	f.register(http.MethodPost, "/servers/{id}/actions/enable_backup", f.enableBackup)
+
+	f.register(http.MethodGet, "/server_types", f.listServerTypes)
+	f.register(http.MethodGet, "/server_types/{id}", f.getServerType)
+	f.register(http.MethodGet, "/datacenters", f.listDatacenters)
+	f.register(http.MethodGet, "/datacenters/{id}", f.getDatacenter)
+	f.register(http.MethodGet, "/pricing", f.getPricing)
+
+	f.register(http.MethodGet, "/images", f.listImages)
+	f.register(http.MethodGet, "/images/{id}", f.getImage)
+	f.register(http.MethodDelete, "/images/{id}", f.deleteImage)
+
+	f.register(http.MethodGet, "/floating_ips", f.listFloatingIPs)
+	f.register(http.MethodGet, "/floating_ips/{id}", f.getFloatingIP)
+	f.register(http.MethodPost, "/floating_ips/{id}/actions/assign", f.assignFloatingIP)
+	f.register(http.MethodPost, "/floating_ips/{id}/actions/unassign", f.unassignFloatingIP)
+	f.register(http.MethodPost, "/floating_ips/{id}/actions/change_dns_ptr", f.changeFloatingIPDNSPtr)
+
+	f.register(http.MethodGet, "/primary_ips", f.listPrimaryIPs)
+	f.register(http.MethodGet, "/primary_ips/{id}", f.getPrimaryIP)
+	f.register(http.MethodDelete, "/primary_ips/{id}", f.deletePrimaryIP)
+	f.register(http.MethodPost, "/primary_ips/{id}/actions/assign", f.assignPrimaryIP)
+	f.register(http.MethodPost, "/primary_ips/{id}/actions/unassign", f.unassignPrimaryIP)
+
+	f.register(http.MethodGet, "/ssh_keys", f.listSSHKeys)
+	f.register(http.MethodPost, "/ssh_keys", f.createSSHKey)
+	f.register(http.MethodGet, "/ssh_keys/{id}", f.getSSHKey)
+	f.register(http.MethodGet, "/volumes", f.listVolumes)
+	f.register(http.MethodPost, "/volumes", f.createVolume)
+	f.register(http.MethodGet, "/volumes/{id}", f.getVolume)
+	f.register(http.MethodDelete, "/volumes/{id}", f.deleteVolume)
+	f.register(http.MethodPost, "/volumes/{id}/actions/attach", f.attachVolume)
+	f.register(http.MethodPost, "/volumes/{id}/actions/detach", f.detachVolume)
+	f.register(http.MethodGet, "/networks", f.listNetworks)
+	f.register(http.MethodPost, "/networks", f.createNetwork)
+	f.register(http.MethodGet, "/networks/{id}", f.getNetwork)
+	f.register(http.MethodGet, "/firewalls", f.listFirewalls)
+	f.register(http.MethodPost, "/firewalls", f.createFirewall)
+	f.register(http.MethodGet, "/firewalls/{id}", f.getFirewall)
+	f.register(http.MethodGet, "/placement_groups", f.listPlacementGroups)
+	f.register(http.MethodPost, "/placement_groups", f.createPlacementGroup)
+	f.register(http.MethodGet, "/placement_groups/{id}", f.getPlacementGroup)
+}
+
+// AddServer adds a running server of type cx11 with a primary ipv4 and ipv6
+// in the default datacenter.
+func (f *Fake) AddServer(name string, labels map[string]string) schema.Server {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	svr := f.newServer(name, *f.serverTypes[1], *f.datacenters[DatacenterID], labels)
+	f.assignNewPrimaryIPs(svr, true, true)
+	return *svr
+}
+
+// Server returns the server with the name or nil if there is none.
+func (f *Fake) Server(name string) *schema.Server {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	svr := f.serverByName(name)
+	if svr == nil {
+		return nil
+	}
+	copied := *svr
+	return &copied
+}
+
+// UserData returns the cloud-init user data the server was created with.
+func (f *Fake) UserData(name string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	svr := f.serverByName(name)
+	if svr == nil {
+		return ""
+	}
+	return f.userData[svr.ID]
+}
+
+// SSHKeys returns the ids of the ssh keys the server was created with.
+func (f *Fake) SSHKeys(name string) []int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	svr := f.serverByName(name)
+	if svr == nil {
+		return nil
+	}
+	return append([]int64{}, f.serverSSHKeys[svr.ID]...)
+}
+
+func (f *Fake) serverByName(name string) *schema.Server {
+	for _, svr := range f.servers {
+		if svr.Name == name {
+			return svr
+		}
+	}
+	return nil
+}
+
+func (f *Fake) newServer(name string, st schema.ServerType, dc schema.Datacenter, labels map[string]string) *schema.Server {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	svr := &schema.Server{
+		ID:              f.newID(),
+		Name:            name,
+		Status:          string(hcloud.ServerStatusRunning),
+		Created:         time.Now(),
+		ServerType:      st,
+		Datacenter:      dc,
+		Labels:          labels,
+		PrimaryDiskSize: st.Disk,
+		PrivateNet:      []schema.ServerPrivateNet{},
+		Volumes:         []int64{},
+		LoadBalancers:   []int64{},
+		PublicNet: schema.ServerPublicNet{
+			FloatingIPs: []int64{},
+			Firewalls:   []schema.ServerFirewall{},
+		},
+	}
+	f.servers[svr.ID] = svr
+	return svr
+}
+
+// assignNewPrimaryIPs creates primary ips that are deleted with the server.
+func (f *Fake) assignNewPrimaryIPs(svr *schema.Server, ipv4, ipv6 bool) {
+	if ipv4 {
+		pIP := f.newPrimaryIP("ipv4", svr.Datacenter)
+		pIP.AutoDelete = true
+		f.assignPrimaryIPTo(pIP, svr)
+	}
+	if ipv6 {
+		pIP := f.newPrimaryIP("ipv6", svr.Datacenter)
+		pIP.AutoDelete = true
+		f.assignPrimaryIPTo(pIP, svr)
+	}
+}
+
+func (f *Fake) listServers(w http.ResponseWriter, r *http.Request, _ int64) {
+	name := r.URL.Query().Get("name")
+	selector := r.URL.Query().Get("label_selector")
+	servers := []schema.Server{}
+	for _, svr := range sortedByID(f.servers) {
+		if len(name) > 0 && svr.Name != name {
+			continue
+		}
+		if !matchesLabels(svr.Labels, selector) {
+			continue
+		}
+		servers = append(servers, *svr)
+	}
+	writeList(w, "servers", servers)
+}
+
+func (f *Fake) getServer(w http.ResponseWriter, _ *http.Request, id int64) {
+	svr, ok := f.servers[id]
+	if !ok {
+		writeNotFound(w, "server")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"server": svr})
+}
+
+func (f *Fake) createServer(w http.ResponseWriter, r *http.Request, _ int64) {
+	var req schema.ServerCreateRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if f.serverByName(req.Name) != nil {
+		writeError(w, http.StatusConflict, hcloud.ErrorCodeUniquenessError, "server name is already used")
+		return
+	}
+	st := f.lookupServerType(req.ServerType)
+	if st == nil {
+		writeError(w, http.StatusUnprocessableEntity, hcloud.ErrorCodeInvalidInput, fmt.Sprintf("server type %v not found", req.ServerType))
+		return
+	}
+	img := f.lookupImage(req.Image)
+	if img == nil {
+		writeError(w, http.StatusUnprocessableEntity, hcloud.ErrorCodeInvalidInput, fmt.Sprintf("image %v not found", req.Image))
+		return
+	}
+	dc := f.lookupDatacenter(req.Datacenter, req.Location)
+	if dc == nil {
+		writeError(w, http.StatusUnprocessableEntity, hcloud.ErrorCodeInvalidInput, fmt.Sprintf("datacenter %s not found", req.Datacenter))
+		return
+	}
+	if !lo.Contains(dc.ServerTypes.Available, st.ID) {
+		writeError(w, http.StatusPreconditionFailed, hcloud.ErrorCodeResourceUnavailable, fmt.Sprintf("server type %s is unavailable in %s", st.Name, dc.Name))
+		return
+	}
+	if img.DiskSize > float32(st.Disk) {
+		writeError(w, http.StatusUnprocessableEntity, hcloud.ErrorCodeInvalidInput, fmt.Sprintf("image is larger than the disk of server type %s", st.Name))
+		return
+	}
+	if problem := f.checkCreateReferences(req, dc); len(problem) > 0 {
+		writeError(w, http.StatusUnprocessableEntity, hcloud.ErrorCodeInvalidInput, problem)
+		return
+	}
+
+	labels := map[string]string{}
+	if req.Labels != nil {
+		labels = *req.Labels
+	}
+	svr := f.newServer(req.Name, *st, *dc, labels)
+	svr.Image = img
+	f.userData[svr.ID] = req.UserData
+	f.serverSSHKeys[svr.ID] = req.SSHKeys
+	publicNet := req.PublicNet
+	if publicNet == nil {
+		publicNet = &schema.ServerCreatePublicNet{EnableIPv4: true, EnableIPv6: true}
+	}
+	if publicNet.IPv4ID != 0 {
+		f.assignPrimaryIPTo(f.primaryIPs[publicNet.IPv4ID], svr)
+	} else if publicNet.EnableIPv4 {
+		f.assignNewPrimaryIPs(svr, true, false)
+	}
+	if publicNet.IPv6ID != 0 {
+		f.assignPrimaryIPTo(f.primaryIPs[publicNet.IPv6ID], svr)
+	} else if publicNet.EnableIPv6 {
+		f.assignNewPrimaryIPs(svr, false, true)
+	}
+	for _, id := range req.Volumes {
+		f.attachVolumeTo(f.volumes[id], svr, req.Automount != nil && *req.Automount)
+	}
+	for _, fw := range req.Firewalls {
+		svr.PublicNet.Firewalls = append(svr.PublicNet.Firewalls, schema.ServerFirewall{ID: fw.Firewall, Status: "applied"})
+	}
+	for _, id := range req.Networks {
+		svr.PrivateNet = append(svr.PrivateNet, schema.ServerPrivateNet{Network: id, IP: f.nextNetworkIP(id)})
+	}
+	if req.PlacementGroup != 0 {
+		pg := f.placementGroups[req.PlacementGroup]
+		pg.Servers = append(pg.Servers, svr.ID)
+		svr.PlacementGroup = pg
+	}
+	if req.StartAfterCreate != nil && !*req.StartAfterCreate {
+		svr.Status = string(hcloud.ServerStatusOff)
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"server":       svr,
+		"action":       f.newAction("create_server", "server", svr.ID),
+		"next_actions": []schema.Action{},
+	})
+}
+
+// checkCreateReferences returns a problem if a resource referenced by the
+// create request does not exist or cannot be used.
+func (f *Fake) checkCreateReferences(req schema.ServerCreateRequest, dc *schema.Datacenter) string {
+	if req.PublicNet != nil {
+		for _, id := range []int64{req.PublicNet.IPv4ID, req.PublicNet.IPv6ID} {
+			if id == 0 {
+				continue
+			}
+			pIP, ok := f.primaryIPs[id]
+			if !ok {
+				return fmt.Sprintf("primary ip %d not found", id)
+			}
+			if pIP.AssigneeID != 0 {
+				return fmt.Sprintf("primary ip %d is already assigned", id)
+			}
+			if pIP.Datacenter.ID != dc.ID {
+				return fmt.Sprintf("primary ip %d is in another datacenter", id)
+			}
+		}
+	}
+	for _, id := range req.SSHKeys {
+		if _, ok := f.sshKeys[id]; !ok {
+			return fmt.Sprintf("ssh key %d not found", id)
+		}
+	}
+	for _, id := range req.Volumes {
+		vol, ok := f.volumes[id]
+		if !ok {
+			return fmt.Sprintf("volume %d not found", id)
+		}
+		if vol.Server != nil {
+			return fmt.Sprintf("volume %d is already attached", id)
+		}
+	}
+	for _, fw := range req.Firewalls {
+		if _, ok := f.firewalls[fw.Firewall]; !ok {
+			return fmt.Sprintf("firewall %d not found", fw.Firewall)
+		}
+	}
+	for _, id := range req.Networks {
+		if _, ok := f.networks[id]; !ok {
+			return fmt.Sprintf("network %d not found", id)
+		}
+	}
+	if req.PlacementGroup != 0 {
+		if _, ok := f.placementGroups[req.PlacementGroup]; !ok {
+			return fmt.Sprintf("placement group %d not found", req.PlacementGroup)
+		}
+	}
+	return ""
+}
+
+func (f *Fake) deleteServer(w http.ResponseWriter, _ *http.Request, id int64) {
+	svr, ok := f.servers[id]
+	if !ok {
+		writeNotFound(w, "server")
+		return
+	}
+	if svr.Protection.Delete {
+		writeError(w, http.StatusLocked, hcloud.ErrorCodeProtected, "server is delete protected")
+		return
+	}
+	for _, pIP := range f.primaryIPs {
+		if pIP.AssigneeID != svr.ID {
+			continue
+		}
+		if pIP.AutoDelete {
+			delete(f.primaryIPs, pIP.ID)
+			continue
+		}
+		pIP.AssigneeID = 0
+	}
+	for _, fIP := range f.floatingIPs {
+		if fIP.Server != nil && *fIP.Server == svr.ID {
+			fIP.Server = nil
+		}
+	}
+	for _, vol := range f.volumes {
+		if vol.Server != nil && *vol.Server == svr.ID {
+			f.detachVolumeFrom(vol)
+		}
+	}
+	if svr.PlacementGroup != nil {
+		if pg, ok := f.placementGroups[svr.PlacementGroup.ID]; ok {
+			pg.Servers = without(pg.Servers, svr.ID)
+		}
+	}
+	delete(f.servers, id)
+	delete(f.userData, id)
+	delete(f.serverSSHKeys, id)
+	writeJSON(w, http.StatusOK, map[string]any{"action": f.newAction("delete_server", "server", id)})
+}
+
+func (f *Fake) shutdownServer(w http.ResponseWriter, r *http.Request, id int64) {
+	f.setServerStatus(w, r, id, hcloud.ServerStatusOff)
+}
+
+func (f *Fake) powerOnServer(w http.ResponseWriter, r *http.Request, id int64) {
+	f.setServerStatus(w, r, id, hcloud.ServerStatusRunning)
+}
+
+// changeProtection requires delete and rebuild protection to match, like
+// the real api does.
+func (f *Fake) changeProtection(w http.ResponseWriter, r *http.Request, id int64) {
+	svr, ok := f.servers[id]
+	if !ok {
+		writeNotFound(w, "server")
+		return
+	}
+	var req schema.ServerActionChangeProtectionRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	protection := svr.Protection
+	if req.Delete != nil {
+		protection.Delete = *req.Delete
+	}
+	if req.Rebuild != nil {
+		protection.Rebuild = *req.Rebuild
+	}
+	if protection.Delete != protection.Rebuild {
+		writeError(w, http.StatusUnprocessableEntity, hcloud.ErrorCodeInvalidInput, "delete and rebuild protection must be the same")
+		return
+	}
+	svr.Protection = protection
+	writeJSON(w, http.StatusCreated, map[string]any{"action": f.newAction("change_protection", "server", id)})
+}
+
+func (f *Fake) enableBackup(w http.ResponseWriter, _ *http.Request, id int64) {
+	svr, ok := f.servers[id]
+	if !ok {
+		writeNotFound(w, "server")
+		return
+	}
+	window := "22-02"
+	svr.BackupWindow = &window
+	writeJSON(w, http.StatusCreated, map[string]any{"action": f.newAction("enable_backup", "server", id)})
+}
+
+func (f *Fake) setServerStatus(w http.ResponseWriter, r *http.Request, id int64, status hcloud.ServerStatus) {
+	svr, ok := f.servers[id]
+	if !ok {
+		writeNotFound(w, "server")
+		return
+	}
+	svr.Status = string(status)
+	command := "start_server"
+	if status == hcloud.ServerStatusOff {
+		command = "shutdown_server"
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"action": f.newAction(command, "server", id)})
+}
+
+func (f *Fake) createImage(w http.ResponseWriter, r *http.Request, id int64) {
+	svr, ok := f.servers[id]
+	if !ok {
+		writeNotFound(w, "server")
+		return
+	}
+	var req schema.ServerActionCreateImageRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	imageType := string(hcloud.ImageTypeSnapshot)
+	if req.Type != nil {
+		imageType = *req.Type
+	}
+	description := ""
+	if req.Description != nil {
+		description = *req.Description
+	}
+	now := time.Now()
+	size := float32(svr.PrimaryDiskSize) / 4
+	// like the api the size is unknown while the image is created
+	img := &schema.Image{
+		ID:           f.newID(),
+		Status:       string(hcloud.ImageStatusCreating),
+		Type:         imageType,
+		Description:  description,
+		DiskSize:     float32(svr.PrimaryDiskSize),
+		Created:      &now,
+		CreatedFrom:  &schema.ImageCreatedFrom{ID: svr.ID, Name: svr.Name},
+		OSFlavor:     "ubuntu",
+		Architecture: svr.ServerType.Architecture,
+		Labels:       map[string]string{},
+	}
+	if req.Labels != nil {
+		img.Labels = *req.Labels
+	}
+	f.images[img.ID] = img
+	response := *img
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"image": response,
+		"action": f.newActionThen("create_image", "server", id, func() {
+			img.Status = string(hcloud.ImageStatusAvailable)
+			img.ImageSize = &size
+		}),
+	})
+}
+
+func (f *Fake) attachToNetwork(w http.ResponseWriter, r *http.Request, id int64) {
+	svr, ok := f.servers[id]
+	if !ok {
+		writeNotFound(w, "server")
+		return
+	}
+	var req schema.ServerActionAttachToNetworkRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if _, ok := f.networks[req.Network]; !ok {
+		writeNotFound(w, "network")
+		return
+	}
+	ip := f.nextNetworkIP(req.Network)
+	if req.IP != nil {
+		ip = *req.IP
+	}
+	svr.PrivateNet = append(svr.PrivateNet, schema.ServerPrivateNet{Network: req.Network, IP: ip})
+	if network := f.networks[req.Network]; network != nil {
+		network.Servers = append(network.Servers, svr.ID)
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"action": f.newAction("attach_to_network", "server", id)})
+}
+
+func (f *Fake) lookupServerType(ref any) *schema.ServerType {
+	switch v := ref.(type) {
+	case float64:
+		return f.serverTypes[int64(v)]
+	case string:
+		for _, st := range f.serverTypes {
+			if st.Name == v {
+				return st
+			}
+		}
+	}
+	return nil
+}
+
+func (f *Fake) lookupImage(ref any) *schema.Image {
+	switch v := ref.(type) {
+	case float64:
+		return f.images[int64(v)]
+	case string:
+		for _, img := range f.images {
+			if img.Name != nil && *img.Name == v {
+				return img
+			}
+		}
+	}
+	return nil
+}
+
+// lookupDatacenter resolves the datacenter by id or name, falling back to
+// the first datacenter of the location.
+func (f *Fake) lookupDatacenter(datacenter, location string) *schema.Datacenter {
+	for _, dc := range sortedByID(f.datacenters) {
+		switch {
+		case len(datacenter) > 0:
+			if dc.Name == datacenter || strconv.FormatInt(dc.ID, 10) == datacenter {
+				return dc
+			}
+		case len(location) > 0:
+			if dc.Location.Name == location || strconv.FormatInt(dc.Location.ID, 10) == location {
+				return dc
+			}
+		default:
+			return dc
+		}
+	}
+	return nil
+}
+
+func (f *Fake) listServerTypes(w http.ResponseWriter, r *http.Request, _ int64) {
+	writeList(w, "server_types", filterByName(f.serverTypes, r, func(st *schema.ServerType) string { return st.Name }))
+}
+
+func (f *Fake) getServerType(w http.ResponseWriter, _ *http.Request, id int64) {
+	writeResource(w, "server_type", f.serverTypes, id)
+}
+
+func (f *Fake) listDatacenters(w http.ResponseWriter, r *http.Request, _ int64) {
+	writeList(w, "datacenters", filterByName(f.datacenters, r, func(dc *schema.Datacenter) string { return dc.Name }))
+}
+
+func (f *Fake) getDatacenter(w http.ResponseWriter, _ *http.Request, id int64) {
+	writeResource(w, "datacenter", f.datacenters, id)
+}
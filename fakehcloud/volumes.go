@@ -0,0 +1,195 @@
+package fakehcloud
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+	"github.com/samber/lo"
+)
+
+// volume extends the schema, which lacks the filesystem format.
+type volume struct {
+	schema.Volume
+	Format *string `json:"format"`
+
+	automount bool
+}
+
+// AddVolume adds a volume in the default location, attached to the server
+// unless serverID is zero. An empty format adds an unformatted volume.
+func (f *Fake) AddVolume(name string, size int, format string, serverID int64) schema.Volume {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	vol := &volume{Volume: schema.Volume{
+		ID:       f.newID(),
+		Name:     name,
+		Status:   "available",
+		Location: f.datacenters[DatacenterID].Location,
+		Size:     size,
+		Labels:   map[string]string{},
+		Created:  time.Now(),
+	}}
+	if len(format) > 0 {
+		vol.Format = &format
+	}
+	vol.LinuxDevice = fmt.Sprintf("/dev/disk/by-id/scsi-0HC_Volume_%d", vol.ID)
+	f.volumes[vol.ID] = vol
+	if svr, ok := f.servers[serverID]; ok {
+		f.attachVolumeTo(vol, svr, len(format) > 0)
+	}
+	return vol.Volume
+}
+
+// Volume returns the volume with the id or nil if there is none.
+func (f *Fake) Volume(id int64) *schema.Volume {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	vol, ok := f.volumes[id]
+	if !ok {
+		return nil
+	}
+	copied := vol.Volume
+	return &copied
+}
+
+// VolumeAutomounted reports whether the volume was last attached with
+// automount.
+func (f *Fake) VolumeAutomounted(id int64) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	vol, ok := f.volumes[id]
+	return ok && vol.automount
+}
+
+// DeleteVolume removes the volume, as if it was deleted in the console.
+func (f *Fake) DeleteVolume(id int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if vol, ok := f.volumes[id]; ok {
+		f.detachVolumeFrom(vol)
+		delete(f.volumes, id)
+	}
+}
+
+func (f *Fake) attachVolumeTo(vol *volume, svr *schema.Server, automount bool) {
+	vol.Server = &svr.ID
+	vol.automount = automount
+	svr.Volumes = append(svr.Volumes, vol.ID)
+}
+
+func (f *Fake) detachVolumeFrom(vol *volume) {
+	if vol.Server == nil {
+		return
+	}
+	if svr, ok := f.servers[*vol.Server]; ok {
+		svr.Volumes = without(svr.Volumes, vol.ID)
+	}
+	vol.Server = nil
+}
+
+func (f *Fake) listVolumes(w http.ResponseWriter, r *http.Request, _ int64) {
+	writeList(w, "volumes", filterByName(f.volumes, r, func(vol *volume) string { return vol.Name }))
+}
+
+func (f *Fake) getVolume(w http.ResponseWriter, _ *http.Request, id int64) {
+	writeResource(w, "volume", f.volumes, id)
+}
+
+func (f *Fake) createVolume(w http.ResponseWriter, r *http.Request, _ int64) {
+	var req schema.VolumeCreateRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	for _, vol := range f.volumes {
+		if vol.Name == req.Name {
+			writeError(w, http.StatusConflict, hcloud.ErrorCodeUniquenessError, "volume name is already used")
+			return
+		}
+	}
+	var location string
+	switch l := req.Location.(type) {
+	case string:
+		location = l
+	case float64:
+		location = strconv.FormatInt(int64(l), 10)
+	}
+	dc := f.lookupDatacenter("", location)
+	if dc == nil || len(location) == 0 {
+		writeError(w, http.StatusUnprocessableEntity, hcloud.ErrorCodeInvalidInput, "location not found")
+		return
+	}
+	vol := &volume{Volume: schema.Volume{
+		ID:       f.newID(),
+		Name:     req.Name,
+		Status:   "available",
+		Location: dc.Location,
+		Size:     req.Size,
+		Labels:   map[string]string{},
+		Created:  time.Now(),
+	}, Format: req.Format}
+	if req.Labels != nil {
+		vol.Labels = *req.Labels
+	}
+	vol.LinuxDevice = fmt.Sprintf("/dev/disk/by-id/scsi-0HC_Volume_%d", vol.ID)
+	f.volumes[vol.ID] = vol
+	writeJSON(w, http.StatusCreated, schema.VolumeCreateResponse{
+		Volume: vol.Volume,
+		Action: lo.ToPtr(f.newAction("create_volume", "volume", vol.ID)),
+	})
+}
+
+func (f *Fake) deleteVolume(w http.ResponseWriter, _ *http.Request, id int64) {
+	vol, ok := f.volumes[id]
+	if !ok {
+		writeNotFound(w, "volume")
+		return
+	}
+	if vol.Server != nil {
+		writeError(w, http.StatusLocked, "volume_attached", "volume is attached to a server")
+		return
+	}
+	delete(f.volumes, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *Fake) attachVolume(w http.ResponseWriter, r *http.Request, id int64) {
+	vol, ok := f.volumes[id]
+	if !ok {
+		writeNotFound(w, "volume")
+		return
+	}
+	var req schema.VolumeActionAttachVolumeRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	svr, ok := f.servers[req.Server]
+	if !ok {
+		writeNotFound(w, "server")
+		return
+	}
+	if vol.Server != nil {
+		writeError(w, http.StatusUnprocessableEntity, "volume_already_attached", "volume is already attached")
+		return
+	}
+	if vol.Location.ID != svr.Datacenter.Location.ID {
+		writeError(w, http.StatusUnprocessableEntity, hcloud.ErrorCodeInvalidInput, "volume is in another location")
+		return
+	}
+	automount := req.Automount != nil && *req.Automount
+	f.attachVolumeTo(vol, svr, automount)
+	writeJSON(w, http.StatusCreated, map[string]any{"action": f.newAction("attach_volume", "volume", id)})
+}
+
+func (f *Fake) detachVolume(w http.ResponseWriter, _ *http.Request, id int64) {
+	vol, ok := f.volumes[id]
+	if !ok {
+		writeNotFound(w, "volume")
+		return
+	}
+	f.detachVolumeFrom(vol)
+	writeJSON(w, http.StatusCreated, map[string]any{"action": f.newAction("detach_volume", "volume", id)})
+}
@@ -0,0 +1,230 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/samber/lo"
+	"hetzner-freezer/dump"
+)
+
+// archivableFilesystems are the filesystems hetzner can format volumes with,
+// so a recreated volume gets the same one.
+var archivableFilesystems = []string{"ext4", "xfs"}
+
+// restoreScript waits for the device of the new volume, mounts it where the
+// archived volume was mounted, unpacks the archive from stdin and points
+// fstab entries of the archived volume to the new one. Devices are replaced
+// as fixed strings, so they need no escaping.
+const restoreScript = `set -e
+dev=%[1]s
+old=%[3]s
+replace() {
+	awk -v old="$1" -v new="$2" '{
+		s = $0; out = ""
+		while ((i = index(s, old)) > 0) { out = out substr(s, 1, i - 1) new; s = substr(s, i + length(old)) }
+		print out s
+	}' /etc/fstab > /etc/fstab.freezer
+	cat /etc/fstab.freezer > /etc/fstab
+	rm -f /etc/fstab.freezer
+}
+i=0
+while [ ! -e "$dev" ]; do
+	[ $i -lt 60 ] || { echo "device $dev not found" >&2; exit 1; }
+	sleep 1
+	i=$((i+1))
+done
+mkdir -p %[2]s
+mountpoint -q %[2]s || mount "$dev" %[2]s
+tar -xzf - -C %[2]s
+[ -f /etc/fstab ] || exit 0
+replace "$old" "$dev"
+uuid=%[4]s
+[ -n "$uuid" ] || exit 0
+replace "UUID=$uuid" "UUID=$(blkid -s UUID -o value "$dev")"
+`
+
+// checkArchivable fails if the volumes of the server cannot be archived.
+func checkArchivable(svr *hcloud.Server, opts SSHOptions) error {
+	if len(opts.User) == 0 || len(opts.PrivateKeyFile) == 0 {
+		return errors.New("ssh user and private key are required to archive volumes")
+	}
+	if len(sshHost(svr)) == 0 {
+		return fmt.Errorf("server %s has no public ipv4 to archive volumes over ssh", svr.Name)
+	}
+	return nil
+}
+
+// sshHost returns the address to connect to the server over ssh or an empty
+// string if it has no public ipv4.
+func sshHost(svr *hcloud.Server) string {
+	if svr.PublicNet.IPv4.IsUnspecified() {
+		return ""
+	}
+	return svr.PublicNet.IPv4.IP.String()
+}
+
+// archiveVolumeStep copies the data of the mounted volume into the dump. The
+// filesystem is remounted read only first, so the archive is consistent and
+// nothing written afterwards is lost.
+func (p *resolverService) archiveVolumeStep(serverDumpID string, svr *hcloud.Server, vol dump.Volume, opts SSHOptions) step {
+	return step{
+		name:    fmt.Sprintf("archive volume %s", vol.Name),
+		details: fmt.Sprintf("copy the data of volume %d over ssh into dump %s", vol.ID, serverDumpID),
+		do: func(ctx context.Context) error {
+			r, err := p.dialServer(ctx, sshHost(svr), opts)
+			if err != nil {
+				return err
+			}
+			defer r.close()
+			var out bytes.Buffer
+			if err := r.run(ctx, "findmnt -n -r -o TARGET,FSTYPE,UUID "+shellQuote(vol.LinuxDevice), nil, &out); err != nil {
+				return fmt.Errorf("could not find mount point of volume %s: %w", vol.Name, err)
+			}
+			fields := strings.Fields(strings.SplitN(out.String(), "\n", 2)[0])
+			if len(fields) < 2 {
+				return fmt.Errorf("volume %s is not mounted", vol.Name)
+			}
+			a := &dump.VolumeArchive{VolumeName: vol.Name, MountPoint: fields[0], Filesystem: fields[1]}
+			if len(fields) > 2 {
+				a.UUID = fields[2]
+			}
+			if !lo.Contains(archivableFilesystems, a.Filesystem) {
+				return fmt.Errorf("volume %s has filesystem %s, only %s can be archived", vol.Name, a.Filesystem, strings.Join(archivableFilesystems, ", "))
+			}
+			p.logger.Infof("remount volume %s at %s read only", vol.Name, a.MountPoint)
+			if err := r.run(ctx, "sync && mount -o remount,ro "+shellQuote(a.MountPoint), nil, io.Discard); err != nil {
+				return fmt.Errorf("could not remount volume %s read only: %w", vol.Name, err)
+			}
+			p.logger.Infof("archive volume %s", vol.Name)
+			pr, pw := io.Pipe()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				pw.CloseWithError(r.run(ctx, "tar -C "+shellQuote(a.MountPoint)+" -czf - .", nil, pw))
+			}()
+			err = p.store.PutVolumeArchive(ctx, p.project, svr.Name, serverDumpID, a, pr)
+			// unblocks tar if the archive could not be stored
+			pr.CloseWithError(err)
+			<-done
+			if err != nil {
+				return err
+			}
+			p.logger.Infof("archived %d bytes of volume %s", a.Size, vol.Name)
+			return nil
+		},
+		undo: func(ctx context.Context) error {
+			r, err := p.dialServer(ctx, sshHost(svr), opts)
+			if err != nil {
+				return err
+			}
+			defer r.close()
+			// do remounted the mount point, which is looked up again since do
+			// may have failed or run in another process
+			var out bytes.Buffer
+			if err := r.run(ctx, "findmnt -n -r -o TARGET "+shellQuote(vol.LinuxDevice), nil, &out); err == nil {
+				if fields := strings.Fields(out.String()); len(fields) > 0 {
+					if err := r.run(ctx, "mount -o remount,rw "+shellQuote(fields[0]), nil, io.Discard); err != nil {
+						return fmt.Errorf("could not remount volume %s writable: %w", vol.Name, err)
+					}
+				}
+			}
+			// before the dump is created its directory only holds archives
+			return p.store.Delete(ctx, p.project, svr.Name, serverDumpID)
+		},
+	}
+}
+
+// deleteVolumeStep deletes an archived volume. It cannot be undone, it runs
+// after the server is deleted, so a failure keeps the archives and the freeze
+// is resumed instead of rolled back.
+func (p *resolverService) deleteVolumeStep(serverDumpID string, vol dump.Volume) step {
+	return step{
+		name:    fmt.Sprintf("delete volume %s", vol.Name),
+		details: fmt.Sprintf("the archive in dump %s is the only copy of its data afterwards", serverDumpID),
+		do: func(ctx context.Context) error {
+			current, resp, err := p.client.Volume.GetByID(ctx, vol.ID)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if current == nil {
+				return nil
+			}
+			p.logger.Warnf("delete volume %s, its data is kept in the archive of dump %s only", vol.Name, serverDumpID)
+			resp, err = p.client.Volume.Delete(ctx, current)
+			if err != nil && !hcloud.IsError(err, hcloud.ErrorCodeNotFound) {
+				return fmt.Errorf("failed to delete volume %s: %w", vol.Name, err)
+			}
+			if resp != nil {
+				defer resp.Body.Close()
+			}
+			return nil
+		},
+	}
+}
+
+// createVolume creates an empty volume to restore an archived one into and
+// returns its id.
+func (p *resolverService) createVolume(ctx context.Context, dumped dump.Volume, a *dump.VolumeArchive, location string) (int64, error) {
+	p.logger.Infof("create volume %s with %d GB %s", dumped.Name, dumped.Size, a.Filesystem)
+	res, resp, err := p.client.Volume.Create(ctx, hcloud.VolumeCreateOpts{
+		Name:     dumped.Name,
+		Size:     dumped.Size,
+		Location: &hcloud.Location{Name: location},
+		Format:   &a.Filesystem,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create volume %s: %w", dumped.Name, err)
+	}
+	defer resp.Body.Close()
+	if err := p.waitForActionStatus(ctx, res.Action); err != nil {
+		return 0, err
+	}
+	for _, action := range res.NextActions {
+		if err := p.waitForActionStatus(ctx, action); err != nil {
+			return 0, err
+		}
+	}
+	return res.Volume.ID, nil
+}
+
+// restoreVolume unpacks the archive of the dumped volume into the volume,
+// which is attached to the server.
+func (p *resolverService) restoreVolume(ctx context.Context, svr *hcloud.Server, serverDumpID string, dumped dump.Volume, a *dump.VolumeArchive, volumeID int64, opts SSHOptions) error {
+	vol, resp, err := p.client.Volume.GetByID(ctx, volumeID)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if vol == nil {
+		return fmt.Errorf("volume %d not found", volumeID)
+	}
+	data, err := p.store.OpenVolumeArchive(ctx, p.project, svr.Name, serverDumpID, dumped.Name)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+	r, err := p.dialServer(ctx, sshHost(svr), opts)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	p.logger.Infof("restore %d bytes of volume %s at %s", a.Size, dumped.Name, a.MountPoint)
+	hash := sha256.New()
+	script := fmt.Sprintf(restoreScript, shellQuote(vol.LinuxDevice), shellQuote(a.MountPoint), shellQuote(dumped.LinuxDevice), shellQuote(a.UUID))
+	if err := r.run(ctx, script, io.TeeReader(data, hash), io.Discard); err != nil {
+		return fmt.Errorf("could not restore volume %s: %w", dumped.Name, err)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != a.SHA256 {
+		return fmt.Errorf("archive of volume %s has checksum %s, the dump recorded %s", dumped.Name, sum, a.SHA256)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// fakeRemote answers the commands that archive and restore volume data.
+type fakeRemote struct {
+	mu       sync.Mutex
+	hosts    []string
+	commands []string
+	archive  []byte
+	restored []byte
+}
+
+func (r *fakeRemote) dial(_ context.Context, host string, _ SSHOptions) (remote, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hosts = append(r.hosts, host)
+	return r, nil
+}
+
+func (r *fakeRemote) run(_ context.Context, command string, stdin io.Reader, stdout io.Writer) error {
+	r.mu.Lock()
+	r.commands = append(r.commands, command)
+	r.mu.Unlock()
+	switch {
+	case strings.HasPrefix(command, "findmnt"):
+		_, err := io.WriteString(stdout, "/mnt/data ext4 0b5c6c1e\n")
+		return err
+	case strings.HasPrefix(command, "tar -C"):
+		_, err := stdout.Write(r.archive)
+		return err
+	case strings.Contains(command, "tar -xzf"):
+		restored, err := io.ReadAll(stdin)
+		r.mu.Lock()
+		r.restored = restored
+		r.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (r *fakeRemote) close() error {
+	return nil
+}
+
+func (r *fakeRemote) ran(prefix string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.commands {
+		if strings.HasPrefix(c, prefix) {
+			return c
+		}
+	}
+	return ""
+}
+
+func TestFreezeUnfreezeArchivedVolumes(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	r := &fakeRemote{archive: []byte("volume data")}
+	p.dial = r.dial
+	svr := fake.AddServer("web", nil)
+	vol := fake.AddVolume("data", 50, "ext4", svr.ID)
+	ssh := SSHOptions{User: "root", PrivateKeyFile: "id_ed25519"}
+
+	dumpID, err := p.FreezeServer(ctx, "web", FreezeOptions{VolumeMode: VolumeModeArchive, SSH: ssh})
+	if err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+	if fake.Volume(vol.ID) != nil {
+		t.Error("archived volume not deleted")
+	}
+	if c := r.ran("sync && mount -o remount,ro"); c != "sync && mount -o remount,ro '/mnt/data'" {
+		t.Errorf("volume not remounted read only before archiving, ran %v", r.commands)
+	}
+	serverDump, err := p.store.Get(ctx, testProject, "web", dumpID)
+	if err != nil {
+		t.Fatalf("could not load dump: %v", err)
+	}
+	if len(serverDump.Volumes) != 1 || !serverDump.Volumes[0].Archived {
+		t.Fatalf("dump has volumes %+v, want one archived", serverDump.Volumes)
+	}
+	a, err := p.store.GetVolumeArchive(ctx, testProject, "web", dumpID, "data")
+	if err != nil {
+		t.Fatalf("could not load archive: %v", err)
+	}
+	if a.Size != int64(len(r.archive)) || a.MountPoint != "/mnt/data" || a.Filesystem != "ext4" || len(a.SHA256) == 0 {
+		t.Errorf("archive is %+v", a)
+	}
+
+	err = p.UnfreezeServer(ctx, "web", "", UnfreezeOptions{})
+	var preflightErr *PreflightError
+	if !errors.As(err, &preflightErr) {
+		t.Fatalf("unfreeze without ssh key returned %v, want a preflight error", err)
+	}
+
+	if err := p.UnfreezeServer(ctx, "web", "", UnfreezeOptions{SSH: ssh}); err != nil {
+		t.Fatalf("unfreeze failed: %v", err)
+	}
+	restored := fake.Server("web")
+	if restored == nil {
+		t.Fatal("server not restored")
+	}
+	recreated, _, err := p.client.Volume.GetByName(ctx, "data")
+	if err != nil || recreated == nil {
+		t.Fatalf("volume not recreated: %v", err)
+	}
+	if recreated.Size != 50 || recreated.Server == nil || recreated.Server.ID != restored.ID {
+		t.Errorf("recreated volume is %+v", recreated)
+	}
+	if fake.VolumeAutomounted(recreated.ID) {
+		t.Error("recreated volume attached with automount")
+	}
+	if !bytes.Equal(r.restored, r.archive) {
+		t.Errorf("restored %q, want %q", r.restored, r.archive)
+	}
+	restore := r.ran("set -e")
+	if !strings.Contains(restore, recreated.LinuxDevice) || !strings.Contains(restore, "old="+shellQuote(vol.LinuxDevice)) {
+		t.Errorf("restore does not replace device %s with %s: %s", vol.LinuxDevice, recreated.LinuxDevice, restore)
+	}
+}
+
+func TestFreezeArchivedVolumesRollback(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	r := &fakeRemote{archive: []byte("volume data")}
+	p.dial = r.dial
+	svr := fake.AddServer("web", nil)
+	vol := fake.AddVolume("data", 50, "ext4", svr.ID)
+	fake.Fail("POST", "/servers/{id}/actions/shutdown", 1, hcloud.ErrorCodeServiceError)
+
+	_, err := p.FreezeServer(ctx, "web", FreezeOptions{VolumeMode: VolumeModeArchive, SSH: SSHOptions{User: "root", PrivateKeyFile: "id_ed25519"}})
+	var rbErr *RollbackError
+	if !errors.As(err, &rbErr) {
+		t.Fatalf("freeze returned %v, want a rollback error", err)
+	}
+	if fake.Volume(vol.ID) == nil {
+		t.Error("volume deleted by a rolled back freeze")
+	}
+	if c := r.ran("mount -o remount,rw"); c != "mount -o remount,rw '/mnt/data'" {
+		t.Errorf("mount point not remounted writable, ran %v", r.commands)
+	}
+}
+
+func TestFreezeArchivedVolumesKeepsArchives(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	r := &fakeRemote{archive: []byte("volume data")}
+	p.dial = r.dial
+	svr := fake.AddServer("web", nil)
+	vol := fake.AddVolume("data", 50, "ext4", svr.ID)
+	fake.Fail("DELETE", "/volumes/{id}", 1, hcloud.ErrorCodeServiceError)
+	opts := FreezeOptions{VolumeMode: VolumeModeArchive, SSH: SSHOptions{User: "root", PrivateKeyFile: "id_ed25519"}}
+
+	_, err := p.FreezeServer(ctx, "web", opts)
+	var incErr *IncompleteError
+	if !errors.As(err, &incErr) {
+		t.Fatalf("freeze returned %v, want an incomplete error", err)
+	}
+	j, err := p.store.LoadJournal(ctx, testProject, "web")
+	if err != nil || j == nil {
+		t.Fatalf("no journal after failed freeze: %v", err)
+	}
+	if _, err := p.store.GetVolumeArchive(ctx, testProject, "web", j.DumpID, "data"); err != nil {
+		t.Fatalf("archive lost after failed freeze: %v", err)
+	}
+	if images := fake.Images(); len(images) != 1 {
+		t.Errorf("%d snapshots left, want the one of the dump", len(images))
+	}
+
+	if _, err := p.FreezeServer(ctx, "web", opts); err != nil {
+		t.Fatalf("resumed freeze failed: %v", err)
+	}
+	if fake.Volume(vol.ID) != nil {
+		t.Error("archived volume not deleted by the resumed freeze")
+	}
+	if _, err := p.store.GetVolumeArchive(ctx, testProject, "web", j.DumpID, "data"); err != nil {
+		t.Errorf("archive lost after resumed freeze: %v", err)
+	}
+}
+
+func TestHostKeyCallbackRequiresKnownHosts(t *testing.T) {
+	if _, err := hostKeyCallback(SSHOptions{KnownHostsFile: filepath.Join(t.TempDir(), "known_hosts")}); err == nil {
+		t.Fatal("expected an error without a known hosts file")
+	}
+	if _, err := hostKeyCallback(SSHOptions{InsecureIgnoreHostKey: true}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,260 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+	"github.com/samber/lo"
+	"hetzner-freezer/dump"
+)
+
+// AutoFreezeExemptLabel exempts servers from the auto freeze, whatever its
+// value.
+const AutoFreezeExemptLabel = "hetzner-freezer/exempt"
+
+// maxMetricPoints limits the points of the metrics fetched per server, the
+// step grows with the window.
+const maxMetricPoints = 500
+
+// AutoFreezeOptions configure which servers AutoFreeze considers idle.
+type AutoFreezeOptions struct {
+	// Selector selects the servers to check, it is required so that an auto
+	// freeze never checks every server of the project.
+	Selector string
+	// Window is how long a server has to be idle to be frozen.
+	Window time.Duration
+	// CPUThreshold is the cpu usage in percent an idle server stays below.
+	CPUThreshold float64
+	// NetworkThreshold is the bandwidth in bytes per second, in and out of
+	// every interface together, an idle server stays below.
+	NetworkThreshold float64
+	// ExemptLabel exempts servers that have it, empty means
+	// AutoFreezeExemptLabel.
+	ExemptLabel string
+	// DryRun reports the idle servers without freezing them.
+	DryRun bool
+	// Parallelism is the number of servers frozen at the same time.
+	Parallelism int
+	Freeze      FreezeOptions
+}
+
+// AutoFreezeReport reports the servers an auto freeze checked.
+type AutoFreezeReport struct {
+	Servers []AutoFreezeResult
+}
+
+// AutoFreezeResult is the outcome of the auto freeze of a server.
+type AutoFreezeResult struct {
+	ServerName string
+	// Idle is set if the server was idle for the whole window.
+	Idle bool
+	// Reason explains why the server is idle or not.
+	Reason string
+	// Frozen is set if the server was frozen into DumpID.
+	Frozen bool
+	DumpID string
+	// MonthlySavings is the gross monthly cost of the running server less
+	// the cost of the frozen one, like the snapshot. For servers that are not
+	// frozen the snapshot is estimated by the size of the disk. It is zero if
+	// the dump of a frozen server could not be loaded.
+	MonthlySavings float64
+	// Err is why the server could not be frozen, or for a frozen server why
+	// its dump could not be loaded.
+	Err error
+}
+
+// Idle returns the results of the idle servers.
+func (r *AutoFreezeReport) Idle() []AutoFreezeResult {
+	return lo.Filter(r.Servers, func(item AutoFreezeResult, index int) bool { return item.Idle })
+}
+
+// Savings returns the estimated monthly savings of the frozen servers, or
+// of the idle ones if nothing was frozen in a dry run.
+func (r *AutoFreezeReport) Savings(dryRun bool) float64 {
+	return lo.SumBy(r.Servers, func(item AutoFreezeResult) float64 {
+		if item.Frozen || (dryRun && item.Idle) {
+			return item.MonthlySavings
+		}
+		return 0
+	})
+}
+
+// Err returns the errors of all servers that could not be frozen or whose
+// dump could not be loaded, or nil if none failed.
+func (r *AutoFreezeReport) Err() error {
+	return errors.Join(lo.FilterMap(r.Servers, func(item AutoFreezeResult, index int) (error, bool) {
+		if item.Err == nil {
+			return nil, false
+		}
+		return fmt.Errorf("server %s: %w", item.ServerName, item.Err), true
+	})...)
+}
+
+// AutoFreeze freezes the servers matching the selector that were idle for
+// the window according to their cpu and network metrics.
+func (p *resolverService) AutoFreeze(ctx context.Context, opts AutoFreezeOptions) (*AutoFreezeReport, error) {
+	if len(opts.Selector) == 0 {
+		return nil, fmt.Errorf("selector is required")
+	}
+	if opts.Window <= 0 {
+		return nil, fmt.Errorf("idle window must be positive")
+	}
+	pricing, resp, err := p.client.Pricing.Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pricing: %w", err)
+	}
+	defer resp.Body.Close()
+	exemptLabel := orDefault(opts.ExemptLabel, AutoFreezeExemptLabel)
+	servers, err := p.client.Server.AllWithOpts(ctx, hcloud.ServerListOpts{
+		ListOpts: hcloud.ListOpts{LabelSelector: opts.Selector},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list servers: %w", err)
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Name < servers[j].Name })
+	end := time.Now().UTC()
+	start := end.Add(-opts.Window)
+
+	report := &AutoFreezeReport{}
+	var idle []int
+	for _, svr := range servers {
+		res := AutoFreezeResult{ServerName: svr.Name, MonthlySavings: estimatedSavings(pricing, svr, opts.Freeze)}
+		switch {
+		case hasLabel(svr.Labels, exemptLabel):
+			res.Reason = fmt.Sprintf("exempt by label %s", exemptLabel)
+		case svr.Created.After(start):
+			res.Reason = "created within the idle window"
+		default:
+			metrics, err := p.serverMetrics(ctx, svr, start, end)
+			if err != nil {
+				res.Err = err
+				res.Reason = "metrics unavailable"
+				break
+			}
+			res.Idle, res.Reason = idleReason(metrics, opts)
+		}
+		p.logger.Infof("server %s: %s", svr.Name, res.Reason)
+		if res.Idle {
+			idle = append(idle, len(report.Servers))
+		}
+		report.Servers = append(report.Servers, res)
+	}
+	if opts.DryRun || len(idle) == 0 {
+		return report, nil
+	}
+
+	p.logger.Infof("start freezing %d idle servers", len(idle))
+	results := forEachParallel(ctx, opts.Parallelism, idle, func(ctx context.Context, i int) ServerResult {
+		dumpID, err := p.FreezeServer(ctx, report.Servers[i].ServerName, opts.Freeze)
+		return ServerResult{ServerName: report.Servers[i].ServerName, DumpID: dumpID, Err: err}
+	})
+	for n, i := range idle {
+		report.Servers[i].DumpID = results[n].DumpID
+		report.Servers[i].Err = results[n].Err
+		report.Servers[i].Frozen = results[n].Err == nil
+		if !report.Servers[i].Frozen {
+			continue
+		}
+		serverDump, err := p.store.Get(ctx, p.project, report.Servers[i].ServerName, results[n].DumpID)
+		if err != nil {
+			// the server is frozen anyway, only its savings are unknown
+			p.logger.Warnf("could not load dump %s of server %s: %v", results[n].DumpID, report.Servers[i].ServerName, err)
+			report.Servers[i].MonthlySavings = 0
+			report.Servers[i].Err = fmt.Errorf("failed to load server dump: %w", err)
+			continue
+		}
+		cost := freezeCost(pricing, serverDump)
+		report.Servers[i].MonthlySavings = cost.MonthlySavings()
+	}
+	return report, nil
+}
+
+// serverMetrics returns the cpu and network metrics of the server between
+// start and end.
+func (p *resolverService) serverMetrics(ctx context.Context, svr *hcloud.Server, start, end time.Time) (*hcloud.ServerMetrics, error) {
+	step := int(math.Max(60, end.Sub(start).Seconds()/maxMetricPoints))
+	metrics, resp, err := p.client.Server.GetMetrics(ctx, svr, hcloud.ServerGetMetricsOpts{
+		Types: []hcloud.ServerMetricType{hcloud.ServerMetricCPU, hcloud.ServerMetricNetwork},
+		Start: start,
+		End:   end,
+		Step:  step,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metrics of server %s: %w", svr.Name, err)
+	}
+	defer resp.Body.Close()
+	return metrics, nil
+}
+
+// idleReason reports whether the cpu usage and bandwidth of the metrics stay
+// below the thresholds and explains why.
+func idleReason(metrics *hcloud.ServerMetrics, opts AutoFreezeOptions) (bool, string) {
+	cpu, ok := peak(metrics.TimeSeries, func(name string) bool { return name == "cpu" })
+	if !ok {
+		return false, "no cpu metrics"
+	}
+	bandwidth, ok := peak(metrics.TimeSeries, func(name string) bool {
+		return strings.HasPrefix(name, "network.") && strings.Contains(name, ".bandwidth.")
+	})
+	if !ok {
+		return false, "no network metrics"
+	}
+	usage := fmt.Sprintf("peak cpu %.1f%%, peak bandwidth %.0f B/s", cpu, bandwidth)
+	switch {
+	case cpu >= opts.CPUThreshold:
+		return false, fmt.Sprintf("busy, %s", usage)
+	case bandwidth >= opts.NetworkThreshold:
+		return false, fmt.Sprintf("busy, %s", usage)
+	}
+	return true, fmt.Sprintf("idle for %s, %s", opts.Window, usage)
+}
+
+// peak returns the highest sum of the values at the same time of the series
+// with matching names, or false if they have no values.
+func peak(series map[string][]hcloud.ServerMetricsValue, match func(name string) bool) (float64, bool) {
+	sums := map[float64]float64{}
+	for name, values := range series {
+		if !match(name) {
+			continue
+		}
+		for _, v := range values {
+			f, err := strconv.ParseFloat(v.Value, 64)
+			if err != nil || math.IsNaN(f) {
+				continue
+			}
+			sums[v.Timestamp] += f
+		}
+	}
+	if len(sums) == 0 {
+		return 0, false
+	}
+	return lo.Max(lo.Values(sums)), true
+}
+
+// estimatedSavings returns what freezing the server would save per month.
+// The snapshot is estimated by the size of the disk, floating ips and kept
+// volumes cost the same while the server is frozen.
+func estimatedSavings(pricing hcloud.Pricing, svr *hcloud.Server, opts FreezeOptions) float64 {
+	if svr.ServerType == nil || svr.Datacenter == nil || svr.Datacenter.Location == nil {
+		return 0
+	}
+	cost := freezeCost(pricing, &dump.ServerDump{
+		Server:     hcloud.SchemaFromServer(svr),
+		Snapshot:   schema.Image{ImageSize: lo.ToPtr(float32(svr.PrimaryDiskSize))},
+		PrimaryIPs: dump.PrimaryIPs{Policy: opts.IPPolicy},
+	})
+	return cost.MonthlySavings()
+}
+
+func hasLabel(labels map[string]string, key string) bool {
+	_, ok := labels[key]
+	return ok
+}
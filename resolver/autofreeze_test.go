@@ -0,0 +1,146 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"hetzner-freezer/dump"
+	"hetzner-freezer/fakehcloud"
+)
+
+func newIdleServers(t *testing.T) (*fakehcloud.Fake, *resolverService) {
+	t.Helper()
+	fake, p := newTestResolver(t)
+	old := time.Now().Add(-48 * time.Hour)
+	for _, s := range []struct {
+		name      string
+		labels    map[string]string
+		cpu       float64
+		bandwidth float64
+		created   time.Time
+	}{
+		{name: "idle", labels: map[string]string{"env": "demo"}, cpu: 1, bandwidth: 100, created: old},
+		{name: "cpu", labels: map[string]string{"env": "demo"}, cpu: 50, bandwidth: 100, created: old},
+		{name: "network", labels: map[string]string{"env": "demo"}, cpu: 1, bandwidth: 8000, created: old},
+		{name: "exempt", labels: map[string]string{"env": "demo", AutoFreezeExemptLabel: ""}, created: old},
+		{name: "new", labels: map[string]string{"env": "demo"}, created: time.Now()},
+		{name: "other", labels: map[string]string{"env": "prod"}, created: old},
+	} {
+		fake.AddServer(s.name, s.labels)
+		fake.SetServerLoad(s.name, s.cpu, s.bandwidth)
+		fake.SetServerCreated(s.name, s.created)
+	}
+	return fake, p
+}
+
+func testAutoFreezeOptions() AutoFreezeOptions {
+	return AutoFreezeOptions{
+		Selector:         "env=demo",
+		Window:           24 * time.Hour,
+		CPUThreshold:     5,
+		NetworkThreshold: 10240,
+		Parallelism:      2,
+	}
+}
+
+func TestAutoFreezeFreezesIdleServers(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newIdleServers(t)
+
+	report, err := p.AutoFreeze(ctx, testAutoFreezeOptions())
+	if err != nil {
+		t.Fatalf("auto freeze failed: %v", err)
+	}
+	if err := report.Err(); err != nil {
+		t.Fatalf("auto freeze of a server failed: %v", err)
+	}
+	frozen := map[string]bool{}
+	for _, res := range report.Servers {
+		if res.Frozen {
+			frozen[res.ServerName] = true
+		}
+	}
+	if len(report.Servers) != 5 || len(frozen) != 1 || !frozen["idle"] {
+		t.Fatalf("report %+v, want only idle of 5 servers frozen", report.Servers)
+	}
+	for _, name := range []string{"cpu", "network", "exempt", "new", "other"} {
+		if fake.Server(name) == nil {
+			t.Errorf("server %s was deleted", name)
+		}
+	}
+	if fake.Server("idle") != nil {
+		t.Error("idle server not deleted")
+	}
+	// the snapshot of the cx11 is a quarter of its disk
+	want := (3.29 - 5*0.0119) * (1 + fakehcloud.VAT)
+	if savings := report.Savings(false); savings < want-0.001 || savings > want+0.001 {
+		t.Errorf("savings %.4f, want %.4f", savings, want)
+	}
+}
+
+// unreadableStore fails to load any dump.
+type unreadableStore struct {
+	dump.Store
+}
+
+func (s *unreadableStore) Get(context.Context, string, string, string) (*dump.ServerDump, error) {
+	return nil, errors.New("storage unavailable")
+}
+
+func TestAutoFreezeReportsUnreadableDumps(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newIdleServers(t)
+	p.store = &unreadableStore{Store: p.store}
+
+	report, err := p.AutoFreeze(ctx, testAutoFreezeOptions())
+	if err != nil {
+		t.Fatalf("auto freeze failed: %v", err)
+	}
+	if fake.Server("idle") != nil {
+		t.Fatal("idle server not deleted")
+	}
+	for _, res := range report.Servers {
+		if res.ServerName != "idle" {
+			continue
+		}
+		if !res.Frozen || len(res.DumpID) == 0 || res.Err == nil || res.MonthlySavings != 0 {
+			t.Errorf("result %+v, want the frozen server with the error and no savings", res)
+		}
+	}
+	if report.Err() == nil {
+		t.Error("report has no error")
+	}
+}
+
+func TestAutoFreezeDryRun(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newIdleServers(t)
+	opts := testAutoFreezeOptions()
+	opts.DryRun = true
+	opts.NetworkThreshold = 20000
+
+	report, err := p.AutoFreeze(ctx, opts)
+	if err != nil {
+		t.Fatalf("auto freeze failed: %v", err)
+	}
+	if idle := report.Idle(); len(idle) != 2 || idle[0].ServerName != "idle" || idle[1].ServerName != "network" {
+		t.Errorf("idle servers %+v, want idle and network", idle)
+	}
+	if report.Savings(true) == 0 {
+		t.Error("dry run estimates no savings")
+	}
+	if fake.Server("idle") == nil || fake.Server("network") == nil {
+		t.Error("dry run deleted a server")
+	}
+}
+
+func TestAutoFreezeRequiresSelector(t *testing.T) {
+	_, p := newIdleServers(t)
+	opts := testAutoFreezeOptions()
+	opts.Selector = ""
+	if _, err := p.AutoFreeze(context.Background(), opts); err == nil {
+		t.Error("auto freeze without selector checked every server")
+	}
+}
@@ -0,0 +1,261 @@
+package resolver
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/samber/lo"
+	"hetzner-freezer/dump"
+)
+
+// hoursPerMonth converts monthly prices into the cost of a period, hetzner
+// bills by the hour up to the monthly price.
+const hoursPerMonth = 730
+
+// Costs are the gross monthly costs of the resources of a server.
+type Costs struct {
+	Server      float64 `json:"server"`
+	Backups     float64 `json:"backups"`
+	PrimaryIPs  float64 `json:"primary_ips"`
+	FloatingIPs float64 `json:"floating_ips"`
+	Volumes     float64 `json:"volumes"`
+	Snapshot    float64 `json:"snapshot"`
+}
+
+// Total returns the sum of the costs.
+func (c Costs) Total() float64 {
+	return c.Server + c.Backups + c.PrimaryIPs + c.FloatingIPs + c.Volumes + c.Snapshot
+}
+
+// FreezeCost compares the monthly costs of a server while running and while
+// frozen by a dump, and what the freeze saved so far.
+type FreezeCost struct {
+	Project    string            `json:"project"`
+	ServerName string            `json:"server_name"`
+	DumpID     string            `json:"dump_id"`
+	Labels     map[string]string `json:"labels"`
+	Currency   string            `json:"currency"`
+	FrozenAt   time.Time         `json:"frozen_at"`
+	// UnfrozenAt ends the frozen period, nil while the server is frozen or
+	// if the end is unknown.
+	UnfrozenAt *time.Time `json:"unfrozen_at,omitempty"`
+	// Frozen is set if the server is still frozen by the dump.
+	Frozen      bool  `json:"frozen"`
+	Running     Costs `json:"running"`
+	WhileFrozen Costs `json:"while_frozen"`
+	// Saved is the difference of the costs over the frozen period.
+	Saved float64 `json:"saved"`
+	// Note explains estimates that are incomplete.
+	Note string `json:"note,omitempty"`
+}
+
+// MonthlySavings returns the difference of the monthly costs while running
+// and while frozen.
+func (c *FreezeCost) MonthlySavings() float64 {
+	return c.Running.Total() - c.WhileFrozen.Total()
+}
+
+// CostSummary aggregates the freeze costs of a project, or of the servers of
+// a project with the same value of a label.
+type CostSummary struct {
+	Project string `json:"project"`
+	// Label is the value of the grouping label, empty if the servers do not
+	// have it or they are not grouped by label.
+	Label    string `json:"label,omitempty"`
+	Currency string `json:"currency"`
+	// Frozen is the number of servers that are frozen now, MonthlySavings
+	// what that saves per month.
+	Frozen         int     `json:"frozen"`
+	MonthlySavings float64 `json:"monthly_savings"`
+	// Saved is what all freezes saved so far.
+	Saved float64 `json:"saved"`
+}
+
+// FreezeCosts estimates the costs of the server or of all servers of the
+// project if serverName is empty, for each of their freezes, oldest first.
+// Prices are those of the pricing api, which are the same for every project.
+// Without a client it is unknown whether servers exist, so the latest freeze
+// of a server without a recorded unfreeze is assumed to last.
+func (p *resolverService) FreezeCosts(ctx context.Context, serverName string, pricing hcloud.Pricing) ([]FreezeCost, error) {
+	infos, err := p.ListDumps(ctx, serverName)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	var costs []FreezeCost
+	for name, serverInfos := range lo.GroupBy(infos, func(item DumpInfo) string { return item.ServerName }) {
+		freezes := lo.Filter(serverInfos, func(item DumpInfo, index int) bool {
+			return item.Operation == dump.OperationFreeze && item.Status == dump.StatusComplete
+		})
+		for i, info := range freezes {
+			m, err := p.loadManifest(ctx, name, info.DumpID)
+			if err != nil {
+				return nil, err
+			}
+			serverDump, err := p.store.Get(ctx, p.project, name, info.DumpID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load server dump: %w", err)
+			}
+			cost := freezeCost(pricing, serverDump)
+			cost.Project = p.project
+			cost.ServerName = name
+			cost.DumpID = info.DumpID
+			cost.FrozenAt = m.CreatedAt
+			cost.UnfrozenAt = m.UnfrozenAt
+			// the next freeze ends the period of dumps whose unfreeze was
+			// not recorded
+			if cost.UnfrozenAt == nil && i+1 < len(freezes) {
+				cost.UnfrozenAt = lo.ToPtr(freezes[i+1].CreatedAt)
+			}
+			end := lo.FromPtr(cost.UnfrozenAt)
+			if cost.UnfrozenAt == nil {
+				switch {
+				case info.ServerExists == nil:
+					cost.Note = "unfreeze not recorded, assumed frozen"
+					cost.Frozen = true
+					end = now
+				case *info.ServerExists:
+					cost.Note = "server exists but its unfreeze was not recorded"
+				default:
+					cost.Frozen = true
+					end = now
+				}
+			}
+			if !end.IsZero() {
+				cost.Saved = cost.MonthlySavings() * end.Sub(cost.FrozenAt).Hours() / hoursPerMonth
+			}
+			costs = append(costs, cost)
+		}
+	}
+	slices.SortFunc(costs, func(a, b FreezeCost) int { return a.FrozenAt.Compare(b.FrozenAt) })
+	return costs, nil
+}
+
+// freezeCost returns the monthly costs of the dumped server while running and
+// while frozen. Archived volumes are stored with the dump and not priced.
+func freezeCost(pricing hcloud.Pricing, serverDump *dump.ServerDump) FreezeCost {
+	svr := serverDump.Server
+	location := svr.Datacenter.Location.Name
+	cost := FreezeCost{
+		Labels:   svr.Labels,
+		Currency: pricing.Image.PerGBMonth.Currency,
+	}
+
+	cost.Running.Server = serverTypePrice(pricing, svr.ServerType.Name, location)
+	if len(lo.FromPtr(svr.BackupWindow)) > 0 {
+		cost.Running.Backups = cost.Running.Server * parsePrice(pricing.ServerBackup.Percentage) / 100
+	}
+	for family, id := range map[string]int64{"ipv4": svr.PublicNet.IPv4.ID, "ipv6": svr.PublicNet.IPv6.ID} {
+		if id == 0 {
+			continue
+		}
+		ipPrice := primaryIPPrice(pricing, family, location)
+		cost.Running.PrimaryIPs += ipPrice
+		if !releasesIP(serverDump.PrimaryIPs.Policy, family) {
+			cost.WhileFrozen.PrimaryIPs += ipPrice
+		}
+	}
+	for _, fIP := range serverDump.FloatingIPs {
+		ipPrice := floatingIPPrice(pricing, fIP.Type, fIP.HomeLocation.Name)
+		cost.Running.FloatingIPs += ipPrice
+		cost.WhileFrozen.FloatingIPs += ipPrice
+	}
+	perGB := parsePrice(pricing.Volume.PerGBMonthly.Gross)
+	for _, vol := range serverDump.Volumes {
+		volPrice := float64(vol.Size) * perGB
+		cost.Running.Volumes += volPrice
+		if !vol.Archived {
+			cost.WhileFrozen.Volumes += volPrice
+		}
+	}
+	cost.WhileFrozen.Snapshot = float64(lo.FromPtr(serverDump.Snapshot.ImageSize)) * parsePrice(pricing.Image.PerGBMonth.Gross)
+	return cost
+}
+
+func serverTypePrice(pricing hcloud.Pricing, serverType, location string) float64 {
+	for _, st := range pricing.ServerTypes {
+		if st.ServerType == nil || st.ServerType.Name != serverType {
+			continue
+		}
+		for _, price := range st.Pricings {
+			if price.Location != nil && price.Location.Name == location {
+				return parsePrice(price.Monthly.Gross)
+			}
+		}
+	}
+	return 0
+}
+
+func primaryIPPrice(pricing hcloud.Pricing, family, location string) float64 {
+	for _, ip := range pricing.PrimaryIPs {
+		if ip.Type != family {
+			continue
+		}
+		for _, price := range ip.Pricings {
+			if price.Location == location {
+				return parsePrice(price.Monthly.Gross)
+			}
+		}
+	}
+	return 0
+}
+
+func floatingIPPrice(pricing hcloud.Pricing, family, location string) float64 {
+	for _, ip := range pricing.FloatingIPs {
+		if string(ip.Type) != family {
+			continue
+		}
+		for _, price := range ip.Pricings {
+			if price.Location != nil && price.Location.Name == location {
+				return parsePrice(price.Monthly.Gross)
+			}
+		}
+	}
+	return 0
+}
+
+// parsePrice returns the amount of a price of the pricing api, 0 if it is
+// missing.
+func parsePrice(amount string) float64 {
+	f, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+// SummarizeCosts aggregates the costs by project and, if label is not empty,
+// by the value of the label of the servers.
+func SummarizeCosts(costs []FreezeCost, label string) []CostSummary {
+	var summaries []CostSummary
+	index := map[[2]string]int{}
+	for _, cost := range costs {
+		key := [2]string{cost.Project, ""}
+		if len(label) > 0 {
+			key[1] = cost.Labels[label]
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(summaries)
+			index[key] = i
+			summaries = append(summaries, CostSummary{Project: key[0], Label: key[1], Currency: cost.Currency})
+		}
+		if cost.Frozen {
+			summaries[i].Frozen++
+			summaries[i].MonthlySavings += cost.MonthlySavings()
+		}
+		summaries[i].Saved += cost.Saved
+	}
+	slices.SortFunc(summaries, func(a, b CostSummary) int {
+		if a.Project != b.Project {
+			return cmp.Compare(a.Project, b.Project)
+		}
+		return cmp.Compare(a.Label, b.Label)
+	})
+	return summaries
+}
@@ -0,0 +1,95 @@
+package resolver
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"hetzner-freezer/fakehcloud"
+)
+
+func gross(net float64) float64 {
+	return net * (1 + fakehcloud.VAT)
+}
+
+func TestFreezeCosts(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	svr := fake.AddServer("web", map[string]string{"team": "a"})
+	fake.AddFloatingIP("198.51.100.10", svr.ID)
+
+	dumpID, err := p.FreezeServer(ctx, "web", FreezeOptions{})
+	if err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+	// frozen for a month
+	m, err := p.store.GetManifest(ctx, testProject, "web", dumpID)
+	if err != nil {
+		t.Fatalf("could not load manifest: %v", err)
+	}
+	m.CreatedAt = m.CreatedAt.Add(-hoursPerMonth * time.Hour)
+	if err := p.store.PutManifest(ctx, testProject, "web", m); err != nil {
+		t.Fatalf("could not store manifest: %v", err)
+	}
+
+	pricing, _, err := p.client.Pricing.Get(ctx)
+	if err != nil {
+		t.Fatalf("could not get pricing: %v", err)
+	}
+	costs, err := p.FreezeCosts(ctx, "", pricing)
+	if err != nil {
+		t.Fatalf("cost estimation failed: %v", err)
+	}
+	if len(costs) != 1 || !costs[0].Frozen || costs[0].UnfrozenAt != nil {
+		t.Fatalf("costs %+v, want the frozen server", costs)
+	}
+	cost := costs[0]
+	running := gross(3.29 + 0.5 + 3)
+	frozen := gross(0.5 + 3 + 5*0.0119)
+	for name, got := range map[string][2]float64{
+		"running": {cost.Running.Total(), running},
+		"frozen":  {cost.WhileFrozen.Total(), frozen},
+		"saved":   {cost.Saved, running - frozen},
+	} {
+		if math.Abs(got[0]-got[1]) > 0.01 {
+			t.Errorf("%s costs %.4f, want %.4f", name, got[0], got[1])
+		}
+	}
+	if cost.Currency != "EUR" || cost.Labels["team"] != "a" {
+		t.Errorf("cost has currency %q and labels %v", cost.Currency, cost.Labels)
+	}
+
+	if err := p.UnfreezeServer(ctx, "web", "", UnfreezeOptions{}); err != nil {
+		t.Fatalf("unfreeze failed: %v", err)
+	}
+	costs, err = p.FreezeCosts(ctx, "web", pricing)
+	if err != nil {
+		t.Fatalf("cost estimation failed: %v", err)
+	}
+	if len(costs) != 1 || costs[0].Frozen || costs[0].UnfrozenAt == nil {
+		t.Fatalf("costs %+v, want the unfrozen server", costs)
+	}
+	if math.Abs(costs[0].Saved-cost.Saved) > 0.01 {
+		t.Errorf("saved %.4f after unfreeze, want %.4f", costs[0].Saved, cost.Saved)
+	}
+}
+
+func TestSummarizeCosts(t *testing.T) {
+	running := Costs{Server: 10}
+	costs := []FreezeCost{
+		{Project: "b", Labels: map[string]string{"team": "x"}, Frozen: true, Running: running, Saved: 5},
+		{Project: "a", Labels: map[string]string{"team": "y"}, Frozen: true, Running: running, Saved: 1},
+		{Project: "a", Labels: map[string]string{"team": "x"}, Running: running, Saved: 2},
+		{Project: "a", Labels: map[string]string{"team": "x"}, Frozen: true, Running: running, WhileFrozen: Costs{Snapshot: 1}, Saved: 3},
+	}
+
+	byProject := SummarizeCosts(costs, "")
+	if len(byProject) != 2 || byProject[0].Project != "a" || byProject[0].Frozen != 2 || byProject[0].MonthlySavings != 19 || byProject[0].Saved != 6 {
+		t.Errorf("summaries by project %+v", byProject)
+	}
+	byLabel := SummarizeCosts(costs, "team")
+	if len(byLabel) != 3 || byLabel[0].Label != "x" || byLabel[0].Frozen != 1 || byLabel[0].Saved != 5 || byLabel[1].Label != "y" {
+		t.Errorf("summaries by label %+v", byLabel)
+	}
+}
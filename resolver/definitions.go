@@ -0,0 +1,330 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+	"github.com/samber/lo"
+	"hetzner-freezer/dump"
+)
+
+// serverDefinitions returns the definitions of the firewalls and private
+// networks of the server, in the order the server refers to them.
+func (p *resolverService) serverDefinitions(ctx context.Context, svr *hcloud.Server) ([]schema.Firewall, []schema.Network, error) {
+	var firewalls []schema.Firewall
+	for _, status := range svr.PublicNet.Firewalls {
+		fw, resp, err := p.client.Firewall.GetByID(ctx, status.Firewall.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get firewall %d: %w", status.Firewall.ID, err)
+		}
+		defer resp.Body.Close()
+		if fw == nil {
+			return nil, nil, fmt.Errorf("firewall %d of the server not found", status.Firewall.ID)
+		}
+		firewalls = append(firewalls, hcloud.SchemaFromFirewall(fw))
+	}
+	var networks []schema.Network
+	for _, pNet := range svr.PrivateNet {
+		network, resp, err := p.client.Network.GetByID(ctx, pNet.Network.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get network %d: %w", pNet.Network.ID, err)
+		}
+		defer resp.Body.Close()
+		if network == nil {
+			return nil, nil, fmt.Errorf("network %d of the server not found", pNet.Network.ID)
+		}
+		networks = append(networks, hcloud.SchemaFromNetwork(network))
+	}
+	return firewalls, networks, nil
+}
+
+// resourceLookup finds resources of one kind in a project.
+type resourceLookup struct {
+	kind string
+	// byID returns the name of the resource or false if it does not exist
+	byID func(ctx context.Context, client *hcloud.Client, id int64) (string, bool, error)
+	// byName returns the id of the resource or 0 if it does not exist
+	byName func(ctx context.Context, client *hcloud.Client, name string) (int64, error)
+}
+
+var firewallLookup = resourceLookup{
+	kind: "firewall",
+	byID: func(ctx context.Context, client *hcloud.Client, id int64) (string, bool, error) {
+		fw, resp, err := client.Firewall.GetByID(ctx, id)
+		if err != nil {
+			return "", false, err
+		}
+		defer resp.Body.Close()
+		if fw == nil {
+			return "", false, nil
+		}
+		return fw.Name, true, nil
+	},
+	byName: func(ctx context.Context, client *hcloud.Client, name string) (int64, error) {
+		fw, resp, err := client.Firewall.GetByName(ctx, name)
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+		if fw == nil {
+			return 0, nil
+		}
+		return fw.ID, nil
+	},
+}
+
+var networkLookup = resourceLookup{
+	kind: "network",
+	byID: func(ctx context.Context, client *hcloud.Client, id int64) (string, bool, error) {
+		network, resp, err := client.Network.GetByID(ctx, id)
+		if err != nil {
+			return "", false, err
+		}
+		defer resp.Body.Close()
+		if network == nil {
+			return "", false, nil
+		}
+		return network.Name, true, nil
+	},
+	byName: func(ctx context.Context, client *hcloud.Client, name string) (int64, error) {
+		network, resp, err := client.Network.GetByName(ctx, name)
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+		if network == nil {
+			return 0, nil
+		}
+		return network.ID, nil
+	},
+}
+
+var placementGroupLookup = resourceLookup{
+	kind: "placement group",
+	byID: func(ctx context.Context, client *hcloud.Client, id int64) (string, bool, error) {
+		pg, resp, err := client.PlacementGroup.GetByID(ctx, id)
+		if err != nil {
+			return "", false, err
+		}
+		defer resp.Body.Close()
+		if pg == nil {
+			return "", false, nil
+		}
+		return pg.Name, true, nil
+	},
+	byName: func(ctx context.Context, client *hcloud.Client, name string) (int64, error) {
+		pg, resp, err := client.PlacementGroup.GetByName(ctx, name)
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+		if pg == nil {
+			return 0, nil
+		}
+		return pg.ID, nil
+	},
+}
+
+// resolveID returns the id of the dumped resource in the project of
+// p.client. In the project of the dump it is looked up by id and then by
+// name, in another project only by name; dumps without definitions only
+// know the name the source project has. It returns 0 if the resource is
+// missing and can be created from its definition, and a problem if it
+// cannot.
+func (p *resolverService) resolveID(ctx context.Context, lookup resourceLookup, dumpedID int64, name string, defined bool) (int64, string, error) {
+	if p.source == nil {
+		_, found, err := lookup.byID(ctx, p.client, dumpedID)
+		if err != nil || found {
+			return dumpedID, "", err
+		}
+	} else if len(name) == 0 {
+		sourceName, found, err := lookup.byID(ctx, p.source, dumpedID)
+		if err != nil {
+			return 0, "", err
+		}
+		if !found {
+			return 0, fmt.Sprintf("%s %d no longer exists in the source project, its name is unknown", lookup.kind, dumpedID), nil
+		}
+		name = sourceName
+	}
+	if len(name) > 0 {
+		id, err := lookup.byName(ctx, p.client, name)
+		if err != nil || id != 0 {
+			return id, "", err
+		}
+	}
+	if defined {
+		return 0, "", nil
+	}
+	return 0, fmt.Sprintf("%s %s does not exist", lookup.kind, describeID(name, dumpedID)), nil
+}
+
+// resolveDefinitions translates the firewalls, networks and placement group
+// of the dump into the ids they have in the project of p.client. The ones
+// that are missing get id 0 and are created by the unfreeze from their
+// definitions. It returns problems for missing ones without definition.
+func (p *resolverService) resolveDefinitions(ctx context.Context, serverDump *dump.ServerDump) (*dump.ServerDump, []string, error) {
+	translated := *serverDump
+	var problems []string
+
+	firewalls := serverDump.Server.PublicNet.Firewalls
+	defined := len(serverDump.Firewalls) == len(firewalls)
+	translated.Server.PublicNet.Firewalls = nil
+	translated.Firewalls = nil
+	for i, fw := range firewalls {
+		var def schema.Firewall
+		if defined {
+			def = serverDump.Firewalls[i]
+		}
+		id, problem, err := p.resolveID(ctx, firewallLookup, fw.ID, def.Name, defined)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(problem) > 0 {
+			problems = append(problems, problem)
+			continue
+		}
+		def.ID = id
+		translated.Server.PublicNet.Firewalls = append(translated.Server.PublicNet.Firewalls, schema.ServerFirewall{ID: id, Status: fw.Status})
+		if defined {
+			translated.Firewalls = append(translated.Firewalls, def)
+		}
+	}
+
+	privateNets := serverDump.Server.PrivateNet
+	defined = len(serverDump.Networks) == len(privateNets)
+	translated.Server.PrivateNet = nil
+	translated.Networks = nil
+	for i, pNet := range privateNets {
+		var def schema.Network
+		if defined {
+			def = serverDump.Networks[i]
+		}
+		id, problem, err := p.resolveID(ctx, networkLookup, pNet.Network, def.Name, defined)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(problem) > 0 {
+			problems = append(problems, problem)
+			continue
+		}
+		def.ID = id
+		pNet.Network = id
+		translated.Server.PrivateNet = append(translated.Server.PrivateNet, pNet)
+		if defined {
+			translated.Networks = append(translated.Networks, def)
+		}
+	}
+
+	if dumped := serverDump.Server.PlacementGroup; dumped != nil {
+		id, problem, err := p.resolveID(ctx, placementGroupLookup, dumped.ID, dumped.Name, len(dumped.Type) > 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(problem) > 0 {
+			problems = append(problems, problem)
+			translated.Server.PlacementGroup = nil
+		} else {
+			placementGroup := *dumped
+			placementGroup.ID = id
+			translated.Server.PlacementGroup = &placementGroup
+		}
+	}
+	return &translated, problems, nil
+}
+
+// createFirewall creates the firewall from its definition and sets the id of
+// fw to the one of the created firewall. Rules and label selectors are kept,
+// servers get the firewall when they are created.
+func (p *resolverService) createFirewall(ctx context.Context, def schema.Firewall, fw *hcloud.Firewall) error {
+	id, err := firewallLookup.byName(ctx, p.client, def.Name)
+	if err != nil {
+		return err
+	}
+	if id != 0 {
+		fw.ID = id
+		return nil
+	}
+	p.logger.Infof("create firewall %s", def.Name)
+	dumped := hcloud.FirewallFromSchema(def)
+	res, resp, err := p.client.Firewall.Create(ctx, hcloud.FirewallCreateOpts{
+		Name:   dumped.Name,
+		Labels: dumped.Labels,
+		Rules:  dumped.Rules,
+		ApplyTo: lo.Filter(dumped.AppliedTo, func(item hcloud.FirewallResource, index int) bool {
+			return item.Type == hcloud.FirewallResourceTypeLabelSelector
+		}),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create firewall %s: %w", def.Name, err)
+	}
+	defer resp.Body.Close()
+	for _, action := range res.Actions {
+		if err := p.waitForActionStatus(ctx, action); err != nil {
+			return err
+		}
+	}
+	fw.ID = res.Firewall.ID
+	return nil
+}
+
+// createNetwork creates the network with its subnets and routes from its
+// definition and sets the id of network to the one of the created network.
+func (p *resolverService) createNetwork(ctx context.Context, def schema.Network, network *hcloud.Network) error {
+	id, err := networkLookup.byName(ctx, p.client, def.Name)
+	if err != nil {
+		return err
+	}
+	if id != 0 {
+		network.ID = id
+		return nil
+	}
+	p.logger.Infof("create network %s", def.Name)
+	dumped := hcloud.NetworkFromSchema(def)
+	created, resp, err := p.client.Network.Create(ctx, hcloud.NetworkCreateOpts{
+		Name:                  dumped.Name,
+		IPRange:               dumped.IPRange,
+		Subnets:               dumped.Subnets,
+		Routes:                dumped.Routes,
+		Labels:                dumped.Labels,
+		ExposeRoutesToVSwitch: dumped.ExposeRoutesToVSwitch,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create network %s: %w", def.Name, err)
+	}
+	defer resp.Body.Close()
+	network.ID = created.ID
+	return nil
+}
+
+// createPlacementGroup creates the dumped placement group and sets the id of
+// pg to the one of the created group.
+func (p *resolverService) createPlacementGroup(ctx context.Context, dumped schema.PlacementGroup, pg *hcloud.PlacementGroup) error {
+	id, err := placementGroupLookup.byName(ctx, p.client, dumped.Name)
+	if err != nil {
+		return err
+	}
+	if id != 0 {
+		pg.ID = id
+		return nil
+	}
+	p.logger.Infof("create placement group %s", dumped.Name)
+	res, resp, err := p.client.PlacementGroup.Create(ctx, hcloud.PlacementGroupCreateOpts{
+		Name:   dumped.Name,
+		Labels: dumped.Labels,
+		Type:   hcloud.PlacementGroupType(dumped.Type),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create placement group %s: %w", dumped.Name, err)
+	}
+	defer resp.Body.Close()
+	if res.Action != nil {
+		if err := p.waitForActionStatus(ctx, res.Action); err != nil {
+			return err
+		}
+	}
+	pg.ID = res.PlacementGroup.ID
+	return nil
+}
@@ -0,0 +1,62 @@
+package resolver
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUnfreezeRecreatesMissingDefinitions(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTransferSource(t)
+	svr := fake.Server("web")
+	privateIP := svr.PrivateNet[0].IP
+	fw := fake.Firewall("web")
+	network := fake.Network("backend")
+	pg := svr.PlacementGroup
+
+	dumpID, err := p.FreezeServer(ctx, "web", FreezeOptions{})
+	if err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+	serverDump, err := p.store.Get(ctx, testProject, "web", dumpID)
+	if err != nil {
+		t.Fatalf("could not load dump: %v", err)
+	}
+	if len(serverDump.Firewalls) != 1 || len(serverDump.Firewalls[0].Rules) != 1 {
+		t.Errorf("dump has firewalls %+v, want web with its rule", serverDump.Firewalls)
+	}
+	if len(serverDump.Networks) != 1 || serverDump.Networks[0].IPRange != network.IPRange {
+		t.Errorf("dump has networks %+v, want backend", serverDump.Networks)
+	}
+	fake.DeleteFirewall(fw.ID)
+	fake.DeleteNetwork(network.ID)
+	fake.DeletePlacementGroup(pg.ID)
+
+	if err := p.UnfreezeServer(ctx, "web", "", UnfreezeOptions{}); err != nil {
+		t.Fatalf("unfreeze failed: %v", err)
+	}
+	restored := fake.Server("web")
+	if restored == nil {
+		t.Fatal("server not restored")
+	}
+	recreatedFW := fake.Firewall("web")
+	if recreatedFW == nil || len(recreatedFW.Rules) != 1 || recreatedFW.Rules[0].Port == nil || *recreatedFW.Rules[0].Port != "443" {
+		t.Fatalf("firewall not recreated with its rule: %+v", recreatedFW)
+	}
+	if len(recreatedFW.AppliedTo) != 1 || recreatedFW.AppliedTo[0].LabelSelector == nil || recreatedFW.AppliedTo[0].LabelSelector.Selector != "role=web" {
+		t.Errorf("firewall recreated without its label selector: %+v", recreatedFW.AppliedTo)
+	}
+	if len(restored.PublicNet.Firewalls) != 1 || restored.PublicNet.Firewalls[0].ID != recreatedFW.ID {
+		t.Errorf("server has firewalls %+v, want %d", restored.PublicNet.Firewalls, recreatedFW.ID)
+	}
+	recreatedNet := fake.Network("backend")
+	if recreatedNet == nil || recreatedNet.IPRange != network.IPRange || len(recreatedNet.Subnets) != len(network.Subnets) {
+		t.Fatalf("network not recreated with its subnets: %+v", recreatedNet)
+	}
+	if len(restored.PrivateNet) != 1 || restored.PrivateNet[0].Network != recreatedNet.ID || restored.PrivateNet[0].IP != privateIP {
+		t.Errorf("server has networks %+v, want %s in %d", restored.PrivateNet, privateIP, recreatedNet.ID)
+	}
+	if restored.PlacementGroup == nil || restored.PlacementGroup.Name != pg.Name || restored.PlacementGroup.ID == pg.ID {
+		t.Errorf("server has placement group %+v, want recreated %s", restored.PlacementGroup, pg.Name)
+	}
+}
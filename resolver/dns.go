@@ -0,0 +1,146 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/samber/lo"
+	"hetzner-freezer/dump"
+)
+
+// defaultDNSPtrSuffix ends the reverse dns hetzner sets for new addresses.
+// It names the address, so it is not carried over to a new one.
+const defaultDNSPtrSuffix = ".your-server.de"
+
+// serverReverseDNS returns the reverse dns entries of the primary and floating
+// ips of the server, leaving out the defaults set by hetzner.
+func serverReverseDNS(svr *hcloud.Server, fIPs []*hcloud.FloatingIP) []dump.ReverseDNS {
+	var entries []dump.ReverseDNS
+	add := func(family string, floatingIPID int64, ptrs map[string]string) {
+		ips := lo.Keys(ptrs)
+		sort.Strings(ips)
+		for _, ip := range ips {
+			ptr := ptrs[ip]
+			if len(ptr) == 0 || strings.HasSuffix(ptr, defaultDNSPtrSuffix) {
+				continue
+			}
+			entries = append(entries, dump.ReverseDNS{Family: family, FloatingIPID: floatingIPID, IP: ip, DNSPtr: ptr})
+		}
+	}
+	if !svr.PublicNet.IPv4.IsUnspecified() {
+		add("ipv4", 0, map[string]string{svr.PublicNet.IPv4.IP.String(): svr.PublicNet.IPv4.DNSPtr})
+	}
+	add("ipv6", 0, svr.PublicNet.IPv6.DNSPtr)
+	for _, fIP := range fIPs {
+		add(string(fIP.Type), fIP.ID, fIP.DNSPtr)
+	}
+	return entries
+}
+
+// reverseDNSAddress returns the address of the recreated server the entry
+// applies to. It differs from the dumped one if the primary ip was released,
+// ipv6 addresses then keep their interface id in the new network.
+func reverseDNSAddress(entry dump.ReverseDNS, svr *hcloud.Server) (string, error) {
+	if entry.Family == "ipv4" {
+		if svr.PublicNet.IPv4.IsUnspecified() {
+			return "", fmt.Errorf("server has no ipv4 for the reverse dns of %s", entry.IP)
+		}
+		return svr.PublicNet.IPv4.IP.String(), nil
+	}
+	network := svr.PublicNet.IPv6.Network
+	if svr.PublicNet.IPv6.IsUnspecified() || network == nil || len(network.Mask) != net.IPv6len {
+		return "", fmt.Errorf("server has no ipv6 network for the reverse dns of %s", entry.IP)
+	}
+	ip := net.ParseIP(entry.IP)
+	if ip == nil {
+		return "", fmt.Errorf("invalid ip %s in reverse dns entry", entry.IP)
+	}
+	if network.Contains(ip) {
+		return ip.String(), nil
+	}
+	moved := make(net.IP, net.IPv6len)
+	for i := range moved {
+		moved[i] = network.IP.To16()[i] | ip.To16()[i]&^network.Mask[i]
+	}
+	return moved.String(), nil
+}
+
+// restoreReverseDNS sets the reverse dns of the entry on the recreated server
+// or the floating ip and checks that it took effect.
+func (p *resolverService) restoreReverseDNS(ctx context.Context, entry dump.ReverseDNS, serverID int64) error {
+	ip := entry.IP
+	var current func() (string, error)
+	var change func() (*hcloud.Action, *hcloud.Response, error)
+	if entry.FloatingIPID != 0 {
+		current = func() (string, error) {
+			fIP, resp, err := p.client.FloatingIP.GetByID(ctx, entry.FloatingIPID)
+			if err != nil {
+				return "", err
+			}
+			defer resp.Body.Close()
+			if fIP == nil {
+				return "", fmt.Errorf("floating ip %d not found", entry.FloatingIPID)
+			}
+			return fIP.DNSPtr[ip], nil
+		}
+		change = func() (*hcloud.Action, *hcloud.Response, error) {
+			return p.client.FloatingIP.ChangeDNSPtr(ctx, &hcloud.FloatingIP{ID: entry.FloatingIPID}, ip, &entry.DNSPtr)
+		}
+	} else {
+		getServer := func() (*hcloud.Server, error) {
+			svr, resp, err := p.client.Server.GetByID(ctx, serverID)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+			if svr == nil {
+				return nil, fmt.Errorf("server %d not found", serverID)
+			}
+			return svr, nil
+		}
+		svr, err := getServer()
+		if err != nil {
+			return err
+		}
+		ip, err = reverseDNSAddress(entry, svr)
+		if err != nil {
+			return err
+		}
+		current = func() (string, error) {
+			svr, err := getServer()
+			if err != nil {
+				return "", err
+			}
+			if svr.PublicNet.IPv4.IP.String() == ip {
+				return svr.PublicNet.IPv4.DNSPtr, nil
+			}
+			return svr.PublicNet.IPv6.DNSPtr[ip], nil
+		}
+		change = func() (*hcloud.Action, *hcloud.Response, error) {
+			return p.client.Server.ChangeDNSPtr(ctx, &hcloud.Server{ID: serverID}, ip, &entry.DNSPtr)
+		}
+	}
+	ptr, err := current()
+	if err != nil {
+		return err
+	}
+	if ptr == entry.DNSPtr {
+		return nil
+	}
+	p.logger.Infof("set reverse dns of %s to %s", ip, entry.DNSPtr)
+	if err := p.runAction(ctx, "change reverse dns", change); err != nil {
+		return err
+	}
+	ptr, err = current()
+	if err != nil {
+		return err
+	}
+	if ptr != entry.DNSPtr {
+		return fmt.Errorf("reverse dns of %s is %q after the change, want %q", ip, ptr, entry.DNSPtr)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+func TestUnfreezeRestoresReverseDNS(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	fake.AddServer("web", nil)
+	fIP := fake.AddFloatingIP("198.51.100.10", fake.Server("web").ID)
+	svr, _, err := p.client.Server.GetByName(ctx, "web")
+	if err != nil {
+		t.Fatalf("could not get server: %v", err)
+	}
+	ipv6 := make(net.IP, net.IPv6len)
+	copy(ipv6, svr.PublicNet.IPv6.Network.IP)
+	ipv6[15] = 1
+	ptrs := map[string]string{
+		svr.PublicNet.IPv4.IP.String(): "web.example.com",
+		ipv6.String():                  "web6.example.com",
+	}
+	for ip, ptr := range ptrs {
+		ptr := ptr
+		if err := p.runAction(ctx, "change reverse dns", func() (*hcloud.Action, *hcloud.Response, error) {
+			return p.client.Server.ChangeDNSPtr(ctx, svr, ip, &ptr)
+		}); err != nil {
+			t.Fatalf("could not set reverse dns of %s: %v", ip, err)
+		}
+	}
+	floatingPtr := "www.example.com"
+	if err := p.runAction(ctx, "change reverse dns", func() (*hcloud.Action, *hcloud.Response, error) {
+		return p.client.FloatingIP.ChangeDNSPtr(ctx, &hcloud.FloatingIP{ID: fIP.ID}, fIP.IP, &floatingPtr)
+	}); err != nil {
+		t.Fatalf("could not set reverse dns of floating ip: %v", err)
+	}
+
+	dumpID, err := p.FreezeServer(ctx, "web", FreezeOptions{IPPolicy: IPPolicyRelease})
+	if err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+	serverDump, err := p.store.Get(ctx, testProject, "web", dumpID)
+	if err != nil {
+		t.Fatalf("could not load dump: %v", err)
+	}
+	if len(serverDump.ReverseDNS) != 3 {
+		t.Errorf("dump has reverse dns entries %+v, want 3", serverDump.ReverseDNS)
+	}
+
+	if err := p.UnfreezeServer(ctx, "web", "", UnfreezeOptions{}); err != nil {
+		t.Fatalf("unfreeze failed: %v", err)
+	}
+	restored, _, err := p.client.Server.GetByName(ctx, "web")
+	if err != nil || restored == nil {
+		t.Fatalf("could not get restored server: %v", err)
+	}
+	if restored.PublicNet.IPv4.IP.Equal(svr.PublicNet.IPv4.IP) {
+		t.Fatal("released ipv4 was reused")
+	}
+	if got := restored.PublicNet.IPv4.DNSPtr; got != "web.example.com" {
+		t.Errorf("reverse dns of new ipv4 is %q", got)
+	}
+	movedIPv6 := make(net.IP, net.IPv6len)
+	copy(movedIPv6, restored.PublicNet.IPv6.Network.IP)
+	movedIPv6[15] = 1
+	if got := restored.PublicNet.IPv6.DNSPtr[movedIPv6.String()]; got != "web6.example.com" {
+		t.Errorf("reverse dns of %s is %q, entries %v", movedIPv6, got, restored.PublicNet.IPv6.DNSPtr)
+	}
+	if got := fake.FloatingIP(fIP.ID).DNSPtr; len(got) != 1 || got[0].DNSPtr != floatingPtr {
+		t.Errorf("reverse dns of floating ip is %+v", got)
+	}
+}
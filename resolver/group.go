@@ -0,0 +1,218 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/samber/lo"
+	"hetzner-freezer/dump"
+)
+
+// GroupResult reports the outcome of a freeze or unfreeze of a group of
+// servers.
+type GroupResult struct {
+	GroupID string
+	Servers []ServerResult
+}
+
+type ServerResult struct {
+	ServerName string
+	DumpID     string
+	Err        error
+}
+
+// Err returns the errors of all servers that failed or nil if none did.
+func (r *GroupResult) Err() error {
+	return errors.Join(lo.FilterMap(r.Servers, func(item ServerResult, index int) (error, bool) {
+		if item.Err == nil {
+			return nil, false
+		}
+		return fmt.Errorf("server %s: %w", item.ServerName, item.Err), true
+	})...)
+}
+
+// ServerPlan is the plan of a server of a group, or why it could not be
+// planned.
+type ServerPlan struct {
+	ServerName string
+	Lines      []string
+	Err        error
+}
+
+func (p *resolverService) FreezeGroup(ctx context.Context, selector string, parallelism int, opts FreezeOptions) (*GroupResult, error) {
+	servers, err := p.groupServers(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+	p.logger.Infof("start freezing %d servers matching %s", len(servers), selector)
+	manifest := &dump.GroupManifest{
+		ID:        dump.NewID(),
+		Selector:  selector,
+		CreatedAt: time.Now().UTC(),
+		Servers: lo.Map(servers, func(item *hcloud.Server, index int) dump.GroupMember {
+			return dump.GroupMember{ServerName: item.Name, ServerID: item.ID, Status: dump.StatusPending}
+		}),
+	}
+	// the manifest is written first, so the dumps of servers frozen before
+	// the group freeze died still belong to the group
+	if err := p.store.PutGroup(ctx, p.project, manifest); err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	var putErr error
+	indexes := lo.Range(len(manifest.Servers))
+	results := forEachParallel(ctx, parallelism, indexes, func(ctx context.Context, i int) ServerResult {
+		serverName := manifest.Servers[i].ServerName
+		dumpID, err := p.FreezeServer(ctx, serverName, opts)
+		mu.Lock()
+		defer mu.Unlock()
+		manifest.Servers[i].DumpID = dumpID
+		manifest.Servers[i].Status = dump.StatusComplete
+		if err != nil {
+			manifest.Servers[i].Status = dump.StatusFailed
+			manifest.Servers[i].Error = err.Error()
+		}
+		// a cancelled freeze still records its result
+		if err := p.store.PutGroup(context.WithoutCancel(ctx), p.project, manifest); err != nil {
+			putErr = err
+		}
+		return ServerResult{ServerName: serverName, DumpID: dumpID, Err: err}
+	})
+	if putErr != nil {
+		return nil, putErr
+	}
+	p.logger.Infof("finish freezing group %s", manifest.ID)
+	return &GroupResult{GroupID: manifest.ID, Servers: results}, nil
+}
+
+// PlanFreezeGroup returns the plan of the freeze of each server matching the
+// selector.
+func (p *resolverService) PlanFreezeGroup(ctx context.Context, selector string, opts FreezeOptions) ([]ServerPlan, error) {
+	servers, err := p.groupServers(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+	return lo.Map(servers, func(item *hcloud.Server, index int) ServerPlan {
+		lines, err := p.PlanFreeze(ctx, item.Name, opts)
+		return ServerPlan{ServerName: item.Name, Lines: lines, Err: err}
+	}), nil
+}
+
+// groupServers returns the servers matching the selector.
+func (p *resolverService) groupServers(ctx context.Context, selector string) ([]*hcloud.Server, error) {
+	servers, err := p.client.Server.AllWithOpts(ctx, hcloud.ServerListOpts{
+		ListOpts: hcloud.ListOpts{LabelSelector: selector},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list servers: %w", err)
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no servers match selector %s", selector)
+	}
+	return servers, nil
+}
+
+func (p *resolverService) UnfreezeGroup(ctx context.Context, selector string, groupID string, parallelism int, opts UnfreezeOptions) (*GroupResult, error) {
+	manifest, members, err := p.frozenMembers(ctx, selector, groupID)
+	if err != nil {
+		return nil, err
+	}
+	p.logger.Infof("start unfreezing %d servers of group %s", len(members), manifest.ID)
+	results := forEachParallel(ctx, parallelism, members, func(ctx context.Context, member dump.GroupMember) ServerResult {
+		err := p.UnfreezeServer(ctx, member.ServerName, member.DumpID, opts)
+		return ServerResult{ServerName: member.ServerName, DumpID: member.DumpID, Err: err}
+	})
+	p.logger.Infof("finish unfreezing group %s", manifest.ID)
+	return &GroupResult{GroupID: manifest.ID, Servers: results}, nil
+}
+
+// PlanUnfreezeGroup returns the plan of the unfreeze of each frozen server of
+// the group.
+func (p *resolverService) PlanUnfreezeGroup(ctx context.Context, selector string, groupID string, opts UnfreezeOptions) ([]ServerPlan, error) {
+	_, members, err := p.frozenMembers(ctx, selector, groupID)
+	if err != nil {
+		return nil, err
+	}
+	return lo.Map(members, func(item dump.GroupMember, index int) ServerPlan {
+		lines, err := p.PlanUnfreeze(ctx, item.ServerName, item.DumpID, opts)
+		return ServerPlan{ServerName: item.ServerName, Lines: lines, Err: err}
+	}), nil
+}
+
+// frozenMembers returns the group manifest, the latest of the selector if
+// groupID is empty, and the servers of the group that were frozen.
+func (p *resolverService) frozenMembers(ctx context.Context, selector string, groupID string) (*dump.GroupManifest, []dump.GroupMember, error) {
+	var manifest *dump.GroupManifest
+	var err error
+	if len(groupID) == 0 {
+		manifest, err = p.latestGroup(ctx, selector)
+	} else {
+		manifest, err = p.store.GetGroup(ctx, p.project, groupID)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	members := lo.Filter(manifest.Servers, func(item dump.GroupMember, index int) bool {
+		if item.Status == dump.StatusPending {
+			p.logger.Warnf("skip server %s, its freeze did not finish", item.ServerName)
+			return false
+		}
+		if len(item.DumpID) == 0 {
+			p.logger.Warnf("skip server %s, it was not frozen: %s", item.ServerName, item.Error)
+			return false
+		}
+		return true
+	})
+	return manifest, members, nil
+}
+
+// latestGroup returns the most recent group manifest created for the selector.
+func (p *resolverService) latestGroup(ctx context.Context, selector string) (*dump.GroupManifest, error) {
+	groupIDs, err := p.store.ListGroups(ctx, p.project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	var latest *dump.GroupManifest
+	for _, groupID := range groupIDs {
+		g, err := p.store.GetGroup(ctx, p.project, groupID)
+		if err != nil {
+			return nil, err
+		}
+		if g.Selector != selector {
+			continue
+		}
+		if latest == nil || g.CreatedAt.After(latest.CreatedAt) {
+			latest = g
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("no group frozen with selector %s found", selector)
+	}
+	return latest, nil
+}
+
+// forEachParallel calls fn for every item with at most parallelism calls
+// running at the same time and returns the results in the order of items.
+func forEachParallel[T, R any](ctx context.Context, parallelism int, items []T, fn func(ctx context.Context, item T) R) []R {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	results := make([]R, len(items))
+	sem := make(chan struct{}, parallelism)
+	wg := sync.WaitGroup{}
+	for i, item := range items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, item T) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = fn(ctx, item)
+		}(i, item)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,74 @@
+package resolver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"hetzner-freezer/dump"
+)
+
+func TestFreezeGroupRecordsMemberStatus(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	fake.AddServer("web-1", map[string]string{"env": "test"})
+	fake.AddServer("web-2", map[string]string{"env": "test"})
+	fake.Fail("POST", "/servers/{id}/actions/shutdown", 1, hcloud.ErrorCodeServiceError)
+
+	res, err := p.FreezeGroup(ctx, "env=test", 1, FreezeOptions{})
+	if err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+	if res.Err() == nil {
+		t.Fatal("expected one server to fail")
+	}
+	g, err := p.store.GetGroup(ctx, testProject, res.GroupID)
+	if err != nil {
+		t.Fatalf("could not load group: %v", err)
+	}
+	statuses := map[string]int{}
+	for _, member := range g.Servers {
+		statuses[member.Status]++
+		if member.Status == dump.StatusComplete && len(member.DumpID) == 0 {
+			t.Errorf("frozen server %s has no dump", member.ServerName)
+		}
+		if member.Status == dump.StatusFailed && len(member.Error) == 0 {
+			t.Errorf("failed server %s has no error", member.ServerName)
+		}
+	}
+	if statuses[dump.StatusComplete] != 1 || statuses[dump.StatusFailed] != 1 {
+		t.Errorf("group has statuses %v, want one complete and one failed", statuses)
+	}
+}
+
+func TestPlanGroup(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	fake.AddServer("web-1", map[string]string{"env": "test"})
+	fake.AddServer("web-2", map[string]string{"env": "test"})
+
+	plans, err := p.PlanFreezeGroup(ctx, "env=test", FreezeOptions{})
+	if err != nil {
+		t.Fatalf("could not plan freeze: %v", err)
+	}
+	if len(plans) != 2 || plans[0].Err != nil || plans[1].Err != nil || len(plans[0].Lines) == 0 {
+		t.Fatalf("freeze plans %+v, want one per server", plans)
+	}
+	if fake.Server("web-1") == nil || fake.Server("web-2") == nil {
+		t.Fatal("server deleted by planning a freeze")
+	}
+
+	if _, err := p.FreezeGroup(ctx, "env=test", 2, FreezeOptions{}); err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+	plans, err = p.PlanUnfreezeGroup(ctx, "env=test", "", UnfreezeOptions{})
+	if err != nil {
+		t.Fatalf("could not plan unfreeze: %v", err)
+	}
+	if len(plans) != 2 || plans[0].Err != nil || plans[1].Err != nil || len(plans[0].Lines) == 0 {
+		t.Fatalf("unfreeze plans %+v, want one per server", plans)
+	}
+	if fake.Server("web-1") != nil {
+		t.Error("server created by planning an unfreeze")
+	}
+}
@@ -0,0 +1,153 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+	"github.com/samber/lo"
+	"hetzner-freezer/dump"
+)
+
+// StatusError marks a listed dump that could not be loaded.
+const StatusError = "error"
+
+// DumpInfo summarizes a dump of a server.
+type DumpInfo struct {
+	Project      string    `json:"project"`
+	ServerName   string    `json:"server_name"`
+	DumpID       string    `json:"dump_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Operation    string    `json:"operation"`
+	Status       string    `json:"status"`
+	ServerType   string    `json:"server_type"`
+	Datacenter   string    `json:"datacenter"`
+	SnapshotID   int64     `json:"snapshot_id"`
+	SnapshotSize float32   `json:"snapshot_size_gb"`
+	IPs          []string  `json:"ips"`
+	// ServerExists is nil if it is unknown whether the server exists, i.e.
+	// no hetzner client is configured.
+	ServerExists *bool `json:"server_exists,omitempty"`
+	// Error is why the dump could not be loaded if Status is StatusError.
+	Error string `json:"error,omitempty"`
+}
+
+// ListDumps returns the dumps of the server or of all servers of the project
+// if serverName is empty, oldest first. Dumps that cannot be loaded are
+// listed with StatusError.
+func (p *resolverService) ListDumps(ctx context.Context, serverName string) ([]DumpInfo, error) {
+	serverNames := []string{serverName}
+	if len(serverName) == 0 {
+		var err error
+		serverNames, err = p.store.ListServers(ctx, p.project)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list servers: %w", err)
+		}
+	}
+	var infos []DumpInfo
+	for _, name := range serverNames {
+		var exists *bool
+		if p.client != nil {
+			svr, resp, err := p.client.Server.GetByName(ctx, name)
+			if err != nil {
+				return nil, fmt.Errorf("could not get server %s: %w", name, err)
+			}
+			resp.Body.Close()
+			exists = lo.ToPtr(svr != nil)
+		}
+		dumpIDs, err := p.store.List(ctx, p.project, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list dumps of server %s: %w", name, err)
+		}
+		var serverInfos []DumpInfo
+		for _, dumpID := range dumpIDs {
+			m, err := p.loadManifest(ctx, name, dumpID)
+			if err != nil {
+				serverInfos = append(serverInfos, brokenDump(p.project, name, dumpID, nil, exists, err))
+				continue
+			}
+			serverDump, err := p.store.Get(ctx, p.project, name, dumpID)
+			if err != nil {
+				serverInfos = append(serverInfos, brokenDump(p.project, name, dumpID, m, exists, fmt.Errorf("failed to load server dump: %w", err)))
+				continue
+			}
+			info := DumpInfo{
+				Project:      p.project,
+				ServerName:   name,
+				DumpID:       dumpID,
+				CreatedAt:    m.CreatedAt,
+				Operation:    m.Operation,
+				Status:       m.Status,
+				ServerType:   serverDump.Server.ServerType.Name,
+				Datacenter:   serverDump.Server.Datacenter.Name,
+				SnapshotID:   serverDump.Snapshot.ID,
+				SnapshotSize: p.snapshotSize(ctx, serverDump),
+				IPs:          dumpedIPs(serverDump.Server, serverDump.FloatingIPs),
+				ServerExists: exists,
+			}
+			serverInfos = append(serverInfos, info)
+		}
+		slices.SortFunc(serverInfos, func(a, b DumpInfo) int { return a.CreatedAt.Compare(b.CreatedAt) })
+		infos = append(infos, serverInfos...)
+	}
+	return infos, nil
+}
+
+// snapshotSize returns the size of the snapshot of the dump. Dumps that
+// stored the snapshot before it was created lack it, it is looked up then if a
+// hetzner client is configured.
+func (p *resolverService) snapshotSize(ctx context.Context, serverDump *dump.ServerDump) float32 {
+	if serverDump.Snapshot.ImageSize != nil {
+		return *serverDump.Snapshot.ImageSize
+	}
+	if p.client == nil || serverDump.Snapshot.ID == 0 {
+		return 0
+	}
+	img, resp, err := p.client.Image.GetByID(ctx, serverDump.Snapshot.ID)
+	if err != nil {
+		p.logger.Warnf("could not get size of snapshot %d: %v", serverDump.Snapshot.ID, err)
+		return 0
+	}
+	resp.Body.Close()
+	if img == nil {
+		return 0
+	}
+	return img.ImageSize
+}
+
+// brokenDump returns the info of a dump that could not be loaded, with what
+// its manifest records if it could be loaded.
+func brokenDump(project, serverName, dumpID string, m *dump.Manifest, exists *bool, err error) DumpInfo {
+	info := DumpInfo{
+		Project:      project,
+		ServerName:   serverName,
+		DumpID:       dumpID,
+		Status:       StatusError,
+		ServerExists: exists,
+		Error:        err.Error(),
+	}
+	if m != nil {
+		info.CreatedAt = m.CreatedAt
+		info.Operation = m.Operation
+		info.SnapshotID = m.SnapshotID
+	}
+	return info
+}
+
+// dumpedIPs returns the primary and floating ips the server had when it was
+// dumped.
+func dumpedIPs(svr schema.Server, floatingIPs []schema.FloatingIP) []string {
+	var ips []string
+	if svr.PublicNet.IPv4.ID != 0 {
+		ips = append(ips, svr.PublicNet.IPv4.IP)
+	}
+	if svr.PublicNet.IPv6.ID != 0 {
+		ips = append(ips, svr.PublicNet.IPv6.IP)
+	}
+	for _, fIP := range floatingIPs {
+		ips = append(ips, fIP.IP)
+	}
+	return ips
+}
@@ -0,0 +1,89 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"hetzner-freezer/dump"
+)
+
+// corruptStore fails to load the dump with the id.
+type corruptStore struct {
+	dump.Store
+	dumpID string
+}
+
+func (s *corruptStore) Get(ctx context.Context, project, serverName, dumpID string) (*dump.ServerDump, error) {
+	if dumpID == s.dumpID {
+		return nil, fmt.Errorf("part 'server' is missing: %w", dump.ErrCorrupt)
+	}
+	return s.Store.Get(ctx, project, serverName, dumpID)
+}
+
+func TestListDumpsReportsBrokenDumps(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	fake.AddServer("web", nil)
+	broken, err := p.CreateServerDump(ctx, "web")
+	if err != nil {
+		t.Fatalf("dump failed: %v", err)
+	}
+	if _, err := p.CreateServerDump(ctx, "web"); err != nil {
+		t.Fatalf("dump failed: %v", err)
+	}
+	p.store = &corruptStore{Store: p.store, dumpID: broken}
+
+	infos, err := p.ListDumps(ctx, "web")
+	if err != nil {
+		t.Fatalf("could not list dumps: %v", err)
+	}
+	if len(infos) != 2 || infos[0].DumpID != broken || infos[0].Status != StatusError || len(infos[0].Error) == 0 {
+		t.Fatalf("listed %+v, want the broken dump with an error", infos)
+	}
+	if infos[1].Status != dump.StatusComplete {
+		t.Errorf("intact dump has status %s", infos[1].Status)
+	}
+
+	pruned, err := p.Prune(ctx, "web", PrunePolicy{KeepLast: 1}, true)
+	if err != nil {
+		t.Fatalf("could not prune: %v", err)
+	}
+	if len(pruned) > 0 {
+		t.Errorf("pruned %+v, want the broken dump kept", pruned)
+	}
+}
+
+func TestListDumpsSnapshotSize(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	fake.ActionPolls = 2
+	fake.AddServer("web", nil)
+	dumpID, err := p.CreateServerDump(ctx, "web")
+	if err != nil {
+		t.Fatalf("dump failed: %v", err)
+	}
+	// a dump stored with the size the snapshot had while it was created
+	legacyID := dump.NewID()
+	serverDump, err := p.store.Get(ctx, testProject, "web", dumpID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverDump.Snapshot.ImageSize = nil
+	if err := p.store.Put(ctx, testProject, "web", legacyID, serverDump); err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := p.ListDumps(ctx, "web")
+	if err != nil {
+		t.Fatalf("could not list dumps: %v", err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("listed %+v, want two dumps", infos)
+	}
+	for _, info := range infos {
+		if info.SnapshotSize != 5 {
+			t.Errorf("dump %s has snapshot size %v, want 5", info.DumpID, info.SnapshotSize)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrServerBusy is returned if another operation on the server is running.
+var ErrServerBusy = errors.New("another operation on the server is running")
+
+// serverLocks keeps operations on the same server from running concurrently,
+// for example a scheduled freeze and a group unfreeze.
+type serverLocks struct {
+	mu   sync.Mutex
+	busy map[string]bool
+}
+
+func newServerLocks() *serverLocks {
+	return &serverLocks{busy: map[string]bool{}}
+}
+
+// lock marks the server busy and returns the function that releases it.
+func (l *serverLocks) lock(serverName string) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.busy[serverName] {
+		return nil, fmt.Errorf("server %s: %w", serverName, ErrServerBusy)
+	}
+	l.busy[serverName] = true
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.busy, serverName)
+	}, nil
+}
@@ -0,0 +1,27 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFreezeRejectsBusyServer(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	fake.AddServer("web", nil)
+	unlock, err := p.locks.lock("web")
+	if err != nil {
+		t.Fatalf("could not lock server: %v", err)
+	}
+	if _, err := p.FreezeServer(ctx, "web", FreezeOptions{}); !errors.Is(err, ErrServerBusy) {
+		t.Fatalf("freeze of a busy server returned %v, want %v", err, ErrServerBusy)
+	}
+	if fake.Server("web") == nil {
+		t.Fatal("busy server was deleted")
+	}
+	unlock()
+	if _, err := p.FreezeServer(ctx, "web", FreezeOptions{}); err != nil {
+		t.Errorf("freeze after unlock failed: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package resolver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/samber/lo"
+)
+
+// plan describes the steps in the order they run, marking the ones the
+// journal records as done.
+func plan(j *journal, steps []step) []string {
+	return lo.Map(steps, func(item step, index int) string {
+		line := item.name
+		if len(item.details) > 0 {
+			line = fmt.Sprintf("%s: %s", line, item.details)
+		}
+		if j.done(item.name) {
+			line += " (done)"
+		}
+		return line
+	})
+}
+
+func describeServerCreateOpts(opts hcloud.ServerCreateOpts) string {
+	parts := []string{
+		fmt.Sprintf("type %s", describeServerType(opts.ServerType)),
+		fmt.Sprintf("image %d", opts.Image.ID),
+	}
+	if opts.Datacenter != nil {
+		parts = append(parts, fmt.Sprintf("datacenter %s", describeID(opts.Datacenter.Name, opts.Datacenter.ID)))
+	}
+	if opts.Location != nil {
+		parts = append(parts, fmt.Sprintf("location %s", describeID(opts.Location.Name, opts.Location.ID)))
+	}
+	if opts.PublicNet != nil {
+		if opts.PublicNet.IPv4 != nil {
+			parts = append(parts, fmt.Sprintf("ipv4 %d", opts.PublicNet.IPv4.ID))
+		} else if opts.PublicNet.EnableIPv4 {
+			parts = append(parts, "new ipv4")
+		}
+		if opts.PublicNet.IPv6 != nil {
+			parts = append(parts, fmt.Sprintf("ipv6 %d", opts.PublicNet.IPv6.ID))
+		} else if opts.PublicNet.EnableIPv6 {
+			parts = append(parts, "new ipv6")
+		}
+	}
+	if len(opts.SSHKeys) > 0 {
+		parts = append(parts, fmt.Sprintf("ssh keys %s", strings.Join(lo.Map(opts.SSHKeys, func(item *hcloud.SSHKey, index int) string {
+			return describeID(item.Name, item.ID)
+		}), ",")))
+	}
+	if len(opts.Firewalls) > 0 {
+		parts = append(parts, fmt.Sprintf("firewalls %s", strings.Join(lo.Map(opts.Firewalls, func(item *hcloud.ServerCreateFirewall, index int) string {
+			return describeID(item.Firewall.Name, item.Firewall.ID)
+		}), ",")))
+	}
+	if len(opts.Volumes) > 0 {
+		parts = append(parts, fmt.Sprintf("volumes %s", strings.Join(lo.Map(opts.Volumes, func(item *hcloud.Volume, index int) string {
+			return describeID(item.Name, item.ID)
+		}), ",")))
+	}
+	if opts.PlacementGroup != nil {
+		parts = append(parts, fmt.Sprintf("placement group %s", describeID(opts.PlacementGroup.Name, opts.PlacementGroup.ID)))
+	}
+	if len(opts.UserData) > 0 {
+		parts = append(parts, "cloud init user data")
+	}
+	return strings.Join(parts, ", ")
+}
+
+func describeServerType(serverType *hcloud.ServerType) string {
+	return describeID(serverType.Name, serverType.ID)
+}
+
+// describeID returns the name of a resource if known and its id otherwise.
+func describeID(name string, id int64) string {
+	if len(name) > 0 {
+		return name
+	}
+	return fmt.Sprintf("%d", id)
+}
@@ -0,0 +1,205 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+	"github.com/samber/lo"
+	"hetzner-freezer/dump"
+)
+
+// PreflightError lists every problem found while checking that a server can
+// be unfrozen from a dump.
+type PreflightError struct {
+	Problems []string
+}
+
+func (e *PreflightError) Error() string {
+	return fmt.Sprintf("preflight check found %d problems: %s", len(e.Problems), strings.Join(e.Problems, "; "))
+}
+
+// CheckServer checks that the server can be unfrozen from the dump, or from
+// the latest dump if serverDumpID is empty, without changing anything. It
+// returns a *PreflightError if any referenced resource is missing or unusable.
+func (p *resolverService) CheckServer(ctx context.Context, serverName string, serverDumpID string, opts UnfreezeOptions) error {
+	if len(serverDumpID) == 0 {
+		var err error
+		serverDumpID, err = p.latestServerDumpID(ctx, serverName)
+		if err != nil {
+			return err
+		}
+	}
+	serverDump, err := p.store.Get(ctx, p.project, serverName, serverDumpID)
+	if err != nil {
+		return fmt.Errorf("failed to load server dump: %w", err)
+	}
+	if opts.Target != nil {
+		p = p.inProject(opts.Target)
+	}
+	serverDump, problems, err := p.resolveDump(ctx, serverDump, opts)
+	if err != nil {
+		return err
+	}
+	_, err = p.preflight(ctx, serverDump, opts, problems)
+	return err
+}
+
+type preflightCheck func(ctx context.Context, serverDump *dump.ServerDump, target *unfreezeTarget, opts UnfreezeOptions) ([]string, error)
+
+// preflight resolves the server type and datacenter to unfreeze into and
+// checks the resources of the dump against them. It reports the problems
+// found while resolving the dump together with its own.
+func (p *resolverService) preflight(ctx context.Context, serverDump *dump.ServerDump, opts UnfreezeOptions, problems []string) (*unfreezeTarget, error) {
+	target, found, err := p.resolveTarget(ctx, serverDump, opts)
+	if err != nil {
+		return nil, fmt.Errorf("preflight check failed: %w", err)
+	}
+	problems = append(problems, found...)
+	// the remaining checks still run against the dump to report every problem
+	checkTarget := target
+	if checkTarget == nil {
+		checkTarget = dumpedTarget(serverDump)
+	}
+	checks := []preflightCheck{
+		p.checkServerName,
+		p.checkSnapshot,
+		p.checkPrimaryIPs,
+		p.checkFloatingIPs,
+		p.checkVolumes,
+		p.checkUserData,
+	}
+	for _, check := range checks {
+		found, err := check(ctx, serverDump, checkTarget, opts)
+		if err != nil {
+			return nil, fmt.Errorf("preflight check failed: %w", err)
+		}
+		problems = append(problems, found...)
+	}
+	if len(problems) > 0 {
+		return nil, &PreflightError{Problems: problems}
+	}
+	return target, nil
+}
+
+func (p *resolverService) checkServerName(ctx context.Context, serverDump *dump.ServerDump, _ *unfreezeTarget, _ UnfreezeOptions) ([]string, error) {
+	svr, resp, err := p.client.Server.GetByName(ctx, serverDump.Server.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if svr != nil {
+		return []string{fmt.Sprintf("server with name %s already exists", svr.Name)}, nil
+	}
+	return nil, nil
+}
+
+// checkUserData composes the user data the server is created with, which
+// fails for unsupported user data or if it gets too large.
+func (p *resolverService) checkUserData(_ context.Context, serverDump *dump.ServerDump, _ *unfreezeTarget, opts UnfreezeOptions) ([]string, error) {
+	floatingIPs := lo.Map(serverDump.FloatingIPs, func(item schema.FloatingIP, index int) *hcloud.FloatingIP {
+		return hcloud.FloatingIPFromSchema(item)
+	})
+	if _, err := unfreezeUserData(serverDump, floatingIPs, opts); err != nil {
+		return []string{err.Error()}, nil
+	}
+	return nil, nil
+}
+
+func (p *resolverService) checkSnapshot(ctx context.Context, serverDump *dump.ServerDump, _ *unfreezeTarget, _ UnfreezeOptions) ([]string, error) {
+	// a dump transferred to another project without an image to replace the
+	// snapshot has none, which the transfer reported
+	if serverDump.Snapshot.ID == 0 {
+		return nil, nil
+	}
+	img, resp, err := p.client.Image.GetByID(ctx, serverDump.Snapshot.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if img == nil {
+		return []string{fmt.Sprintf("snapshot %d does not exist", serverDump.Snapshot.ID)}, nil
+	}
+	if img.Status != hcloud.ImageStatusAvailable {
+		return []string{fmt.Sprintf("snapshot %d is %s", img.ID, img.Status)}, nil
+	}
+	return nil, nil
+}
+
+func (p *resolverService) checkPrimaryIPs(ctx context.Context, serverDump *dump.ServerDump, target *unfreezeTarget, _ UnfreezeOptions) ([]string, error) {
+	var problems []string
+	for i, id := range []int64{serverDump.Server.PublicNet.IPv4.ID, serverDump.Server.PublicNet.IPv6.ID} {
+		if id == 0 || releasesIP(serverDump.PrimaryIPs.Policy, ipFamilies[i]) {
+			continue
+		}
+		pIP, resp, err := p.client.PrimaryIP.GetByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		switch {
+		case pIP == nil:
+			problems = append(problems, fmt.Sprintf("primary ip %d does not exist", id))
+		case pIP.AssigneeID != 0:
+			problems = append(problems, fmt.Sprintf("primary ip %s is assigned to %s %d", pIP.IP, pIP.AssigneeType, pIP.AssigneeID))
+		case pIP.Datacenter != nil && pIP.Datacenter.ID != target.datacenter.ID:
+			problems = append(problems, fmt.Sprintf("primary ip %s is in datacenter %s, the server in %s", pIP.IP, pIP.Datacenter.Name, target.datacenter.Name))
+		}
+	}
+	return problems, nil
+}
+
+func (p *resolverService) checkFloatingIPs(ctx context.Context, serverDump *dump.ServerDump, _ *unfreezeTarget, _ UnfreezeOptions) ([]string, error) {
+	var problems []string
+	for _, dumped := range serverDump.FloatingIPs {
+		fIP, resp, err := p.client.FloatingIP.GetByID(ctx, dumped.ID)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		switch {
+		case fIP == nil:
+			problems = append(problems, fmt.Sprintf("floating ip %s does not exist", dumped.IP))
+		case fIP.Server != nil:
+			problems = append(problems, fmt.Sprintf("floating ip %s is assigned to server %d", fIP.IP, fIP.Server.ID))
+		}
+	}
+	return problems, nil
+}
+
+func (p *resolverService) checkVolumes(ctx context.Context, serverDump *dump.ServerDump, target *unfreezeTarget, opts UnfreezeOptions) ([]string, error) {
+	var problems []string
+	for _, dumped := range serverDump.Volumes {
+		if dumped.Archived {
+			vol, resp, err := p.client.Volume.GetByName(ctx, dumped.Name)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+			if vol != nil {
+				problems = append(problems, fmt.Sprintf("volume %s already exists, the archived volume is recreated under its name", dumped.Name))
+			}
+			if len(opts.SSH.User) == 0 || len(opts.SSH.PrivateKeyFile) == 0 {
+				problems = append(problems, fmt.Sprintf("volume %s is archived, restoring it requires an ssh user and private key", dumped.Name))
+			}
+			continue
+		}
+		vol, err := p.resolveVolume(ctx, dumped, opts.VolumesByName)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case vol == nil:
+			problems = append(problems, fmt.Sprintf("volume %s does not exist", volumeName(dumped)))
+		case vol.Server != nil:
+			problems = append(problems, fmt.Sprintf("volume %s is attached to server %d", vol.Name, vol.Server.ID))
+		case vol.Location != nil && target.datacenter.Location != nil && vol.Location.ID != target.datacenter.Location.ID:
+			problems = append(problems, fmt.Sprintf("volume %s is in location %s, the server in %s", vol.Name, vol.Location.Name, target.datacenter.Location.Name))
+		case vol.Size < dumped.Size:
+			problems = append(problems, fmt.Sprintf("volume %s has %d GB, the dump recorded %d GB", vol.Name, vol.Size, dumped.Size))
+		}
+	}
+	return problems, nil
+}
@@ -0,0 +1,74 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"hetzner-freezer/dump"
+)
+
+// ipFamilies are the families of the primary ips of a server.
+var ipFamilies = []string{"ipv4", "ipv6"}
+
+// releasesIP reports whether the primary ip policy deletes the primary ip of
+// the family.
+func releasesIP(policy string, family string) bool {
+	switch policy {
+	case IPPolicyRelease:
+		return true
+	case IPPolicyKeepIPv4:
+		return family == "ipv6"
+	}
+	return false
+}
+
+// deletePrimaryIPStep deletes a primary ip the policy releases. It cannot be
+// undone, the address is gone for good. It runs after the server is deleted, so
+// a failure does not roll the freeze back, a rerun releases the ip.
+func (p *resolverService) deletePrimaryIPStep(svr *hcloud.Server, family string, primaryIPID int64) step {
+	return step{
+		name:    fmt.Sprintf("delete %s of server %s", family, svr.Name),
+		details: "unfreeze assigns a new address",
+		do: func(ctx context.Context) error {
+			pIP, resp, err := p.client.PrimaryIP.GetByID(ctx, primaryIPID)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if pIP == nil {
+				return nil
+			}
+			p.logger.Warnf("release %s %s of server %s, dns records pointing to it need updating after unfreeze", family, pIP.IP, svr.Name)
+			resp, err = p.client.PrimaryIP.Delete(ctx, pIP)
+			if err != nil && !hcloud.IsError(err, hcloud.ErrorCodeNotFound) {
+				return fmt.Errorf("failed to delete primary ip %s, rerun the freeze to release it: %w", pIP.IP, err)
+			}
+			if resp != nil {
+				defer resp.Body.Close()
+			}
+			return nil
+		},
+	}
+}
+
+// reportNewAddresses warns about the addresses that replace the released
+// primary ips of the dump, so dns records can be updated.
+func (p *resolverService) reportNewAddresses(ctx context.Context, serverDump *dump.ServerDump, serverID int64) error {
+	svr, resp, err := p.client.Server.GetByID(ctx, serverID)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if svr == nil {
+		return fmt.Errorf("server %d not found", serverID)
+	}
+	dumped := serverDump.Server.PublicNet
+	if dumped.IPv4.ID != 0 && releasesIP(serverDump.PrimaryIPs.Policy, "ipv4") {
+		p.logger.Warnf("ipv4 of server %s changed from %s to %s, update dns records pointing to %s", svr.Name, dumped.IPv4.IP, svr.PublicNet.IPv4.IP, dumped.IPv4.IP)
+	}
+	if dumped.IPv6.ID != 0 && releasesIP(serverDump.PrimaryIPs.Policy, "ipv6") {
+		p.logger.Warnf("ipv6 network of server %s changed from %s to %s, update dns records pointing to %s", svr.Name, dumped.IPv6.IP, svr.PublicNet.IPv6.Network, dumped.IPv6.IP)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+func TestFreezeReleasesPrimaryIPs(t *testing.T) {
+	tests := []struct {
+		policy   string
+		keepIPv4 bool
+		keepIPv6 bool
+	}{
+		{policy: IPPolicyKeep, keepIPv4: true, keepIPv6: true},
+		{policy: IPPolicyRelease},
+		{policy: IPPolicyKeepIPv4, keepIPv4: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			ctx := context.Background()
+			fake, p := newTestResolver(t)
+			svr := fake.AddServer("web", nil)
+			ipv4, ipv6 := svr.PublicNet.IPv4.ID, svr.PublicNet.IPv6.ID
+
+			dumpID, err := p.FreezeServer(ctx, "web", FreezeOptions{IPPolicy: tt.policy})
+			if err != nil {
+				t.Fatalf("freeze failed: %v", err)
+			}
+			if kept := fake.PrimaryIP(ipv4) != nil; kept != tt.keepIPv4 {
+				t.Errorf("ipv4 kept %t, want %t", kept, tt.keepIPv4)
+			}
+			if kept := fake.PrimaryIP(ipv6) != nil; kept != tt.keepIPv6 {
+				t.Errorf("ipv6 kept %t, want %t", kept, tt.keepIPv6)
+			}
+			serverDump, err := p.store.Get(ctx, testProject, "web", dumpID)
+			if err != nil {
+				t.Fatalf("could not load dump: %v", err)
+			}
+			if serverDump.PrimaryIPs.Policy != tt.policy {
+				t.Errorf("dump recorded policy %q", serverDump.PrimaryIPs.Policy)
+			}
+
+			if err := p.UnfreezeServer(ctx, "web", "", UnfreezeOptions{}); err != nil {
+				t.Fatalf("unfreeze failed: %v", err)
+			}
+			restored := fake.Server("web")
+			if restored == nil {
+				t.Fatal("server not restored")
+			}
+			if reused := restored.PublicNet.IPv4.ID == ipv4; reused != tt.keepIPv4 {
+				t.Errorf("ipv4 %d reused %t, want %t", restored.PublicNet.IPv4.ID, reused, tt.keepIPv4)
+			}
+			if reused := restored.PublicNet.IPv6.ID == ipv6; reused != tt.keepIPv6 {
+				t.Errorf("ipv6 %d reused %t, want %t", restored.PublicNet.IPv6.ID, reused, tt.keepIPv6)
+			}
+			if restored.PublicNet.IPv4.ID == 0 || restored.PublicNet.IPv6.ID == 0 {
+				t.Errorf("restored server lacks primary ips: %+v", restored.PublicNet)
+			}
+		})
+	}
+}
+
+func TestFreezeResumesFailedRelease(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	svr := fake.AddServer("web", nil)
+	ipv4, ipv6 := svr.PublicNet.IPv4.ID, svr.PublicNet.IPv6.ID
+	fake.Fail("DELETE", "/primary_ips/{id}", 1, hcloud.ErrorCodeServiceError)
+
+	_, err := p.FreezeServer(ctx, "web", FreezeOptions{IPPolicy: IPPolicyRelease})
+	var incErr *IncompleteError
+	if !errors.As(err, &incErr) {
+		t.Fatalf("freeze returned %v, want an incomplete error", err)
+	}
+	if incErr.Step != "delete ipv4 of server web" {
+		t.Errorf("failed step is %q", incErr.Step)
+	}
+	if fake.PrimaryIP(ipv4) == nil {
+		t.Fatal("ipv4 released despite the failure")
+	}
+
+	if _, err := p.FreezeServer(ctx, "web", FreezeOptions{IPPolicy: IPPolicyRelease}); err != nil {
+		t.Fatalf("resumed freeze failed: %v", err)
+	}
+	if fake.PrimaryIP(ipv4) != nil || fake.PrimaryIP(ipv6) != nil {
+		t.Error("primary ips not released by the resumed freeze")
+	}
+	if j, _ := p.store.LoadJournal(ctx, testProject, "web"); j != nil {
+		t.Errorf("journal left after resumed freeze: %+v", j)
+	}
+}
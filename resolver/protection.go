@@ -0,0 +1,83 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// liftProtectionStep lifts the protection of a server that freeze was forced
+// to delete. Rolling back restores it.
+func (p *resolverService) liftProtectionStep(svr *hcloud.Server, protection hcloud.ServerProtection) step {
+	return step{
+		name:    fmt.Sprintf("lift protection of server %s", svr.Name),
+		details: fmt.Sprintf("forced, the dump keeps delete %t, rebuild %t for unfreeze", protection.Delete, protection.Rebuild),
+		do: func(ctx context.Context) error {
+			p.logger.Warnf("lift protection of server %s to delete it", svr.Name)
+			return p.setProtection(ctx, svr.ID, hcloud.ServerProtection{})
+		},
+		undo: func(ctx context.Context) error {
+			return p.setProtection(ctx, svr.ID, protection)
+		},
+	}
+}
+
+// setProtection changes the delete and rebuild protection of the server
+// unless it already has it, and checks that the change took effect.
+func (p *resolverService) setProtection(ctx context.Context, serverID int64, protection hcloud.ServerProtection) error {
+	current := func() (*hcloud.Server, error) {
+		svr, resp, err := p.client.Server.GetByID(ctx, serverID)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if svr == nil {
+			return nil, fmt.Errorf("server %d not found", serverID)
+		}
+		return svr, nil
+	}
+	svr, err := current()
+	if err != nil {
+		return err
+	}
+	if svr.Protection == protection {
+		return nil
+	}
+	err = p.runAction(ctx, "change protection", func() (*hcloud.Action, *hcloud.Response, error) {
+		return p.client.Server.ChangeProtection(ctx, svr, hcloud.ServerChangeProtectionOpts{
+			Delete:  &protection.Delete,
+			Rebuild: &protection.Rebuild,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	svr, err = current()
+	if err != nil {
+		return err
+	}
+	if svr.Protection != protection {
+		return fmt.Errorf("server %s has protection delete %t, rebuild %t after the change", svr.Name, svr.Protection.Delete, svr.Protection.Rebuild)
+	}
+	return nil
+}
+
+// enableBackups enables hetzner backups of the server unless they are on.
+func (p *resolverService) enableBackups(ctx context.Context, serverID int64) error {
+	svr, resp, err := p.client.Server.GetByID(ctx, serverID)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if svr == nil {
+		return fmt.Errorf("server %d not found", serverID)
+	}
+	if len(svr.BackupWindow) > 0 {
+		return nil
+	}
+	p.logger.Infof("enable backups of server %s", svr.Name)
+	return p.runAction(ctx, "enable backups", func() (*hcloud.Action, *hcloud.Response, error) {
+		return p.client.Server.EnableBackup(ctx, svr, "")
+	})
+}
@@ -0,0 +1,52 @@
+package resolver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+func TestFreezeProtectedServer(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	fake.AddServer("web", nil)
+	svr, _, err := p.client.Server.GetByName(ctx, "web")
+	if err != nil {
+		t.Fatalf("could not get server: %v", err)
+	}
+	if err := p.setProtection(ctx, svr.ID, hcloud.ServerProtection{Delete: true, Rebuild: true}); err != nil {
+		t.Fatalf("could not protect server: %v", err)
+	}
+	if err := p.enableBackups(ctx, svr.ID); err != nil {
+		t.Fatalf("could not enable backups: %v", err)
+	}
+
+	if _, err := p.FreezeServer(ctx, "web", FreezeOptions{}); err == nil {
+		t.Fatal("freeze of protected server succeeded without force")
+	}
+	if got := fake.Server("web"); got == nil || got.Status != string(hcloud.ServerStatusRunning) {
+		t.Error("protected server not left running")
+	}
+
+	if _, err := p.FreezeServer(ctx, "web", FreezeOptions{Force: true}); err != nil {
+		t.Fatalf("forced freeze failed: %v", err)
+	}
+	if fake.Server("web") != nil {
+		t.Fatal("server still exists after forced freeze")
+	}
+
+	if err := p.UnfreezeServer(ctx, "web", "", UnfreezeOptions{}); err != nil {
+		t.Fatalf("unfreeze failed: %v", err)
+	}
+	restored := fake.Server("web")
+	if restored == nil {
+		t.Fatal("server not restored")
+	}
+	if !restored.Protection.Delete || !restored.Protection.Rebuild {
+		t.Errorf("restored server has protection %+v", restored.Protection)
+	}
+	if restored.BackupWindow == nil {
+		t.Error("backups not enabled on restored server")
+	}
+}
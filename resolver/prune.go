@@ -0,0 +1,101 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/samber/lo"
+	"hetzner-freezer/dump"
+)
+
+// PrunePolicy decides which dumps are kept. A dump is kept if any of the
+// policies keeps it.
+type PrunePolicy struct {
+	// KeepLast keeps the latest n dumps of every server.
+	KeepLast int
+	// KeepWithin keeps dumps newer than the duration.
+	KeepWithin time.Duration
+	// KeepFrozen keeps the dump a frozen server would be unfrozen from.
+	KeepFrozen bool
+}
+
+// Prune deletes the dumps of the server, or of all servers of the project if
+// serverName is empty, that the policy does not keep, together with their
+// snapshots. With dryRun nothing is deleted. It returns the pruned dumps.
+func (p *resolverService) Prune(ctx context.Context, serverName string, policy PrunePolicy, dryRun bool) ([]DumpInfo, error) {
+	if policy.KeepLast <= 0 && policy.KeepWithin <= 0 {
+		return nil, errors.New("prune needs a keep last or keep within policy")
+	}
+	infos, err := p.ListDumps(ctx, serverName)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		if info.Status == StatusError {
+			p.logger.Warnf("keep dump %s of server %s, it could not be loaded: %s", info.DumpID, info.ServerName, info.Error)
+		}
+	}
+	var pruned []DumpInfo
+	for name, serverInfos := range lo.GroupBy(infos, func(item DumpInfo) string { return item.ServerName }) {
+		j, err := p.store.LoadJournal(ctx, p.project, name)
+		if err != nil {
+			return pruned, err
+		}
+		for _, info := range p.selectPrunable(serverInfos, policy) {
+			if j != nil && j.DumpID == info.DumpID {
+				// used by an unfinished freeze or unfreeze
+				continue
+			}
+			if dryRun {
+				p.logger.Infof("would remove dump %s of server %s and snapshot %d", info.DumpID, info.ServerName, info.SnapshotID)
+				pruned = append(pruned, info)
+				continue
+			}
+			p.logger.Infof("remove dump %s of server %s and snapshot %d", info.DumpID, info.ServerName, info.SnapshotID)
+			if err := p.deleteServerDump(ctx, info.ServerName, info.DumpID); err != nil {
+				return pruned, fmt.Errorf("failed to remove dump %s of server %s: %w", info.DumpID, info.ServerName, err)
+			}
+			pruned = append(pruned, info)
+		}
+	}
+	return pruned, nil
+}
+
+// selectPrunable returns the dumps of a single server, sorted oldest first,
+// that the policy does not keep.
+func (p *resolverService) selectPrunable(infos []DumpInfo, policy PrunePolicy) []DumpInfo {
+	keep := make(map[string]bool)
+	completed := lo.Filter(infos, func(item DumpInfo, index int) bool {
+		// dumps of unfinished freezes are always kept
+		if item.Status != dump.StatusComplete {
+			keep[item.DumpID] = true
+			return false
+		}
+		return true
+	})
+	if policy.KeepLast > 0 {
+		for _, info := range lo.Subset(completed, -policy.KeepLast, uint(policy.KeepLast)) {
+			keep[info.DumpID] = true
+		}
+	}
+	if policy.KeepWithin > 0 {
+		for _, info := range completed {
+			if time.Since(info.CreatedAt) < policy.KeepWithin {
+				keep[info.DumpID] = true
+			}
+		}
+	}
+	if policy.KeepFrozen {
+		// dumps created before manifests existed may come from a freeze too
+		freezes := lo.Filter(completed, func(item DumpInfo, index int) bool { return item.Operation != dump.OperationDump })
+		if len(freezes) > 0 {
+			frozen := freezes[len(freezes)-1]
+			if frozen.ServerExists == nil || !*frozen.ServerExists {
+				keep[frozen.DumpID] = true
+			}
+		}
+	}
+	return lo.Filter(infos, func(item DumpInfo, index int) bool { return !keep[item.DumpID] })
+}
@@ -0,0 +1,166 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const defaultSSHPort = 22
+
+// SSHOptions configure how the freezer logs into servers to archive and
+// restore volume data.
+type SSHOptions struct {
+	User           string
+	PrivateKeyFile string
+	// KnownHostsFile verifies host keys, empty means ~/.ssh/known_hosts.
+	KnownHostsFile string
+	// InsecureIgnoreHostKey does not verify host keys, so the volume data may
+	// go to and come from any host answering on the address of the server.
+	InsecureIgnoreHostKey bool
+	Port                  int
+}
+
+// remote runs shell commands on a server.
+type remote interface {
+	run(ctx context.Context, command string, stdin io.Reader, stdout io.Writer) error
+	close() error
+}
+
+type dialFunc func(ctx context.Context, host string, opts SSHOptions) (remote, error)
+
+// dialServer connects to the server, retrying until it accepts connections,
+// since a server that just booted takes a while to start sshd.
+func (p *resolverService) dialServer(ctx context.Context, host string, opts SSHOptions) (remote, error) {
+	if len(host) == 0 {
+		return nil, errors.New("server has no public ipv4 to connect to")
+	}
+	if len(opts.User) == 0 || len(opts.PrivateKeyFile) == 0 {
+		return nil, errors.New("ssh user and private key are required to access volume data")
+	}
+	ticker := time.NewTicker(p.pollInterval)
+	defer ticker.Stop()
+	deadline := time.After(pollingDeadline)
+	for {
+		r, err := p.dial(ctx, host, opts)
+		if err == nil {
+			return r, nil
+		}
+		p.logger.Infof("wait for ssh on %s: %v", host, err)
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return nil, fmt.Errorf("could not connect to %s: %w", host, err)
+		case <-ctx.Done():
+			return nil, fmt.Errorf("connect to %s was cancelled: %w", host, ctx.Err())
+		}
+	}
+}
+
+// hostKeyCallback verifies host keys with the known hosts file unless they
+// are explicitly not verified.
+func hostKeyCallback(opts SSHOptions) (ssh.HostKeyCallback, error) {
+	if opts.InsecureIgnoreHostKey {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	file := opts.KnownHostsFile
+	if len(file) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find known hosts: %w", err)
+		}
+		file = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	callback, err := knownhosts.New(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known hosts, host keys are only skipped explicitly: %w", err)
+	}
+	return callback, nil
+}
+
+func dialSSH(ctx context.Context, host string, opts SSHOptions) (remote, error) {
+	key, err := os.ReadFile(opts.PrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ssh private key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ssh private key: %w", err)
+	}
+	callback, err := hostKeyCallback(opts)
+	if err != nil {
+		return nil, err
+	}
+	port := opts.Port
+	if port == 0 {
+		port = defaultSSHPort
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	conn, err := (&net.Dialer{Timeout: 30 * time.Second}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+		User:            opts.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: callback,
+		Timeout:         30 * time.Second,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &sshRemote{client: ssh.NewClient(c, chans, reqs), sudo: opts.User != "root"}, nil
+}
+
+type sshRemote struct {
+	client *ssh.Client
+	sudo   bool
+}
+
+func (r *sshRemote) run(ctx context.Context, command string, stdin io.Reader, stdout io.Writer) error {
+	session, err := r.client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to open ssh session: %w", err)
+	}
+	defer session.Close()
+	var stderr bytes.Buffer
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = &stderr
+	if r.sudo {
+		command = "sudo -n sh -c " + shellQuote(command)
+	}
+	done := make(chan error, 1)
+	go func() { done <- session.Run(command) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("remote command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	case <-ctx.Done():
+		_ = session.Signal(ssh.SIGKILL)
+		return ctx.Err()
+	}
+}
+
+func (r *sshRemote) close() error {
+	return r.client.Close()
+}
+
+// shellQuote quotes s as a single word for sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -11,8 +11,6 @@ import (
 	"hetzner-freezer/dump"
 	"net"
 	"os"
-	"path/filepath"
-	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -21,274 +19,1014 @@ import (
 const pollingInterval = 5 * time.Second
 const pollingDeadline = 10 * time.Minute
 
-const cloudInitContent = `ip addr add 0.0.0.0/32 dev eth0`
+// dumpLabel labels the snapshot of a dump with the dump id.
+const dumpLabel = "hetzner-freezer/dump"
+
+// Version of the tool recorded in dump manifests, set at build time with
+// -ldflags "-X hetzner-freezer/resolver.Version=...".
+var Version = "dev"
 
 type Resolver interface {
 	CreateServerDump(ctx context.Context, serverName string) (string, error)
-	FreezeServer(ctx context.Context, serverName string) (string, error)
-	UnfreezeServer(ctx context.Context, serverName string, serverDumpID string) error
+	FreezeServer(ctx context.Context, serverName string, opts FreezeOptions) (string, error)
+	UnfreezeServer(ctx context.Context, serverName string, serverDumpID string, opts UnfreezeOptions) error
+	FreezeGroup(ctx context.Context, selector string, parallelism int, opts FreezeOptions) (*GroupResult, error)
+	UnfreezeGroup(ctx context.Context, selector string, groupID string, parallelism int, opts UnfreezeOptions) (*GroupResult, error)
+	AutoFreeze(ctx context.Context, opts AutoFreezeOptions) (*AutoFreezeReport, error)
+	ListDumps(ctx context.Context, serverName string) ([]DumpInfo, error)
+	FreezeCosts(ctx context.Context, serverName string, pricing hcloud.Pricing) ([]FreezeCost, error)
+	Prune(ctx context.Context, serverName string, policy PrunePolicy, dryRun bool) ([]DumpInfo, error)
+	CheckServer(ctx context.Context, serverName string, serverDumpID string, opts UnfreezeOptions) error
+	PlanServerDump(ctx context.Context, serverName string) ([]string, error)
+	PlanFreeze(ctx context.Context, serverName string, opts FreezeOptions) ([]string, error)
+	PlanUnfreeze(ctx context.Context, serverName string, serverDumpID string, opts UnfreezeOptions) ([]string, error)
+	PlanFreezeGroup(ctx context.Context, selector string, opts FreezeOptions) ([]ServerPlan, error)
+	PlanUnfreezeGroup(ctx context.Context, selector string, groupID string, opts UnfreezeOptions) ([]ServerPlan, error)
+}
+
+const (
+	// VolumeModeKeep detaches the volumes of a frozen server and keeps them.
+	VolumeModeKeep = "keep"
+	// VolumeModeArchive copies the data of the volumes into the dump and
+	// deletes them, unfreeze recreates them from the archives.
+	VolumeModeArchive = "archive"
+)
+
+const (
+	// IPPolicyKeep unassigns the primary ips of a frozen server and keeps
+	// them, so it gets its addresses back.
+	IPPolicyKeep = "keep"
+	// IPPolicyRelease deletes the primary ips of a frozen server, unfreeze
+	// creates new ones.
+	IPPolicyRelease = "release"
+	// IPPolicyKeepIPv4 keeps the primary ipv4 and releases the ipv6.
+	IPPolicyKeepIPv4 = "keep-ipv4"
+)
+
+// FreezeOptions control how a server is frozen.
+type FreezeOptions struct {
+	// VolumeMode is VolumeModeKeep or VolumeModeArchive, empty means keep.
+	VolumeMode string
+	// IPPolicy is IPPolicyKeep, IPPolicyRelease or IPPolicyKeepIPv4, empty
+	// means keep.
+	IPPolicy string
+	// SSH is used to archive volume data.
+	SSH SSHOptions
+	// Force lifts the delete and rebuild protection of a protected server to
+	// delete it. Unfreeze restores the protection.
+	Force bool
+	// SSHKeys are the names of the ssh keys of the server. If empty, the keys
+	// labeled with the server name or the keys of the previous dump are used.
+	SSHKeys []string
+	// UserDataFile is a file with the cloud-init user data the server was
+	// created with. If empty, the user data of the previous dump is used.
+	UserDataFile string
+}
+
+// UnfreezeOptions control how a server is recreated from its dump.
+type UnfreezeOptions struct {
+	// VolumesByName attaches volumes that no longer exist under their dumped
+	// id to the volume with the same name.
+	VolumesByName bool
+	// SSH is used to restore archived volume data.
+	SSH SSHOptions
+	// ServerType replaces the server type of the dump.
+	ServerType string
+	// Datacenter or Location replace the datacenter of the dump. With a
+	// location any of its datacenters offering the server type is used.
+	Datacenter string
+	Location   string
+	// FallbackServerTypes are tried in order if the server type does not fit
+	// the snapshot or is unavailable.
+	FallbackServerTypes []string
+	// Target is a client of another project to unfreeze into, nil unfreezes
+	// into the project of the dump. Resources are mapped by name.
+	Target *hcloud.Client
+	// TargetImage is the image, by id or name, the server is created from
+	// in the target project, since snapshots cannot be transferred.
+	TargetImage string
+	// UserDataFile is a file with cloud-init user data that replaces the
+	// one of the dump.
+	UserDataFile string
+	// NetworkRenderer is cloudinit.RendererNetplan or
+	// cloudinit.RendererNetworkd, the config the floating ips are persisted
+	// in. Empty means netplan.
+	NetworkRenderer string
 }
 
 type resolverService struct {
-	project   string
-	directory string
-	client    *hcloud.Client
-	logger    *logrus.Logger
+	project string
+	store   dump.Store
+	client  *hcloud.Client
+	logger  *logrus.Logger
+	// pollInterval is how often running actions are polled
+	pollInterval time.Duration
+	// dial connects to servers to archive and restore volume data
+	dial dialFunc
+	// source is the client of the project of the dumps when unfreezing into
+	// another project, nil otherwise
+	source *hcloud.Client
+	// locks are shared by the copies of p
+	locks *serverLocks
 }
 
-func (p *resolverService) UnfreezeServer(ctx context.Context, serverName string, serverDumpID string) error {
-	if len(serverDumpID) == 0 {
-		// find latest dump from directory
-		path := dump.NewServerPath(p.directory, p.project, serverName)
-		dirNames, err := GetDirectoriesNames(path)
-		if err != nil {
-			return fmt.Errorf("failed to get directories: %w", err)
+func (p *resolverService) UnfreezeServer(ctx context.Context, serverName string, serverDumpID string, opts UnfreezeOptions) error {
+	unlock, err := p.locks.lock(serverName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	j, steps, err := p.prepareUnfreeze(ctx, serverName, serverDumpID, opts)
+	if err != nil {
+		return err
+	}
+	if len(j.entry.Steps) > 0 {
+		p.logger.Infof("resume unfreezing server from dump %s", j.entry.DumpID)
+	} else {
+		p.logger.Infof("start unfreezing server from dump %s", j.entry.DumpID)
+	}
+	if err := newTransaction(p.logger, j).run(ctx, steps); err != nil {
+		return fmt.Errorf("%w; rerun unfreeze to resume", err)
+	}
+	p.logger.Infof("finish unfreezing server")
+	return nil
+}
+
+func (p *resolverService) PlanUnfreeze(ctx context.Context, serverName string, serverDumpID string, opts UnfreezeOptions) ([]string, error) {
+	j, steps, err := p.prepareUnfreeze(ctx, serverName, serverDumpID, opts)
+	if err != nil {
+		return nil, err
+	}
+	return plan(j, steps), nil
+}
+
+// prepareUnfreeze resolves the dump and returns the steps that recreate the
+// server from it, without changing anything.
+func (p *resolverService) prepareUnfreeze(ctx context.Context, serverName string, serverDumpID string, opts UnfreezeOptions) (*journal, []step, error) {
+	if opts.Target != nil {
+		target := opts.Target
+		opts.Target = nil
+		return p.inProject(target).prepareUnfreeze(ctx, serverName, serverDumpID, opts)
+	}
+	j, err := p.loadJournal(ctx, serverName, dump.OperationUnfreeze)
+	if err != nil {
+		return nil, nil, err
+	}
+	if j != nil {
+		if len(serverDumpID) > 0 && serverDumpID != j.entry.DumpID {
+			return nil, nil, fmt.Errorf("unfinished unfreeze of server %s from dump %s found, rerun it without a different dump id", serverName, j.entry.DumpID)
 		}
-		dirNamesNums := lo.Map(dirNames, func(item string, index int) int {
-			num, err := strconv.Atoi(item)
+		serverDumpID = j.entry.DumpID
+	} else {
+		if len(serverDumpID) == 0 {
+			serverDumpID, err = p.latestServerDumpID(ctx, serverName)
 			if err != nil {
-				return 0
+				return nil, nil, err
 			}
-			return num
-		})
-		if len(dirNamesNums) == 0 {
-			return errors.New("no dumps found. please create a dump first running 'freeze' command")
 		}
-		slices.Sort(dirNamesNums)
-		serverDumpID = strconv.Itoa(dirNamesNums[len(dirNamesNums)-1])
+		j = p.newJournal(serverName, &dump.Journal{Operation: dump.OperationUnfreeze, DumpID: serverDumpID})
 	}
-	p.logger.Infof("start unfreezing server from dump %s", serverDumpID)
-	path := dump.NewServerDumpPath(p.directory, p.project, serverName, serverDumpID)
-	_, err := os.Stat(path)
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
-		return fmt.Errorf("could not stat dir %s: %w", path, err)
+	serverDump, err := p.store.Get(ctx, p.project, serverName, serverDumpID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load server dump: %w", err)
 	}
-	serverDump, err := dump.LoadServer(path)
+	serverDump, problems, err := p.resolveDump(ctx, serverDump, opts)
 	if err != nil {
-		return fmt.Errorf("failed to load server dump: %w", err)
+		return nil, nil, err
+	}
+	var target *unfreezeTarget
+	if len(j.entry.Steps) == 0 {
+		p.logger.Infof("check resources referenced by dump %s", serverDumpID)
+		target, err = p.preflight(ctx, serverDump, opts, problems)
+		if err != nil {
+			return nil, nil, err
+		}
+		j.entry.ServerType = target.serverType.Name
+		j.entry.Datacenter = target.datacenter.Name
+	} else {
+		if len(problems) > 0 {
+			return nil, nil, &PreflightError{Problems: problems}
+		}
+		target, err = p.journalTarget(ctx, j, serverDump)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	var svr *hcloud.Server
+	if j.entry.ServerID != 0 {
+		var resp *hcloud.Response
+		svr, resp, err = p.client.Server.GetByID(ctx, j.entry.ServerID)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer resp.Body.Close()
+		if svr == nil {
+			return nil, nil, fmt.Errorf("server %d created by the unfinished unfreeze no longer exists, remove the journal of server %s to start over", j.entry.ServerID, serverName)
+		}
 	}
 	p.logger.Infof("create cloud init config for server")
 	var floatingIPs []*hcloud.FloatingIP
 	for _, fIP := range serverDump.FloatingIPs {
 		fIP, resp, err := p.client.FloatingIP.GetByID(ctx, fIP.ID)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 		defer resp.Body.Close()
 		if resp.StatusCode > 201 {
-			return fmt.Errorf("could not get floating ip: status %d ", resp.StatusCode)
+			return nil, nil, fmt.Errorf("could not get floating ip: status %d ", resp.StatusCode)
 		}
 		floatingIPs = append(floatingIPs, fIP)
 	}
-	floatingIPsStrs := lo.Map(floatingIPs, func(item *hcloud.FloatingIP, index int) string { return fmt.Sprintf("%s/32", item.IP.String()) })
-	var modifiedContent string
-	if len(floatingIPsStrs) > 0 {
-		modifiedContent = strings.ReplaceAll(cloudInitContent, "0.0.0.0/32", strings.Join(floatingIPsStrs, " "))
-		modifiedContent = strings.Join(strings.Split(modifiedContent, " "), ", ")
-		modifiedContent = fmt.Sprintf("#cloud-config\nruncmd:\n- [%s]", modifiedContent)
+	volumeIDs := map[string]int64{}
+	archives := map[string]*dump.VolumeArchive{}
+	for _, dumped := range serverDump.Volumes {
+		if dumped.Archived {
+			a, err := p.store.GetVolumeArchive(ctx, p.project, serverName, serverDumpID, dumped.Name)
+			if err != nil {
+				return nil, nil, err
+			}
+			archives[dumped.Name] = a
+			// an unfinished unfreeze may have created the volume already
+			vol, resp, err := p.client.Volume.GetByName(ctx, dumped.Name)
+			if err != nil {
+				return nil, nil, err
+			}
+			defer resp.Body.Close()
+			if vol != nil {
+				volumeIDs[dumped.Name] = vol.ID
+			}
+			continue
+		}
+		vol, err := p.resolveVolume(ctx, dumped, opts.VolumesByName)
+		if err != nil {
+			return nil, nil, err
+		}
+		if vol == nil {
+			return nil, nil, fmt.Errorf("volume %s of the dump does not exist", volumeName(dumped))
+		}
+		volumeIDs[dumped.Name] = vol.ID
+	}
+	userData, err := unfreezeUserData(serverDump, floatingIPs, opts)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	p.logger.Infof("create server from dump")
+	// released primary ips are replaced by new ones in the datacenter
 	publicNet := &hcloud.ServerCreatePublicNet{}
 	if serverDump.Server.PublicNet.IPv4.ID != 0 {
 		// TODO check if ipv4 is blocked
 		//publicNet.EnableIPv4 = !serverDump.Server.PublicNet.IPv4.Blocked
 		publicNet.EnableIPv4 = true
-		publicNet.IPv4 = &hcloud.PrimaryIP{
-			ID: serverDump.Server.PublicNet.IPv4.ID,
+		if !releasesIP(serverDump.PrimaryIPs.Policy, "ipv4") {
+			publicNet.IPv4 = &hcloud.PrimaryIP{
+				ID: serverDump.Server.PublicNet.IPv4.ID,
+			}
 		}
 	}
 	if serverDump.Server.PublicNet.IPv6.ID != 0 {
 		// TODO check if ipv6 is blocked
 		//publicNet.EnableIPv6 = !serverDump.Server.PublicNet.IPv6.Blocked
 		publicNet.EnableIPv6 = true
-		publicNet.IPv6 = &hcloud.PrimaryIP{
-			ID: serverDump.Server.PublicNet.IPv6.ID,
+		if !releasesIP(serverDump.PrimaryIPs.Policy, "ipv6") {
+			publicNet.IPv6 = &hcloud.PrimaryIP{
+				ID: serverDump.Server.PublicNet.IPv6.ID,
+			}
 		}
 	}
 	firewalls := lo.Map(serverDump.Server.PublicNet.Firewalls, func(item schema.ServerFirewall, index int) *hcloud.ServerCreateFirewall {
 		return &hcloud.ServerCreateFirewall{Firewall: hcloud.Firewall{ID: item.ID}}
 	})
-	volumes := lo.Map(serverDump.Server.Volumes, func(item int64, index int) *hcloud.Volume { return &hcloud.Volume{ID: item} })
 	sshKeys := lo.Map(serverDump.SSHKeys, func(item schema.SSHKey, index int) *hcloud.SSHKey {
-		return &hcloud.SSHKey{ID: item.ID}
+		return &hcloud.SSHKey{ID: item.ID, Name: item.Name}
+	})
+	networks := lo.Map(serverDump.Server.PrivateNet, func(item schema.ServerPrivateNet, index int) *hcloud.Network {
+		return &hcloud.Network{ID: item.Network}
 	})
 	var placementGroup *hcloud.PlacementGroup
 	if serverDump.Server.PlacementGroup != nil {
-		placementGroup = &hcloud.PlacementGroup{ID: serverDump.Server.PlacementGroup.ID}
+		placementGroup = &hcloud.PlacementGroup{ID: serverDump.Server.PlacementGroup.ID, Name: serverDump.Server.PlacementGroup.Name}
 	}
-	createRes, resp, err := p.client.Server.Create(ctx, hcloud.ServerCreateOpts{
+	createOpts := hcloud.ServerCreateOpts{
 		Name:           serverDump.Server.Name,
-		ServerType:     &hcloud.ServerType{ID: serverDump.Server.ServerType.ID},
+		ServerType:     &hcloud.ServerType{ID: target.serverType.ID, Name: target.serverType.Name},
 		Image:          &hcloud.Image{ID: serverDump.Snapshot.ID},
 		SSHKeys:        sshKeys,
-		Datacenter:     &hcloud.Datacenter{ID: serverDump.Server.Datacenter.ID},
-		UserData:       modifiedContent,
+		Datacenter:     &hcloud.Datacenter{ID: target.datacenter.ID, Name: target.datacenter.Name},
+		UserData:       userData,
 		Labels:         serverDump.Server.Labels,
-		Volumes:        volumes,
 		Firewalls:      firewalls,
 		PlacementGroup: placementGroup,
 		PublicNet:      publicNet,
-	})
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode > 201 {
-		return fmt.Errorf("could not create server: status %d ", resp.StatusCode)
-	}
-	err = p.waitForActionStatus(ctx, createRes.Action)
-	if err != nil {
-		return err
 	}
 
-	for _, fIP := range floatingIPs {
-		p.logger.Infof("assign floating ip %s to server", fIP.IP.String())
-		action, resp, err := p.client.FloatingIP.Assign(ctx, fIP, createRes.Server)
-		if err != nil {
-			return err
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode > 201 {
-			return fmt.Errorf("could not get floating ip: status %d ", resp.StatusCode)
+	// networks, firewalls, ssh keys and the placement group missing in the
+	// project are created first and get their id before the server is created
+	var steps []step
+	for i, def := range serverDump.Networks {
+		if def.ID != 0 {
+			continue
 		}
-		err = p.waitForActionStatus(ctx, action)
-		if err != nil {
-			return err
+		def, network := def, networks[i]
+		network.Name = def.Name
+		steps = append(steps, step{
+			name:    fmt.Sprintf("create network %s", def.Name),
+			details: fmt.Sprintf("%s, %d subnets, %d routes", def.IPRange, len(def.Subnets), len(def.Routes)),
+			do: func(ctx context.Context) error {
+				return p.createNetwork(ctx, def, network)
+			},
+		})
+	}
+	for i, def := range serverDump.Firewalls {
+		if def.ID != 0 {
+			continue
 		}
+		def, fw := def, &firewalls[i].Firewall
+		fw.Name = def.Name
+		steps = append(steps, step{
+			name:    fmt.Sprintf("create firewall %s", def.Name),
+			details: fmt.Sprintf("%d rules", len(def.Rules)),
+			do: func(ctx context.Context) error {
+				return p.createFirewall(ctx, def, fw)
+			},
+		})
 	}
-	for _, pNet := range serverDump.Server.PrivateNet {
-		p.logger.Infof("assign private network ip %s to server", pNet.IP)
-		ipParts := strings.Split(pNet.IP, ".")
-		if len(ipParts) != 4 {
+	for i, dumped := range serverDump.SSHKeys {
+		if dumped.ID != 0 {
 			continue
 		}
-		ipPartsInts := lo.Map(ipParts, func(item string, index int) int {
-			num, _ := strconv.Atoi(item)
-			return num
+		dumped, key := dumped, sshKeys[i]
+		steps = append(steps, step{
+			name:    fmt.Sprintf("create ssh key %s", dumped.Name),
+			details: dumped.Fingerprint,
+			do: func(ctx context.Context) error {
+				return p.createSSHKey(ctx, dumped, key)
+			},
 		})
-		action, resp, err := p.client.Server.AttachToNetwork(ctx,
-			createRes.Server,
-			hcloud.ServerAttachToNetworkOpts{Network: &hcloud.Network{ID: pNet.Network},
-				IP: net.IPv4(byte(ipPartsInts[0]), byte(ipPartsInts[1]), byte(ipPartsInts[2]), byte(ipPartsInts[3]))})
-		if err != nil {
-			return err
+	}
+	if dumped := serverDump.Server.PlacementGroup; dumped != nil && dumped.ID == 0 {
+		steps = append(steps, step{
+			name:    fmt.Sprintf("create placement group %s", dumped.Name),
+			details: dumped.Type,
+			do: func(ctx context.Context) error {
+				return p.createPlacementGroup(ctx, *dumped, placementGroup)
+			},
+		})
+	}
+	steps = append(steps, step{
+		name:    fmt.Sprintf("create server %s", serverDump.Server.Name),
+		details: describeServerCreateOpts(createOpts),
+		do: func(ctx context.Context) error {
+			p.logger.Infof("create server from dump")
+			// the server may have been created by an unfinished run that was
+			// interrupted before the journal was written
+			created, resp, err := p.client.Server.GetByName(ctx, serverDump.Server.Name)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if created == nil {
+				createRes, resp, err := p.client.Server.Create(ctx, createOpts)
+				if err != nil {
+					return err
+				}
+				defer resp.Body.Close()
+				if resp.StatusCode > 201 {
+					return fmt.Errorf("could not create server: status %d ", resp.StatusCode)
+				}
+				err = p.waitForActionStatus(ctx, createRes.Action)
+				if err != nil {
+					return err
+				}
+				created = createRes.Server
+			} else {
+				p.logger.Infof("server %s was already created by an unfinished unfreeze", created.Name)
+			}
+			svr = created
+			j.entry.ServerID = created.ID
+			return nil
+		},
+	})
+	// volumes are attached after creating the server, so each one keeps its
+	// own automount setting. Archived volumes are recreated and restored
+	// into the mount point they had.
+	for _, dumped := range serverDump.Volumes {
+		dumped := dumped
+		a := archives[dumped.Name]
+		automount := dumped.Automount && !dumped.Archived
+		details := fmt.Sprintf("volume %d, automount %t", volumeIDs[dumped.Name], automount)
+		if dumped.Archived {
+			location := target.datacenter.Location.Name
+			steps = append(steps, step{
+				name:    fmt.Sprintf("create volume %s", dumped.Name),
+				details: fmt.Sprintf("%d GB %s in %s", dumped.Size, a.Filesystem, location),
+				do: func(ctx context.Context) error {
+					if volumeIDs[dumped.Name] != 0 {
+						p.logger.Infof("volume %s was already created by an unfinished unfreeze", dumped.Name)
+						return nil
+					}
+					volumeID, err := p.createVolume(ctx, dumped, a, location)
+					if err != nil {
+						return err
+					}
+					volumeIDs[dumped.Name] = volumeID
+					return nil
+				},
+			})
+			details = fmt.Sprintf("new volume, automount %t", automount)
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode > 201 {
-			return fmt.Errorf("could not attach server to private network: status %d ", resp.StatusCode)
+		steps = append(steps, step{
+			name:    fmt.Sprintf("attach volume %s", dumped.Name),
+			details: details,
+			do: func(ctx context.Context) error {
+				p.logger.Infof("attach volume %s to server", dumped.Name)
+				return p.attachVolume(ctx, volumeIDs[dumped.Name], svr, automount)
+			},
+		})
+		if dumped.Archived {
+			steps = append(steps, step{
+				name:    fmt.Sprintf("restore volume %s", dumped.Name),
+				details: fmt.Sprintf("unpack %d bytes archived from %s over ssh", a.Size, a.MountPoint),
+				do: func(ctx context.Context) error {
+					return p.restoreVolume(ctx, svr, serverDumpID, dumped, a, volumeIDs[dumped.Name], opts.SSH)
+				},
+			})
 		}
-		err = p.waitForActionStatus(ctx, action)
+	}
+	for _, fIP := range floatingIPs {
+		fIP := fIP
+		steps = append(steps, step{
+			name: fmt.Sprintf("assign floating ip %s", fIP.IP.String()),
+			do: func(ctx context.Context) error {
+				p.logger.Infof("assign floating ip %s to server", fIP.IP.String())
+				return p.reassignFloatingIP(ctx, fIP.ID, svr)
+			},
+		})
+	}
+	for i, pNet := range serverDump.Server.PrivateNet {
+		pNet, network := pNet, networks[i]
+		steps = append(steps, step{
+			name: fmt.Sprintf("attach private network ip %s", pNet.IP),
+			do: func(ctx context.Context) error {
+				p.logger.Infof("assign private network ip %s to server", pNet.IP)
+				ipParts := strings.Split(pNet.IP, ".")
+				if len(ipParts) != 4 {
+					return nil
+				}
+				ipPartsInts := lo.Map(ipParts, func(item string, index int) int {
+					num, _ := strconv.Atoi(item)
+					return num
+				})
+				return p.runAction(ctx, "attach server to private network", func() (*hcloud.Action, *hcloud.Response, error) {
+					return p.client.Server.AttachToNetwork(ctx,
+						svr,
+						hcloud.ServerAttachToNetworkOpts{Network: network,
+							IP: net.IPv4(byte(ipPartsInts[0]), byte(ipPartsInts[1]), byte(ipPartsInts[2]), byte(ipPartsInts[3]))})
+				})
+			},
+		})
+	}
+	for _, entry := range serverDump.ReverseDNS {
+		entry := entry
+		steps = append(steps, step{
+			name:    fmt.Sprintf("restore reverse dns of %s", entry.IP),
+			details: entry.DNSPtr,
+			do: func(ctx context.Context) error {
+				return p.restoreReverseDNS(ctx, entry, svr.ID)
+			},
+		})
+	}
+	if protection := serverDump.Server.Protection; protection.Delete || protection.Rebuild {
+		steps = append(steps, step{
+			name:    fmt.Sprintf("restore protection of server %s", serverDump.Server.Name),
+			details: fmt.Sprintf("delete %t, rebuild %t", protection.Delete, protection.Rebuild),
+			do: func(ctx context.Context) error {
+				p.logger.Infof("restore protection of server")
+				return p.setProtection(ctx, svr.ID, hcloud.ServerProtection{Delete: protection.Delete, Rebuild: protection.Rebuild})
+			},
+		})
+	}
+	if len(lo.FromPtr(serverDump.Server.BackupWindow)) > 0 {
+		steps = append(steps, step{
+			name: fmt.Sprintf("enable backups of server %s", serverDump.Server.Name),
+			do: func(ctx context.Context) error {
+				return p.enableBackups(ctx, svr.ID)
+			},
+		})
+	}
+	if serverDump.Server.RescueEnabled {
+		p.logger.Warnf("server %s was in rescue mode when it was frozen, the restored server boots from its disk", serverDump.Server.Name)
+	}
+	if serverDump.PrimaryIPs.Policy == IPPolicyRelease || serverDump.PrimaryIPs.Policy == IPPolicyKeepIPv4 {
+		steps = append(steps, step{
+			name:    "report new addresses",
+			details: fmt.Sprintf("primary ip policy %s released addresses of the server", serverDump.PrimaryIPs.Policy),
+			do: func(ctx context.Context) error {
+				return p.reportNewAddresses(ctx, serverDump, svr.ID)
+			},
+		})
+	}
+	steps = append(steps, step{
+		name: fmt.Sprintf("record unfreeze in dump %s", serverDumpID),
+		do: func(ctx context.Context) error {
+			return p.recordUnfreeze(ctx, serverName, serverDumpID)
+		},
+	})
+	return j, steps, nil
+}
+
+var errNoDumps = errors.New("no dumps found. please create a dump first running 'freeze' command")
+
+// latestServerDumpID returns the id of the most recently created complete
+// dump of the server.
+func (p *resolverService) latestServerDumpID(ctx context.Context, serverName string) (string, error) {
+	dumpIDs, err := p.store.List(ctx, p.project, serverName)
+	if err != nil {
+		return "", fmt.Errorf("failed to list dumps: %w", err)
+	}
+	var latest *dump.Manifest
+	for _, dumpID := range dumpIDs {
+		m, err := p.loadManifest(ctx, serverName, dumpID)
 		if err != nil {
-			return err
+			return "", err
+		}
+		if m.Status != dump.StatusComplete {
+			continue
+		}
+		if latest == nil || m.CreatedAt.After(latest.CreatedAt) {
+			latest = m
 		}
 	}
-	p.logger.Infof("finish unfreezing server")
-	return nil
+	if latest == nil {
+		return "", errNoDumps
+	}
+	return latest.DumpID, nil
 }
 
-func (p *resolverService) FreezeServer(ctx context.Context, serverName string) (string, error) {
-	p.logger.Infof("start freezing server %s", serverName)
-	newID := strconv.Itoa(time.Now().UTC().Nanosecond())
-	svr, resp, err := p.client.Server.GetByName(ctx, serverName)
+// previousServerDump returns the latest complete dump of the server, or nil
+// if there is none.
+func (p *resolverService) previousServerDump(ctx context.Context, serverName string) (*dump.ServerDump, error) {
+	dumpID, err := p.latestServerDumpID(ctx, serverName)
+	if errors.Is(err, errNoDumps) {
+		return nil, nil
+	}
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode > 201 {
-		return "", fmt.Errorf("could not get server by name: status %d ", resp.StatusCode)
+	previous, err := p.store.Get(ctx, p.project, serverName, dumpID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server dump: %w", err)
 	}
-	if svr == nil {
-		return "", fmt.Errorf("server with name %s not found", serverName)
+	return previous, nil
+}
+
+// loadManifest returns the manifest of the dump. Dumps without one get one
+// derived from their snapshot, which is complete only for unversioned dumps
+// written before manifests were introduced.
+func (p *resolverService) loadManifest(ctx context.Context, serverName string, serverDumpID string) (*dump.Manifest, error) {
+	m, err := p.store.GetManifest(ctx, p.project, serverName, serverDumpID)
+	if err == nil {
+		return m, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
 	}
-	p.logger.Infof("shutdown server %s", serverName)
-	action, resp, err := p.client.Server.Shutdown(ctx, svr)
+	serverDump, err := p.store.Get(ctx, p.project, serverName, serverDumpID)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("failed to load server dump: %w", err)
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode > 201 {
-		return "", fmt.Errorf("could not shutdown server: status %d ", resp.StatusCode)
+	// versioned dumps without a manifest were interrupted before it was
+	// written
+	status := dump.StatusPending
+	if serverDump.Unversioned {
+		status = dump.StatusComplete
 	}
-	err = p.waitForActionStatus(ctx, action)
+	return &dump.Manifest{
+		DumpID:     serverDumpID,
+		CreatedAt:  lo.FromPtr(serverDump.Snapshot.Created),
+		ServerID:   serverDump.Server.ID,
+		ServerName: serverDump.Server.Name,
+		SnapshotID: serverDump.Snapshot.ID,
+		Status:     status,
+	}, nil
+}
+
+// loadJournal returns the journal of an unfinished operation on the server or
+// nil if there is none. It fails if the unfinished operation is not op.
+func (p *resolverService) loadJournal(ctx context.Context, serverName string, op string) (*journal, error) {
+	entry, err := p.store.LoadJournal(ctx, p.project, serverName)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	if entry.Operation != op {
+		return nil, fmt.Errorf("unfinished %s of server %s found, rerun %s first", entry.Operation, serverName, entry.Operation)
+	}
+	return p.newJournal(serverName, entry), nil
+}
+
+func (p *resolverService) newJournal(serverName string, entry *dump.Journal) *journal {
+	return &journal{store: p.store, project: p.project, serverName: serverName, entry: entry}
+}
+
+func (p *resolverService) FreezeServer(ctx context.Context, serverName string, opts FreezeOptions) (string, error) {
+	unlock, err := p.locks.lock(serverName)
 	if err != nil {
 		return "", err
 	}
-	p.logger.Infof("create dump of server %s", serverName)
-	serverDump, err := p.createServerDump(ctx, newID, svr)
+	defer unlock()
+	j, steps, err := p.prepareFreeze(ctx, serverName, opts)
 	if err != nil {
 		return "", err
 	}
-	if len(serverDump.FloatingIPs) > 0 {
-		p.logger.Infof("unassign floating ips of server %s", serverName)
-		for _, fIP := range serverDump.FloatingIPs {
-			assignedfIP, resp, err := p.client.FloatingIP.GetByID(ctx, fIP.ID)
-			if err != nil {
-				return "", err
-			}
-			defer resp.Body.Close()
-			if resp.StatusCode > 201 {
-				return "", fmt.Errorf("could not get floating ip: status %d ", resp.StatusCode)
-			}
-			action, resp, err = p.client.FloatingIP.Unassign(ctx, assignedfIP)
-			if err != nil {
-				return "", err
-			}
-			defer resp.Body.Close()
-			if resp.StatusCode > 201 {
-				return "", fmt.Errorf("could not unassign floating ip: status %d ", resp.StatusCode)
-			}
-			err = p.waitForActionStatus(ctx, action)
-			if err != nil {
-				return "", err
+	if len(j.entry.Steps) > 0 {
+		p.logger.Infof("resume freezing server %s", serverName)
+	} else {
+		p.logger.Infof("start freezing server %s", serverName)
+	}
+	if err := newTransaction(p.logger, j).run(ctx, steps); err != nil {
+		return "", err
+	}
+	p.logger.Infof("finish freezing server %s", serverName)
+	return j.entry.DumpID, nil
+}
+
+func (p *resolverService) PlanFreeze(ctx context.Context, serverName string, opts FreezeOptions) ([]string, error) {
+	j, steps, err := p.prepareFreeze(ctx, serverName, opts)
+	if err != nil {
+		return nil, err
+	}
+	return plan(j, steps), nil
+}
+
+// prepareFreeze returns the steps that freeze the server, without changing
+// anything.
+func (p *resolverService) prepareFreeze(ctx context.Context, serverName string, opts FreezeOptions) (*journal, []step, error) {
+	opts.VolumeMode = orDefault(opts.VolumeMode, VolumeModeKeep)
+	if !lo.Contains([]string{VolumeModeKeep, VolumeModeArchive}, opts.VolumeMode) {
+		return nil, nil, fmt.Errorf("unknown volume mode %s, use %s or %s", opts.VolumeMode, VolumeModeKeep, VolumeModeArchive)
+	}
+	opts.IPPolicy = orDefault(opts.IPPolicy, IPPolicyKeep)
+	if !lo.Contains([]string{IPPolicyKeep, IPPolicyRelease, IPPolicyKeepIPv4}, opts.IPPolicy) {
+		return nil, nil, fmt.Errorf("unknown primary ip policy %s, use %s, %s or %s", opts.IPPolicy, IPPolicyKeep, IPPolicyRelease, IPPolicyKeepIPv4)
+	}
+	if _, err := p.sshKeysByName(ctx, opts.SSHKeys); err != nil {
+		return nil, nil, err
+	}
+	if _, err := readUserData(opts.UserDataFile); err != nil {
+		return nil, nil, err
+	}
+	j, err := p.loadJournal(ctx, serverName, dump.OperationFreeze)
+	if err != nil {
+		return nil, nil, err
+	}
+	var svr *hcloud.Server
+	if j != nil {
+		if mode := orDefault(j.entry.VolumeMode, VolumeModeKeep); mode != opts.VolumeMode {
+			return nil, nil, fmt.Errorf("unfinished freeze of server %s uses volume mode %s, rerun it with the same mode", serverName, mode)
+		}
+		if policy := orDefault(j.entry.IPPolicy, IPPolicyKeep); policy != opts.IPPolicy {
+			return nil, nil, fmt.Errorf("unfinished freeze of server %s uses primary ip policy %s, rerun it with the same policy", serverName, policy)
+		}
+		var resp *hcloud.Response
+		svr, resp, err = p.client.Server.GetByID(ctx, j.entry.ServerID)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer resp.Body.Close()
+		if svr == nil {
+			if !j.done(fmt.Sprintf("delete server %s", serverName)) {
+				return nil, nil, fmt.Errorf("server %d frozen by the unfinished freeze no longer exists, remove the journal of server %s to start over", j.entry.ServerID, serverName)
 			}
+			// only the steps after deleting the server are left
+			svr = &hcloud.Server{ID: j.entry.ServerID, Name: serverName}
 		}
-	}
-	if serverDump.Server.PublicNet.IPv4.ID != 0 {
-		p.logger.Infof("unassign ipv4 of server %s", serverName)
-		action, resp, err = p.client.PrimaryIP.Unassign(ctx, serverDump.Server.PublicNet.IPv4.ID)
+	} else {
+		var resp *hcloud.Response
+		svr, resp, err = p.client.Server.GetByName(ctx, serverName)
 		if err != nil {
-			return "", err
+			return nil, nil, err
 		}
 		defer resp.Body.Close()
 		if resp.StatusCode > 201 {
-			return "", fmt.Errorf("could not unassign ipv4: status %d ", resp.StatusCode)
+			return nil, nil, fmt.Errorf("could not get server by name: status %d ", resp.StatusCode)
 		}
-		err = p.waitForActionStatus(ctx, action)
-		if err != nil {
-			return "", err
+		if svr == nil {
+			return nil, nil, fmt.Errorf("server with name %s not found", serverName)
 		}
+		j = p.newJournal(serverName, &dump.Journal{
+			Operation:  dump.OperationFreeze,
+			DumpID:     dump.NewID(),
+			ServerID:   svr.ID,
+			VolumeMode: opts.VolumeMode,
+			IPPolicy:   opts.IPPolicy,
+		})
 	}
-	if serverDump.Server.PublicNet.IPv6.ID != 0 {
-		p.logger.Infof("unassign ipv6 of server %s", serverName)
-		action, resp, err = p.client.PrimaryIP.Unassign(ctx, serverDump.Server.PublicNet.IPv6.ID)
+	res, err := p.serverResourcesToRelease(ctx, svr, j)
+	if err != nil {
+		return nil, nil, err
+	}
+	if res.protection.Delete && !opts.Force {
+		return nil, nil, fmt.Errorf("server %s is protected against deletion, rerun with --force to lift the protection for the freeze", serverName)
+	}
+	if opts.VolumeMode == VolumeModeArchive && len(res.volumes) > 0 {
+		if len(j.entry.Steps) == 0 {
+			if err := checkArchivable(svr, opts.SSH); err != nil {
+				return nil, nil, err
+			}
+		}
+		p.logger.Warnf("volumes of server %s will be deleted, the archives in dump %s will be the only copy of their data", serverName, j.entry.DumpID)
+	}
+	return j, p.freezeSteps(j.entry.DumpID, svr, res, opts), nil
+}
+
+// serverResources are the volumes and public ips of a server that a freeze
+// detaches and unassigns, and the protection it lifts.
+type serverResources struct {
+	floatingIPs []*hcloud.FloatingIP
+	ipv4ID      int64
+	ipv6ID      int64
+	volumes     []dump.Volume
+	protection  hcloud.ServerProtection
+}
+
+// serverResourcesToRelease returns the volumes and ips of the server. When
+// resuming a freeze they are taken from the dump, since some may already be
+// detached or unassigned.
+func (p *resolverService) serverResourcesToRelease(ctx context.Context, svr *hcloud.Server, j *journal) (serverResources, error) {
+	if j.done(fmt.Sprintf("create dump of server %s", svr.Name)) {
+		serverDump, err := p.store.Get(ctx, p.project, svr.Name, j.entry.DumpID)
 		if err != nil {
-			return "", err
+			return serverResources{}, fmt.Errorf("failed to load server dump: %w", err)
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode > 201 {
-			return "", fmt.Errorf("could not unassign ipv6: status %d ", resp.StatusCode)
+		return serverResources{
+			floatingIPs: lo.Map(serverDump.FloatingIPs, func(item schema.FloatingIP, index int) *hcloud.FloatingIP {
+				return hcloud.FloatingIPFromSchema(item)
+			}),
+			ipv4ID:  serverDump.Server.PublicNet.IPv4.ID,
+			ipv6ID:  serverDump.Server.PublicNet.IPv6.ID,
+			volumes: serverDump.Volumes,
+			protection: hcloud.ServerProtection{
+				Delete:  serverDump.Server.Protection.Delete,
+				Rebuild: serverDump.Server.Protection.Rebuild,
+			},
+		}, nil
+	}
+	fIPs, err := p.assignedFloatingIPs(ctx, svr)
+	if err != nil {
+		return serverResources{}, err
+	}
+	volumes, err := p.serverVolumes(ctx, svr)
+	if err != nil {
+		return serverResources{}, err
+	}
+	return serverResources{
+		floatingIPs: fIPs,
+		ipv4ID:      svr.PublicNet.IPv4.ID,
+		ipv6ID:      svr.PublicNet.IPv6.ID,
+		volumes:     volumes,
+		protection:  svr.Protection,
+	}, nil
+}
+
+// freezeSteps returns the steps that shut down, dump and delete the server,
+// detaching its volumes and releasing its floating and primary IPs on the way.
+// In archive mode the volumes are archived while the server is still running
+// and deleted with it, primary ips the ip policy releases are deleted too.
+func (p *resolverService) freezeSteps(serverDumpID string, svr *hcloud.Server, res serverResources, opts FreezeOptions) []step {
+	archive := opts.VolumeMode == VolumeModeArchive
+	var steps []step
+	if archive {
+		for _, vol := range res.volumes {
+			steps = append(steps, p.archiveVolumeStep(serverDumpID, svr, vol, opts.SSH))
 		}
-		err = p.waitForActionStatus(ctx, action)
-		if err != nil {
-			return "", err
+	}
+	steps = append(steps, []step{
+		{
+			name: fmt.Sprintf("shutdown server %s", svr.Name),
+			do: func(ctx context.Context) error {
+				return p.runAction(ctx, "shutdown server", func() (*hcloud.Action, *hcloud.Response, error) {
+					return p.client.Server.Shutdown(ctx, svr)
+				})
+			},
+			undo: func(ctx context.Context) error {
+				return p.powerOnServer(ctx, svr.ID)
+			},
+		},
+		{
+			name:    fmt.Sprintf("create dump of server %s", svr.Name),
+			details: fmt.Sprintf("snapshot the server and store it as dump %s", serverDumpID),
+			do: func(ctx context.Context) error {
+				_, err := p.createServerDump(ctx, serverDumpID, svr, dump.OperationFreeze, opts)
+				return err
+			},
+			undo: func(ctx context.Context) error {
+				return p.deleteServerDump(ctx, svr.Name, serverDumpID)
+			},
+		},
+	}...)
+	for _, vol := range res.volumes {
+		steps = append(steps, p.detachVolumeStep(svr, vol))
+	}
+	for _, fIP := range res.floatingIPs {
+		fIP := fIP
+		steps = append(steps, step{
+			name: fmt.Sprintf("unassign floating ip %s", fIP.IP.String()),
+			do: func(ctx context.Context) error {
+				return p.runAction(ctx, "unassign floating ip", func() (*hcloud.Action, *hcloud.Response, error) {
+					return p.client.FloatingIP.Unassign(ctx, fIP)
+				})
+			},
+			undo: func(ctx context.Context) error {
+				return p.reassignFloatingIP(ctx, fIP.ID, svr)
+			},
+		})
+	}
+	primaryIPs := []struct {
+		family string
+		id     int64
+	}{
+		{family: "ipv4", id: res.ipv4ID},
+		{family: "ipv6", id: res.ipv6ID},
+	}
+	for _, pIP := range primaryIPs {
+		if pIP.id == 0 {
+			continue
+		}
+		pIP := pIP
+		steps = append(steps, step{
+			name: fmt.Sprintf("unassign %s of server %s", pIP.family, svr.Name),
+			do: func(ctx context.Context) error {
+				return p.runAction(ctx, "unassign "+pIP.family, func() (*hcloud.Action, *hcloud.Response, error) {
+					return p.client.PrimaryIP.Unassign(ctx, pIP.id)
+				})
+			},
+			undo: func(ctx context.Context) error {
+				return p.reassignPrimaryIP(ctx, pIP.id, svr)
+			},
+		})
+	}
+	if res.protection.Delete || res.protection.Rebuild {
+		steps = append(steps, p.liftProtectionStep(svr, res.protection))
+	}
+	steps = append(steps, []step{
+		{
+			name:    fmt.Sprintf("delete server %s", svr.Name),
+			details: "point of no return, later failures are resumed by a rerun instead of rolled back",
+			do: func(ctx context.Context) error {
+				_, resp, err := p.client.Server.DeleteWithResult(ctx, svr)
+				if err != nil {
+					return err
+				}
+				defer resp.Body.Close()
+				if resp.StatusCode > 201 {
+					return fmt.Errorf("could not delete server: status %d ", resp.StatusCode)
+				}
+				return nil
+			},
+			final: true,
+		},
+		{
+			name: fmt.Sprintf("wait for deletion of server %s", svr.Name),
+			do: func(ctx context.Context) error {
+				return p.waitForServerDeletion(ctx, svr.ID)
+			},
+		},
+	}...)
+	if archive {
+		for _, vol := range res.volumes {
+			steps = append(steps, p.deleteVolumeStep(serverDumpID, vol))
 		}
 	}
-	p.logger.Infof("delete server %s", serverName)
-	deleteRes, resp, err := p.client.Server.DeleteWithResult(ctx, svr)
+	for _, pIP := range primaryIPs {
+		if pIP.id != 0 && releasesIP(opts.IPPolicy, pIP.family) {
+			steps = append(steps, p.deletePrimaryIPStep(svr, pIP.family, pIP.id))
+		}
+	}
+	steps = append(steps, step{
+		name: fmt.Sprintf("complete dump of server %s", svr.Name),
+		do: func(ctx context.Context) error {
+			return p.completeServerDump(ctx, svr.Name, serverDumpID)
+		},
+	})
+	return steps
+}
+
+func (p *resolverService) completeServerDump(ctx context.Context, serverName string, serverDumpID string) error {
+	m, err := p.store.GetManifest(ctx, p.project, serverName, serverDumpID)
 	if err != nil {
-		return "", err
+		return err
+	}
+	m.Status = dump.StatusComplete
+	return p.store.PutManifest(ctx, p.project, serverName, m)
+}
+
+// recordUnfreeze records in the manifest of the dump when the server was
+// unfrozen from it, which ends the period it was frozen. Later unfreezes from
+// the same dump keep the first time.
+func (p *resolverService) recordUnfreeze(ctx context.Context, serverName string, serverDumpID string) error {
+	m, err := p.loadManifest(ctx, serverName, serverDumpID)
+	if err != nil {
+		return err
+	}
+	if m.UnfrozenAt != nil {
+		return nil
+	}
+	m.UnfrozenAt = lo.ToPtr(time.Now().UTC())
+	return p.store.PutManifest(ctx, p.project, serverName, m)
+}
+
+// deleteServerDump removes the dump and the snapshot it references.
+func (p *resolverService) deleteServerDump(ctx context.Context, serverName string, serverDumpID string) error {
+	serverDump, err := p.store.Get(ctx, p.project, serverName, serverDumpID)
+	if err != nil {
+		return fmt.Errorf("failed to load server dump: %w", err)
+	}
+	if serverDump.Snapshot.ID != 0 {
+		p.logger.Infof("delete snapshot %d", serverDump.Snapshot.ID)
+		resp, err := p.client.Image.Delete(ctx, &hcloud.Image{ID: serverDump.Snapshot.ID})
+		if err != nil && !hcloud.IsError(err, hcloud.ErrorCodeNotFound) {
+			return fmt.Errorf("could not delete snapshot: %w", err)
+		}
+		if resp != nil {
+			defer resp.Body.Close()
+		}
+	}
+	return p.store.Delete(ctx, p.project, serverName, serverDumpID)
+}
+
+// powerOnServer starts the server unless it is already running.
+func (p *resolverService) powerOnServer(ctx context.Context, serverID int64) error {
+	svr, resp, err := p.client.Server.GetByID(ctx, serverID)
+	if err != nil {
+		return err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode > 201 {
-		return "", fmt.Errorf("could not delete server: status %s ", resp.StatusCode)
+	if svr == nil {
+		return fmt.Errorf("server %d not found", serverID)
 	}
-	err = p.waitForActionStatus(ctx, deleteRes.Action)
+	if svr.Status == hcloud.ServerStatusRunning || svr.Status == hcloud.ServerStatusStarting {
+		return nil
+	}
+	return p.runAction(ctx, "power on server", func() (*hcloud.Action, *hcloud.Response, error) {
+		return p.client.Server.Poweron(ctx, svr)
+	})
+}
+
+// reassignFloatingIP assigns the floating ip back to the server unless it is
+// already assigned to it.
+func (p *resolverService) reassignFloatingIP(ctx context.Context, floatingIPID int64, svr *hcloud.Server) error {
+	fIP, resp, err := p.client.FloatingIP.GetByID(ctx, floatingIPID)
 	if err != nil {
-		return "", err
+		return err
 	}
-	p.logger.Infof("finish freezing server %s", serverName)
-	return newID, nil
+	defer resp.Body.Close()
+	if fIP == nil {
+		return fmt.Errorf("floating ip %d not found", floatingIPID)
+	}
+	if fIP.Server != nil && fIP.Server.ID == svr.ID {
+		return nil
+	}
+	return p.runAction(ctx, "assign floating ip", func() (*hcloud.Action, *hcloud.Response, error) {
+		return p.client.FloatingIP.Assign(ctx, fIP, svr)
+	})
+}
+
+// reassignPrimaryIP assigns the primary ip back to the server unless it is
+// already assigned to it.
+func (p *resolverService) reassignPrimaryIP(ctx context.Context, primaryIPID int64, svr *hcloud.Server) error {
+	pIP, resp, err := p.client.PrimaryIP.GetByID(ctx, primaryIPID)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if pIP == nil {
+		return fmt.Errorf("primary ip %d not found", primaryIPID)
+	}
+	if pIP.AssigneeID == svr.ID {
+		return nil
+	}
+	return p.runAction(ctx, "assign primary ip", func() (*hcloud.Action, *hcloud.Response, error) {
+		return p.client.PrimaryIP.Assign(ctx, hcloud.PrimaryIPAssignOpts{
+			ID:           primaryIPID,
+			AssigneeID:   svr.ID,
+			AssigneeType: "server",
+		})
+	})
+}
+
+// runAction issues an api call that returns an action and waits for it.
+func (p *resolverService) runAction(ctx context.Context, description string, call func() (*hcloud.Action, *hcloud.Response, error)) error {
+	action, resp, err := call()
+	if err != nil {
+		return fmt.Errorf("could not %s: %w", description, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 201 {
+		return fmt.Errorf("could not %s: status %d ", description, resp.StatusCode)
+	}
+	return p.waitForActionStatus(ctx, action)
 }
 
 func (p *resolverService) waitForActionStatus(ctx context.Context, action *hcloud.Action) error {
@@ -296,9 +1034,10 @@ func (p *resolverService) waitForActionStatus(ctx context.Context, action *hclou
 		p.logger.Infof("action progress 100/100")
 		return nil
 	}
-	ticker := time.NewTicker(pollingInterval)
+	ticker := time.NewTicker(p.pollInterval)
+	defer ticker.Stop()
 	deadline := time.After(pollingDeadline)
-	var statusAction *hcloud.Action
+	statusAction := action
 	for {
 		select {
 		case <-ticker.C:
@@ -330,60 +1069,108 @@ func (p *resolverService) waitForActionStatus(ctx context.Context, action *hclou
 	}
 }
 
+// waitForServerDeletion polls the server until it is gone. Unlike the action
+// of the deletion, the server id is known when a freeze is resumed.
+func (p *resolverService) waitForServerDeletion(ctx context.Context, serverID int64) error {
+	ticker := time.NewTicker(p.pollInterval)
+	defer ticker.Stop()
+	deadline := time.After(pollingDeadline)
+	for {
+		svr, resp, err := p.client.Server.GetByID(ctx, serverID)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if svr == nil {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return fmt.Errorf("wait for deletion deadline reached, server %d is %s", serverID, svr.Status)
+		case <-ctx.Done():
+			return fmt.Errorf("wait for deletion context was cancelled, server %d is %s", serverID, svr.Status)
+		}
+	}
+}
+
 func (p *resolverService) CreateServerDump(ctx context.Context, serverName string) (string, error) {
-	newID := strconv.Itoa(time.Now().UTC().Nanosecond())
-	svr, resp, err := p.client.Server.GetByName(ctx, serverName)
+	unlock, err := p.locks.lock(serverName)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode > 201 {
-		return "", fmt.Errorf("could not get server by name: status %d ", resp.StatusCode)
-	}
-	_, err = p.createServerDump(ctx, newID, svr)
+	defer unlock()
+	newID, steps, err := p.prepareServerDump(ctx, serverName)
 	if err != nil {
 		return "", err
 	}
+	if err := newTransaction(p.logger, nil).run(ctx, steps); err != nil {
+		return "", err
+	}
 	return newID, nil
 }
 
-func (p *resolverService) createServerDump(ctx context.Context, serverDumpID string, svr *hcloud.Server) (*dump.ServerDump, error) {
-	fIPs, resp, err := p.client.FloatingIP.List(ctx, hcloud.FloatingIPListOpts{})
+func (p *resolverService) PlanServerDump(ctx context.Context, serverName string) ([]string, error) {
+	_, steps, err := p.prepareServerDump(ctx, serverName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list floating ips: %w", err)
+		return nil, err
+	}
+	return plan(nil, steps), nil
+}
+
+func (p *resolverService) prepareServerDump(ctx context.Context, serverName string) (string, []step, error) {
+	newID := dump.NewID()
+	svr, resp, err := p.client.Server.GetByName(ctx, serverName)
+	if err != nil {
+		return "", nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode > 201 {
-		return nil, fmt.Errorf("could not list floating ips: status %d ", resp.StatusCode)
+		return "", nil, fmt.Errorf("could not get server by name: status %d ", resp.StatusCode)
 	}
-	assignedFIPs := lo.Filter(fIPs, func(fIP *hcloud.FloatingIP, _ int) bool {
-		if fIP.Server == nil {
-			return false
-		}
-		return fIP.Server.ID == svr.ID
-	})
-	sshKeys, resp, err := p.client.SSHKey.List(ctx, hcloud.SSHKeyListOpts{})
+	if svr == nil {
+		return "", nil, fmt.Errorf("server with name %s not found", serverName)
+	}
+	return newID, []step{{
+		name:    fmt.Sprintf("create dump of server %s", svr.Name),
+		details: fmt.Sprintf("snapshot the server and store it as dump %s", newID),
+		do: func(ctx context.Context) error {
+			_, err := p.createServerDump(ctx, newID, svr, dump.OperationDump, FreezeOptions{})
+			return err
+		},
+	}}, nil
+}
+
+// createServerDump snapshots the server and stores its dump, recording how
+// the freeze options treat its volumes and primary ips.
+func (p *resolverService) createServerDump(ctx context.Context, serverDumpID string, svr *hcloud.Server, operation string, opts FreezeOptions) (*dump.ServerDump, error) {
+	assignedFIPs, err := p.assignedFloatingIPs(ctx, svr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list ssh keys: %w", err)
+		return nil, err
 	}
-	if resp.StatusCode > 201 {
-		return nil, fmt.Errorf("could not list ssh keys: status %d ", resp.StatusCode)
+	volumes, err := p.serverVolumes(ctx, svr)
+	if err != nil {
+		return nil, err
 	}
-	defer resp.Body.Close()
-	description := time.Now().Format("2006-01-02 15:04:05")
-	p.logger.Infof("create snapshot of server %d", svr.ID)
-	srvImg, resp, err := p.client.Server.CreateImage(ctx, svr, &hcloud.ServerCreateImageOpts{
-		Description: &description,
-		Type:        hcloud.ImageTypeSnapshot,
-	})
+	for i := range volumes {
+		volumes[i].Archived = opts.VolumeMode == VolumeModeArchive
+	}
+	firewalls, networks, err := p.serverDefinitions(ctx, svr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create image: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode > 201 {
-		return nil, fmt.Errorf("could not create image: status %d ", resp.StatusCode)
+	sshKeys, sshKeySource, err := p.serverSSHKeys(ctx, svr, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(sshKeys) > 0 {
+		p.logger.Infof("dump ssh keys %s of server %d", strings.Join(sshKeyNames(sshKeys), ", "), svr.ID)
+	}
+	userData, err := p.serverUserData(ctx, svr, opts)
+	if err != nil {
+		return nil, err
 	}
-	err = p.waitForActionStatus(ctx, srvImg.Action)
+	snapshot, err := p.createSnapshot(ctx, serverDumpID, svr)
 	if err != nil {
 		return nil, err
 	}
@@ -395,46 +1182,142 @@ func (p *resolverService) createServerDump(ctx context.Context, serverDumpID str
 	schSSHKeys := lo.Map(sshKeys, func(item *hcloud.SSHKey, index int) schema.SSHKey {
 		return hcloud.SchemaFromSSHKey(item)
 	})
-	path := dump.NewServerDumpPath(p.directory, p.project, svr.Name, serverDumpID)
-	path, err = dump.EnsureHasDirectory(path)
+	schSnapshot := hcloud.SchemaFromImage(snapshot)
+	serverDump := &dump.ServerDump{
+		Server:          schSrv,
+		FloatingIPs:     schFIPs,
+		SSHKeys:         schSSHKeys,
+		SSHKeySelection: dump.SSHKeySelection{Source: sshKeySource},
+		Snapshot:        schSnapshot,
+		Volumes:         volumes,
+		PrimaryIPs:      dump.PrimaryIPs{Policy: opts.IPPolicy},
+		ReverseDNS:      serverReverseDNS(svr, assignedFIPs),
+		Firewalls:       firewalls,
+		Networks:        networks,
+		UserData:        userData,
+	}
+	err = p.store.Put(ctx, p.project, svr.Name, serverDumpID, serverDump)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create directory: %w", err)
+		return nil, err
 	}
-	schSnapshot := hcloud.SchemaFromImage(srvImg.Image)
-	serverDump := &dump.ServerDump{
-		Server:      schSrv,
-		FloatingIPs: schFIPs,
-		SSHKeys:     schSSHKeys,
-		Snapshot:    schSnapshot,
+	status := dump.StatusComplete
+	if operation == dump.OperationFreeze {
+		// a freeze completes its dump once the server is deleted
+		status = dump.StatusPending
 	}
-	err = dump.StoreServer(path, serverDump)
+	err = p.store.PutManifest(ctx, p.project, svr.Name, &dump.Manifest{
+		DumpID:      serverDumpID,
+		CreatedAt:   time.Now().UTC(),
+		ToolVersion: Version,
+		ServerID:    svr.ID,
+		ServerName:  svr.Name,
+		SnapshotID:  snapshot.ID,
+		Operation:   operation,
+		Status:      status,
+	})
 	if err != nil {
 		return nil, err
 	}
 	return serverDump, nil
 }
 
-func GetDirectoriesNames(dirPath string) ([]string, error) {
-	var directories []string
-	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+// createSnapshot snapshots the server for the dump and returns the created
+// image. The snapshot is labeled with the dump id, a snapshot left by an
+// interrupted run is waited for instead of taking another one.
+func (p *resolverService) createSnapshot(ctx context.Context, serverDumpID string, svr *hcloud.Server) (*hcloud.Image, error) {
+	existing, err := p.client.Image.AllWithOpts(ctx, hcloud.ImageListOpts{
+		ListOpts: hcloud.ListOpts{LabelSelector: fmt.Sprintf("%s=%s", dumpLabel, serverDumpID)},
+		Type:     []hcloud.ImageType{hcloud.ImageTypeSnapshot},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots of dump %s: %w", serverDumpID, err)
+	}
+	if len(existing) > 0 {
+		p.logger.Infof("reuse snapshot %d of server %d", existing[0].ID, svr.ID)
+		return p.waitForImage(ctx, existing[0].ID)
+	}
+	description := time.Now().Format("2006-01-02 15:04:05")
+	p.logger.Infof("create snapshot of server %d", svr.ID)
+	srvImg, resp, err := p.client.Server.CreateImage(ctx, svr, &hcloud.ServerCreateImageOpts{
+		Description: &description,
+		Type:        hcloud.ImageTypeSnapshot,
+		Labels:      map[string]string{dumpLabel: serverDumpID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create image: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 201 {
+		return nil, fmt.Errorf("could not create image: status %d ", resp.StatusCode)
+	}
+	if err := p.waitForActionStatus(ctx, srvImg.Action); err != nil {
+		return nil, err
+	}
+	// the size of the image is only known once it is created
+	return p.waitForImage(ctx, srvImg.Image.ID)
+}
+
+// waitForImage polls the image until it is available and returns it.
+func (p *resolverService) waitForImage(ctx context.Context, imageID int64) (*hcloud.Image, error) {
+	ticker := time.NewTicker(p.pollInterval)
+	defer ticker.Stop()
+	deadline := time.After(pollingDeadline)
+	for {
+		img, resp, err := p.client.Image.GetByID(ctx, imageID)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("failed to get snapshot %d: %w", imageID, err)
 		}
-		if info.IsDir() {
-			directories = append(directories, info.Name())
+		resp.Body.Close()
+		if img == nil {
+			return nil, fmt.Errorf("snapshot %d not found", imageID)
 		}
-		return nil
-	})
+		if img.Status == hcloud.ImageStatusAvailable {
+			return img, nil
+		}
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return nil, fmt.Errorf("wait for snapshot deadline reached, snapshot %d is %s", imageID, img.Status)
+		case <-ctx.Done():
+			return nil, fmt.Errorf("wait for snapshot context was cancelled, snapshot %d is %s", imageID, img.Status)
+		}
+	}
+}
+
+func (p *resolverService) assignedFloatingIPs(ctx context.Context, svr *hcloud.Server) ([]*hcloud.FloatingIP, error) {
+	fIPs, resp, err := p.client.FloatingIP.List(ctx, hcloud.FloatingIPListOpts{})
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to list floating ips: %w", err)
 	}
-	return directories, nil
+	defer resp.Body.Close()
+	if resp.StatusCode > 201 {
+		return nil, fmt.Errorf("could not list floating ips: status %d ", resp.StatusCode)
+	}
+	return lo.Filter(fIPs, func(fIP *hcloud.FloatingIP, _ int) bool {
+		if fIP.Server == nil {
+			return false
+		}
+		return fIP.Server.ID == svr.ID
+	}), nil
 }
 
-func NewProvider(logger *logrus.Logger, project string, hcli *hcloud.Client) Resolver {
+func NewProvider(logger *logrus.Logger, project string, hcli *hcloud.Client, store dump.Store) Resolver {
 	return &resolverService{
 		logger:  logger,
 		project: project,
 		client:  hcli,
+		store:   store,
+
+		pollInterval: pollingInterval,
+		dial:         dialSSH,
+		locks:        newServerLocks(),
+	}
+}
+
+// orDefault returns value or def if value is empty.
+func orDefault(value, def string) string {
+	if len(value) == 0 {
+		return def
 	}
+	return value
 }
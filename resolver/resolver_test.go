@@ -0,0 +1,344 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/sirupsen/logrus"
+	"hetzner-freezer/dump"
+	"hetzner-freezer/fakehcloud"
+)
+
+const testProject = "test"
+
+func newTestResolver(t *testing.T) (*fakehcloud.Fake, *resolverService) {
+	t.Helper()
+	fake := fakehcloud.New()
+	t.Cleanup(fake.Close)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return fake, &resolverService{
+		project:      testProject,
+		store:        dump.NewMemoryStore(),
+		client:       fake.Client(),
+		logger:       logger,
+		pollInterval: time.Millisecond,
+		locks:        newServerLocks(),
+	}
+}
+
+func countRequests(fake *fakehcloud.Fake, request string) int {
+	n := 0
+	for _, r := range fake.Requests() {
+		if r == request {
+			n++
+		}
+	}
+	return n
+}
+
+func TestFreezeUnfreeze(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	svr := fake.AddServer("web", map[string]string{"env": "test"})
+	fIP := fake.AddFloatingIP("198.51.100.10", svr.ID)
+	fake.AddSSHKey("admin")
+
+	dumpID, err := p.FreezeServer(ctx, "web", FreezeOptions{})
+	if err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+	if fake.Server("web") != nil {
+		t.Fatal("server still exists after freeze")
+	}
+	if got := fake.FloatingIP(fIP.ID); got.Server != nil {
+		t.Errorf("floating ip still assigned to server %d", *got.Server)
+	}
+	for _, id := range []int64{svr.PublicNet.IPv4.ID, svr.PublicNet.IPv6.ID} {
+		pIP := fake.PrimaryIP(id)
+		if pIP == nil {
+			t.Fatalf("primary ip %d was deleted with the server", id)
+		}
+		if pIP.AssigneeID != 0 {
+			t.Errorf("primary ip %d still assigned to %d", id, pIP.AssigneeID)
+		}
+	}
+	m, err := p.store.GetManifest(ctx, testProject, "web", dumpID)
+	if err != nil {
+		t.Fatalf("could not load manifest: %v", err)
+	}
+	if m.Status != dump.StatusComplete {
+		t.Errorf("dump status is %s, want %s", m.Status, dump.StatusComplete)
+	}
+
+	if err := p.UnfreezeServer(ctx, "web", "", UnfreezeOptions{}); err != nil {
+		t.Fatalf("unfreeze failed: %v", err)
+	}
+	restored := fake.Server("web")
+	if restored == nil {
+		t.Fatal("server not restored")
+	}
+	if restored.PublicNet.IPv4.ID != svr.PublicNet.IPv4.ID || restored.PublicNet.IPv6.ID != svr.PublicNet.IPv6.ID {
+		t.Errorf("restored server has primary ips %d/%d, want %d/%d",
+			restored.PublicNet.IPv4.ID, restored.PublicNet.IPv6.ID, svr.PublicNet.IPv4.ID, svr.PublicNet.IPv6.ID)
+	}
+	if restored.Labels["env"] != "test" {
+		t.Errorf("restored server has labels %v", restored.Labels)
+	}
+	if got := fake.FloatingIP(fIP.ID); got.Server == nil || *got.Server != restored.ID {
+		t.Error("floating ip not assigned to restored server")
+	}
+	if userData := fake.UserData("web"); !strings.Contains(userData, "198.51.100.10/32") {
+		t.Errorf("user data does not configure the floating ip: %q", userData)
+	}
+	if j, _ := p.store.LoadJournal(ctx, testProject, "web"); j != nil {
+		t.Errorf("journal left after unfreeze: %+v", j)
+	}
+}
+
+func TestFreezeRollsBackFailedStep(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	svr := fake.AddServer("web", nil)
+	fIP := fake.AddFloatingIP("198.51.100.10", svr.ID)
+	fake.Fail("POST", "/primary_ips/{id}/actions/unassign", 1, hcloud.ErrorCodeServiceError)
+
+	_, err := p.FreezeServer(ctx, "web", FreezeOptions{})
+	var rbErr *RollbackError
+	if !errors.As(err, &rbErr) {
+		t.Fatalf("freeze returned %v, want a rollback error", err)
+	}
+	if rbErr.Step != "unassign ipv4 of server web" {
+		t.Errorf("failed step is %q", rbErr.Step)
+	}
+	if len(rbErr.UndoErrors) > 0 {
+		t.Errorf("rollback failed: %v", rbErr.UndoErrors)
+	}
+	restored := fake.Server("web")
+	if restored == nil {
+		t.Fatal("server deleted despite rollback")
+	}
+	if restored.Status != string(hcloud.ServerStatusRunning) {
+		t.Errorf("server is %s after rollback", restored.Status)
+	}
+	if restored.PublicNet.IPv4.ID != svr.PublicNet.IPv4.ID {
+		t.Error("ipv4 not assigned after rollback")
+	}
+	if got := fake.FloatingIP(fIP.ID); got.Server == nil || *got.Server != svr.ID {
+		t.Error("floating ip not reassigned after rollback")
+	}
+	if images := fake.Images(); len(images) > 0 {
+		t.Errorf("snapshot left after rollback: %+v", images)
+	}
+	if ids, _ := p.store.List(ctx, testProject, "web"); len(ids) > 0 {
+		t.Errorf("dumps left after rollback: %v", ids)
+	}
+	if j, _ := p.store.LoadJournal(ctx, testProject, "web"); j != nil {
+		t.Errorf("journal left after rollback: %+v", j)
+	}
+}
+
+func TestFreezeKeepsDumpAfterServerDeletion(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	fake.AddServer("web", nil)
+	fake.Fail("DELETE", "/primary_ips/{id}", 1, hcloud.ErrorCodeServiceError)
+
+	_, err := p.FreezeServer(ctx, "web", FreezeOptions{IPPolicy: IPPolicyRelease})
+	var incErr *IncompleteError
+	if !errors.As(err, &incErr) {
+		t.Fatalf("freeze returned %v, want an incomplete error", err)
+	}
+	if incErr.PointOfNoReturn != "delete server web" {
+		t.Errorf("point of no return is %q", incErr.PointOfNoReturn)
+	}
+	if fake.Server("web") != nil {
+		t.Fatal("server not deleted")
+	}
+	if images := fake.Images(); len(images) != 1 {
+		t.Errorf("%d snapshots left, want the one of the dump", len(images))
+	}
+	j, err := p.store.LoadJournal(ctx, testProject, "web")
+	if err != nil || j == nil {
+		t.Fatalf("no journal after failed freeze: %v", err)
+	}
+	if ids, _ := p.store.List(ctx, testProject, "web"); len(ids) != 1 || ids[0] != j.DumpID {
+		t.Fatalf("dumps %v left, want %s", ids, j.DumpID)
+	}
+
+	dumpID, err := p.FreezeServer(ctx, "web", FreezeOptions{IPPolicy: IPPolicyRelease})
+	if err != nil {
+		t.Fatalf("resumed freeze failed: %v", err)
+	}
+	if dumpID != j.DumpID {
+		t.Errorf("resumed freeze stored dump %s, want %s", dumpID, j.DumpID)
+	}
+	m, err := p.store.GetManifest(ctx, testProject, "web", dumpID)
+	if err != nil {
+		t.Fatalf("could not load manifest: %v", err)
+	}
+	if m.Status != dump.StatusComplete {
+		t.Errorf("dump status is %s, want %s", m.Status, dump.StatusComplete)
+	}
+}
+
+func TestFreezeRollsBackFailedAction(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	fake.AddServer("web", nil)
+	fake.ActionPolls = 2
+	fake.FailAction("create_image", 1)
+
+	if _, err := p.FreezeServer(ctx, "web", FreezeOptions{}); err == nil {
+		t.Fatal("freeze succeeded despite failed snapshot")
+	}
+	if svr := fake.Server("web"); svr == nil || svr.Status != string(hcloud.ServerStatusRunning) {
+		t.Error("server not running after rollback")
+	}
+}
+
+func TestUnfreezeResumes(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	svr := fake.AddServer("web", nil)
+	fIP := fake.AddFloatingIP("198.51.100.10", svr.ID)
+	if _, err := p.FreezeServer(ctx, "web", FreezeOptions{}); err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+	fake.Fail("POST", "/floating_ips/{id}/actions/assign", 1, hcloud.ErrorCodeServiceError)
+
+	if err := p.UnfreezeServer(ctx, "web", "", UnfreezeOptions{}); err == nil {
+		t.Fatal("unfreeze succeeded despite failed floating ip assignment")
+	}
+	j, err := p.store.LoadJournal(ctx, testProject, "web")
+	if err != nil || j == nil {
+		t.Fatalf("no journal after failed unfreeze: %v", err)
+	}
+	if err := p.UnfreezeServer(ctx, "web", "", UnfreezeOptions{}); err != nil {
+		t.Fatalf("resumed unfreeze failed: %v", err)
+	}
+	if n := countRequests(fake, "POST /servers"); n != 1 {
+		t.Errorf("server created %d times", n)
+	}
+	restored := fake.Server("web")
+	if got := fake.FloatingIP(fIP.ID); restored == nil || got.Server == nil || *got.Server != restored.ID {
+		t.Error("floating ip not assigned after resumed unfreeze")
+	}
+}
+
+func TestFreezeReusesSnapshotOfInterruptedRun(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	svr := fake.AddServer("web", nil)
+	// a run interrupted after taking the snapshot, before journaling it
+	serverDumpID := dump.NewID()
+	if _, _, err := p.client.Server.Shutdown(ctx, &hcloud.Server{ID: svr.ID}); err != nil {
+		t.Fatal(err)
+	}
+	res, _, err := p.client.Server.CreateImage(ctx, &hcloud.Server{ID: svr.ID}, &hcloud.ServerCreateImageOpts{
+		Type:   hcloud.ImageTypeSnapshot,
+		Labels: map[string]string{dumpLabel: serverDumpID},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.store.StoreJournal(ctx, testProject, "web", &dump.Journal{
+		Operation: dump.OperationFreeze,
+		DumpID:    serverDumpID,
+		ServerID:  svr.ID,
+		Steps:     []string{"shutdown server web"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.FreezeServer(ctx, "web", FreezeOptions{}); err != nil {
+		t.Fatalf("resumed freeze failed: %v", err)
+	}
+	if images := fake.Images(); len(images) != 1 {
+		t.Errorf("%d snapshots, want the one of the interrupted run", len(images))
+	}
+	serverDump, err := p.store.Get(ctx, testProject, "web", serverDumpID)
+	if err != nil {
+		t.Fatalf("could not load dump: %v", err)
+	}
+	if serverDump.Snapshot.ID != res.Image.ID || serverDump.Snapshot.ImageSize == nil {
+		t.Errorf("dump has snapshot %+v, want the available snapshot %d", serverDump.Snapshot, res.Image.ID)
+	}
+}
+
+func TestDumpWithoutManifestIsPending(t *testing.T) {
+	ctx := context.Background()
+	_, p := newTestResolver(t)
+	// a dump interrupted after it was stored but before its manifest
+	serverDumpID := dump.NewID()
+	if err := p.store.Put(ctx, testProject, "web", serverDumpID, &dump.ServerDump{}); err != nil {
+		t.Fatal(err)
+	}
+	m, err := p.loadManifest(ctx, "web", serverDumpID)
+	if err != nil {
+		t.Fatalf("could not load manifest: %v", err)
+	}
+	if m.Status != dump.StatusPending {
+		t.Errorf("dump without manifest has status %s, want %s", m.Status, dump.StatusPending)
+	}
+	if _, err := p.latestServerDumpID(ctx, "web"); !errors.Is(err, errNoDumps) {
+		t.Errorf("latest dump returned %v, want no dumps", err)
+	}
+}
+
+func TestUnfreezePreflight(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	fake.AddServer("web", nil)
+	dumpID, err := p.FreezeServer(ctx, "web", FreezeOptions{})
+	if err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+	serverDump, err := p.store.Get(ctx, testProject, "web", dumpID)
+	if err != nil {
+		t.Fatalf("could not load dump: %v", err)
+	}
+	fake.DeleteImage(serverDump.Snapshot.ID)
+	fake.AddServer("web", nil)
+
+	err = p.UnfreezeServer(ctx, "web", "", UnfreezeOptions{})
+	var preflightErr *PreflightError
+	if !errors.As(err, &preflightErr) {
+		t.Fatalf("unfreeze returned %v, want a preflight error", err)
+	}
+	if len(preflightErr.Problems) != 2 {
+		t.Errorf("got problems %v, want existing server and missing snapshot", preflightErr.Problems)
+	}
+	if n := countRequests(fake, "POST /servers"); n != 0 {
+		t.Errorf("server created despite failed preflight check")
+	}
+}
+
+func TestWaitForActionPolls(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	fake.AddServer("web", nil)
+	fake.ActionPolls = 3
+
+	if _, err := p.FreezeServer(ctx, "web", FreezeOptions{}); err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+	if fake.Server("web") != nil {
+		t.Fatal("server still exists after freeze")
+	}
+	polls := 0
+	for _, r := range fake.Requests() {
+		if strings.HasPrefix(r, "GET /actions/") {
+			polls++
+		}
+	}
+	if polls == 0 {
+		t.Error("actions were not polled")
+	}
+}
@@ -0,0 +1,187 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+	"github.com/samber/lo"
+	"hetzner-freezer/dump"
+)
+
+// sshKeyServerLabel marks the ssh keys of a server, its value is the server
+// name. The api does not tell which keys a server was created with.
+const sshKeyServerLabel = "hetzner-freezer/server"
+
+const (
+	// SSHKeySourceFlag records keys given with the freeze.
+	SSHKeySourceFlag = "flag"
+	// SSHKeySourceLabel records keys labeled with the server name.
+	SSHKeySourceLabel = "label"
+	// SSHKeySourceDump records the keys of the previous dump of the server.
+	SSHKeySourceDump = "dump"
+	// SSHKeySourceNone records that no keys were found.
+	SSHKeySourceNone = "none"
+)
+
+// serverSSHKeys returns the ssh keys of the server and where they were taken
+// from: the names in opts, the keys labeled with the server name or the keys
+// of the previous dump, in that order.
+func (p *resolverService) serverSSHKeys(ctx context.Context, svr *hcloud.Server, opts FreezeOptions) ([]*hcloud.SSHKey, string, error) {
+	if len(opts.SSHKeys) > 0 {
+		keys, err := p.sshKeysByName(ctx, opts.SSHKeys)
+		return keys, SSHKeySourceFlag, err
+	}
+	keys, resp, err := p.client.SSHKey.List(ctx, hcloud.SSHKeyListOpts{
+		ListOpts: hcloud.ListOpts{LabelSelector: fmt.Sprintf("%s=%s", sshKeyServerLabel, svr.Name)},
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list ssh keys: %w", err)
+	}
+	defer resp.Body.Close()
+	if len(keys) > 0 {
+		return keys, SSHKeySourceLabel, nil
+	}
+	keys, err = p.previousSSHKeys(ctx, svr.Name)
+	if err != nil {
+		return nil, "", err
+	}
+	if keys != nil {
+		return keys, SSHKeySourceDump, nil
+	}
+	p.logger.Warnf("no ssh keys found for server %s, pass them with the freeze or label them with %s=%s", svr.Name, sshKeyServerLabel, svr.Name)
+	return nil, SSHKeySourceNone, nil
+}
+
+// sshKeysByName returns the ssh keys with the names.
+func (p *resolverService) sshKeysByName(ctx context.Context, names []string) ([]*hcloud.SSHKey, error) {
+	var keys []*hcloud.SSHKey
+	for _, name := range names {
+		key, resp, err := p.client.SSHKey.GetByName(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if key == nil {
+			return nil, fmt.Errorf("ssh key %s not found", name)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// previousSSHKeys returns the ssh keys of the latest dump of the server that
+// still exist, or nil if there is no such dump. Dumps that recorded every
+// key of the project or none are not used.
+func (p *resolverService) previousSSHKeys(ctx context.Context, serverName string) ([]*hcloud.SSHKey, error) {
+	previous, err := p.previousServerDump(ctx, serverName)
+	if err != nil || previous == nil {
+		return nil, err
+	}
+	if source := previous.SSHKeySelection.Source; source == dump.SSHKeySourceProject || source == SSHKeySourceNone {
+		return nil, nil
+	}
+	keys := []*hcloud.SSHKey{}
+	for _, dumped := range previous.SSHKeys {
+		key, resp, err := p.client.SSHKey.GetByID(ctx, dumped.ID)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if key == nil {
+			p.logger.Warnf("ssh key %s of the previous dump no longer exists", dumped.Name)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// resolveSSHKeys maps the ssh keys of the dump to the project of p.client.
+// Keys deleted from the project of the dump are left out with a warning,
+// keys missing in another project get id 0 and are created by the unfreeze.
+func (p *resolverService) resolveSSHKeys(ctx context.Context, serverDump *dump.ServerDump) (*dump.ServerDump, error) {
+	if serverDump.SSHKeySelection.Source == dump.SSHKeySourceProject && len(serverDump.SSHKeys) > 0 {
+		p.logger.Warnf("dump recorded every ssh key of the project, the server is created with all of them")
+	}
+	translated := *serverDump
+	translated.SSHKeys = nil
+	for _, dumped := range serverDump.SSHKeys {
+		key, err := p.findSSHKey(ctx, dumped)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case key != nil:
+			dumped = hcloud.SchemaFromSSHKey(key)
+		case p.source != nil:
+			dumped.ID = 0
+		default:
+			p.logger.Warnf("ssh key %s no longer exists, the server is created without it", dumped.Name)
+			continue
+		}
+		translated.SSHKeys = append(translated.SSHKeys, dumped)
+	}
+	return &translated, nil
+}
+
+// findSSHKey returns the ssh key of the project with the id, name or public
+// key of the dumped one, or nil if there is none. Ids are only looked up in
+// the project of the dump.
+func (p *resolverService) findSSHKey(ctx context.Context, dumped schema.SSHKey) (*hcloud.SSHKey, error) {
+	if p.source == nil && dumped.ID != 0 {
+		key, resp, err := p.client.SSHKey.GetByID(ctx, dumped.ID)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if key != nil {
+			return key, nil
+		}
+	}
+	key, resp, err := p.client.SSHKey.GetByName(ctx, dumped.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if key != nil || len(dumped.Fingerprint) == 0 {
+		return key, nil
+	}
+	key, resp, err = p.client.SSHKey.GetByFingerprint(ctx, dumped.Fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return key, nil
+}
+
+// createSSHKey creates the dumped ssh key and sets the id of key to the one
+// of the created key.
+func (p *resolverService) createSSHKey(ctx context.Context, dumped schema.SSHKey, key *hcloud.SSHKey) error {
+	existing, err := p.findSSHKey(ctx, dumped)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		key.ID = existing.ID
+		return nil
+	}
+	p.logger.Infof("create ssh key %s", dumped.Name)
+	created, resp, err := p.client.SSHKey.Create(ctx, hcloud.SSHKeyCreateOpts{
+		Name:      dumped.Name,
+		PublicKey: dumped.PublicKey,
+		Labels:    dumped.Labels,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create ssh key %s: %w", dumped.Name, err)
+	}
+	defer resp.Body.Close()
+	key.ID = created.ID
+	return nil
+}
+
+// sshKeyNames returns the names of the keys.
+func sshKeyNames(keys []*hcloud.SSHKey) []string {
+	return lo.Map(keys, func(item *hcloud.SSHKey, index int) string { return item.Name })
+}
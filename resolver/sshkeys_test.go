@@ -0,0 +1,94 @@
+package resolver
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestFreezeDumpsServerSSHKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     FreezeOptions
+		label    bool
+		previous bool
+		source   string
+		want     []string
+	}{
+		{name: "flag", opts: FreezeOptions{SSHKeys: []string{"other"}}, label: true, source: SSHKeySourceFlag, want: []string{"other"}},
+		{name: "label", label: true, source: SSHKeySourceLabel, want: []string{"admin"}},
+		{name: "previous dump", previous: true, source: SSHKeySourceDump, want: []string{"admin"}},
+		{name: "none", source: SSHKeySourceNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake, p := newTestResolver(t)
+			fake.AddServer("web", nil)
+			admin := fake.AddSSHKey("admin")
+			fake.AddSSHKey("other")
+			if tt.label || tt.previous {
+				fake.SetSSHKeyLabels(admin.ID, map[string]string{sshKeyServerLabel: "web"})
+			}
+			if tt.previous {
+				if _, err := p.FreezeServer(ctx, "web", FreezeOptions{}); err != nil {
+					t.Fatalf("freeze failed: %v", err)
+				}
+				if err := p.UnfreezeServer(ctx, "web", "", UnfreezeOptions{}); err != nil {
+					t.Fatalf("unfreeze failed: %v", err)
+				}
+				fake.SetSSHKeyLabels(admin.ID, map[string]string{})
+			}
+
+			dumpID, err := p.FreezeServer(ctx, "web", tt.opts)
+			if err != nil {
+				t.Fatalf("freeze failed: %v", err)
+			}
+			serverDump, err := p.store.Get(ctx, testProject, "web", dumpID)
+			if err != nil {
+				t.Fatalf("could not load dump: %v", err)
+			}
+			if serverDump.SSHKeySelection.Source != tt.source {
+				t.Errorf("ssh keys taken from %q, want %q", serverDump.SSHKeySelection.Source, tt.source)
+			}
+			var got []string
+			for _, key := range serverDump.SSHKeys {
+				got = append(got, key.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("dumped ssh keys %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnfreezeWithoutDeletedSSHKey(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	fake.AddServer("web", nil)
+	admin := fake.AddSSHKey("admin")
+	deploy := fake.AddSSHKey("deploy")
+	if _, err := p.FreezeServer(ctx, "web", FreezeOptions{SSHKeys: []string{"admin", "deploy"}}); err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+	fake.DeleteSSHKey(deploy.ID)
+
+	if err := p.UnfreezeServer(ctx, "web", "", UnfreezeOptions{}); err != nil {
+		t.Fatalf("unfreeze failed: %v", err)
+	}
+	if got := fake.SSHKeys("web"); !slices.Equal(got, []int64{admin.ID}) {
+		t.Errorf("server created with ssh keys %v, want %d", got, admin.ID)
+	}
+}
+
+func TestFreezeRejectsUnknownSSHKey(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	fake.AddServer("web", nil)
+	if _, err := p.FreezeServer(ctx, "web", FreezeOptions{SSHKeys: []string{"missing"}}); err == nil {
+		t.Fatal("freeze with an unknown ssh key succeeded")
+	}
+	if fake.Server("web") == nil {
+		t.Error("server was deleted")
+	}
+}
@@ -0,0 +1,175 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/samber/lo"
+	"hetzner-freezer/dump"
+)
+
+// unfreezeTarget is the server type and datacenter an unfreeze creates the
+// server with.
+type unfreezeTarget struct {
+	serverType *hcloud.ServerType
+	datacenter *hcloud.Datacenter
+}
+
+// dumpedTarget returns the server type and datacenter of the dump.
+func dumpedTarget(serverDump *dump.ServerDump) *unfreezeTarget {
+	return &unfreezeTarget{
+		serverType: hcloud.ServerTypeFromSchema(serverDump.Server.ServerType),
+		datacenter: hcloud.DatacenterFromSchema(serverDump.Server.Datacenter),
+	}
+}
+
+// resolveTarget picks the server type and datacenter of the unfreeze, the
+// overrides of opts or the ones of the dump. If a server type does not fit
+// the snapshot or is unavailable, the fallback server types are tried in
+// order. It returns problems if no server type is usable.
+func (p *resolverService) resolveTarget(ctx context.Context, serverDump *dump.ServerDump, opts UnfreezeOptions) (*unfreezeTarget, []string, error) {
+	datacenters, problems, err := p.targetDatacenters(ctx, serverDump, opts)
+	if err != nil || len(problems) > 0 {
+		return nil, problems, err
+	}
+	serverTypes, reasons, err := p.targetServerTypes(ctx, serverDump, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, serverType := range serverTypes {
+		if reason := serverTypeMismatch(serverType, serverDump); len(reason) > 0 {
+			reasons = append(reasons, reason)
+			continue
+		}
+		for _, dc := range datacenters {
+			if !lo.ContainsBy(dc.ServerTypes.Available, func(item *hcloud.ServerType) bool { return item.ID == serverType.ID }) {
+				continue
+			}
+			if i > 0 || len(reasons) > 0 {
+				p.logger.Warnf("use server type %s: %s", serverType.Name, strings.Join(reasons, "; "))
+			}
+			return &unfreezeTarget{serverType: serverType, datacenter: dc}, nil, nil
+		}
+		reasons = append(reasons, fmt.Sprintf("server type %s is not available in %s", serverType.Name,
+			strings.Join(lo.Map(datacenters, func(item *hcloud.Datacenter, index int) string { return item.Name }), ", ")))
+	}
+	return nil, []string{fmt.Sprintf("no usable server type: %s", strings.Join(reasons, "; "))}, nil
+}
+
+// targetDatacenters returns the datacenters the server may be created in.
+func (p *resolverService) targetDatacenters(ctx context.Context, serverDump *dump.ServerDump, opts UnfreezeOptions) ([]*hcloud.Datacenter, []string, error) {
+	switch {
+	case len(opts.Datacenter) > 0 && len(opts.Location) > 0:
+		return nil, nil, errors.New("either a datacenter or a location can be set")
+	case len(opts.Datacenter) > 0:
+		dc, resp, err := p.client.Datacenter.GetByName(ctx, opts.Datacenter)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer resp.Body.Close()
+		if dc == nil {
+			return nil, []string{fmt.Sprintf("datacenter %s does not exist", opts.Datacenter)}, nil
+		}
+		return []*hcloud.Datacenter{dc}, nil, nil
+	case len(opts.Location) > 0:
+		all, err := p.client.Datacenter.All(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list datacenters: %w", err)
+		}
+		dcs := lo.Filter(all, func(item *hcloud.Datacenter, index int) bool { return item.Location.Name == opts.Location })
+		if len(dcs) == 0 {
+			return nil, []string{fmt.Sprintf("location %s has no datacenters", opts.Location)}, nil
+		}
+		return dcs, nil, nil
+	}
+	dc, resp, err := p.client.Datacenter.GetByID(ctx, serverDump.Server.Datacenter.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if dc == nil {
+		return nil, []string{fmt.Sprintf("datacenter %s does not exist", serverDump.Server.Datacenter.Name)}, nil
+	}
+	return []*hcloud.Datacenter{dc}, nil, nil
+}
+
+// targetServerTypes returns the server type override or the dumped server
+// type followed by the fallback server types, and why missing ones were left
+// out.
+func (p *resolverService) targetServerTypes(ctx context.Context, serverDump *dump.ServerDump, opts UnfreezeOptions) ([]*hcloud.ServerType, []string, error) {
+	var serverTypes []*hcloud.ServerType
+	var reasons []string
+	if len(opts.ServerType) == 0 {
+		serverType, resp, err := p.client.ServerType.GetByID(ctx, serverDump.Server.ServerType.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer resp.Body.Close()
+		if serverType == nil {
+			reasons = append(reasons, fmt.Sprintf("server type %s does not exist", serverDump.Server.ServerType.Name))
+		} else {
+			serverTypes = append(serverTypes, serverType)
+		}
+	}
+	for _, name := range append(lo.Compact([]string{opts.ServerType}), opts.FallbackServerTypes...) {
+		serverType, resp, err := p.client.ServerType.GetByName(ctx, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer resp.Body.Close()
+		if serverType == nil {
+			reasons = append(reasons, fmt.Sprintf("server type %s does not exist", name))
+			continue
+		}
+		serverTypes = append(serverTypes, serverType)
+	}
+	return serverTypes, reasons, nil
+}
+
+// serverTypeMismatch returns why the snapshot of the dump cannot be restored
+// on the server type, or an empty string if it can.
+func serverTypeMismatch(serverType *hcloud.ServerType, serverDump *dump.ServerDump) string {
+	snapshot := serverDump.Snapshot
+	switch {
+	case serverType.IsDeprecated():
+		return fmt.Sprintf("server type %s is deprecated", serverType.Name)
+	case snapshot.DiskSize > float32(serverType.Disk):
+		return fmt.Sprintf("server type %s has %d GB disk, the snapshot needs %.0f GB", serverType.Name, serverType.Disk, snapshot.DiskSize)
+	case len(snapshot.Architecture) > 0 && string(serverType.Architecture) != snapshot.Architecture:
+		return fmt.Sprintf("server type %s is %s, the snapshot %s", serverType.Name, serverType.Architecture, snapshot.Architecture)
+	}
+	return ""
+}
+
+// journalTarget returns the server type and datacenter an unfinished
+// unfreeze picked, or the ones of the dump for journals that did not record
+// them.
+func (p *resolverService) journalTarget(ctx context.Context, j *journal, serverDump *dump.ServerDump) (*unfreezeTarget, error) {
+	target := dumpedTarget(serverDump)
+	if len(j.entry.ServerType) > 0 {
+		serverType, resp, err := p.client.ServerType.GetByName(ctx, j.entry.ServerType)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if serverType == nil {
+			return nil, fmt.Errorf("server type %s of the unfinished unfreeze does not exist", j.entry.ServerType)
+		}
+		target.serverType = serverType
+	}
+	if len(j.entry.Datacenter) > 0 {
+		dc, resp, err := p.client.Datacenter.GetByName(ctx, j.entry.Datacenter)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if dc == nil {
+			return nil, fmt.Errorf("datacenter %s of the unfinished unfreeze does not exist", j.entry.Datacenter)
+		}
+		target.datacenter = dc
+	}
+	return target, nil
+}
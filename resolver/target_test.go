@@ -0,0 +1,55 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestUnfreezeServerType(t *testing.T) {
+	tests := []struct {
+		name        string
+		unavailable bool
+		opts        UnfreezeOptions
+		want        string
+	}{
+		{name: "dumped", want: "cx11"},
+		{name: "override", opts: UnfreezeOptions{ServerType: "cpx11"}, want: "cpx11"},
+		{name: "fallback", unavailable: true, opts: UnfreezeOptions{FallbackServerTypes: []string{"cax11", "cx21"}}, want: "cx21"},
+		{name: "no fallback", unavailable: true},
+		{name: "other architecture", opts: UnfreezeOptions{ServerType: "cax11"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake, p := newTestResolver(t)
+			fake.AddServer("web", nil)
+			if _, err := p.FreezeServer(ctx, "web", FreezeOptions{}); err != nil {
+				t.Fatalf("freeze failed: %v", err)
+			}
+			fake.SetServerTypeAvailable("cx11", !tt.unavailable)
+
+			err := p.UnfreezeServer(ctx, "web", "", tt.opts)
+			if len(tt.want) == 0 {
+				var preflightErr *PreflightError
+				if !errors.As(err, &preflightErr) {
+					t.Fatalf("unfreeze returned %v, want a preflight error", err)
+				}
+				if fake.Server("web") != nil {
+					t.Error("server was created")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unfreeze failed: %v", err)
+			}
+			restored := fake.Server("web")
+			if restored == nil {
+				t.Fatal("server not restored")
+			}
+			if restored.ServerType.Name != tt.want {
+				t.Errorf("server type is %s, want %s", restored.ServerType.Name, tt.want)
+			}
+		})
+	}
+}
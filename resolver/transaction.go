@@ -0,0 +1,200 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/sirupsen/logrus"
+	"hetzner-freezer/dump"
+)
+
+const rollbackDeadline = 15 * time.Minute
+
+// step is a single unit of work of a multi-step operation. undo reverts the
+// effects of do and must be safe to call even if do only partially succeeded.
+// Steps without undo cannot be compensated. A final step is the point of no
+// return of an operation, once it is done failures are no longer compensated.
+// The name identifies the step in the journal, details are only shown in plans.
+type step struct {
+	name    string
+	details string
+	do      func(ctx context.Context) error
+	undo    func(ctx context.Context) error
+	final   bool
+}
+
+// RollbackError is returned when a step of an operation failed and the steps
+// that had already been executed were compensated.
+type RollbackError struct {
+	Step          string
+	Err           error
+	Compensated   []string
+	Uncompensated []string
+	UndoErrors    []error
+}
+
+func (e *RollbackError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "step '%s' failed: %v", e.Step, e.Err)
+	if len(e.Compensated) > 0 {
+		fmt.Fprintf(&sb, "; compensated steps: %s", strings.Join(e.Compensated, ", "))
+	}
+	if len(e.Uncompensated) > 0 {
+		fmt.Fprintf(&sb, "; steps left as is: %s", strings.Join(e.Uncompensated, ", "))
+	}
+	for _, err := range e.UndoErrors {
+		fmt.Fprintf(&sb, "; %v", err)
+	}
+	return sb.String()
+}
+
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+// IncompleteError is returned when a step failed after the point of no return
+// of an operation. Nothing was compensated, the journal keeps the steps done so
+// far and a rerun resumes the operation.
+type IncompleteError struct {
+	Step            string
+	Err             error
+	PointOfNoReturn string
+}
+
+func (e *IncompleteError) Error() string {
+	return fmt.Sprintf("step '%s' failed after '%s', which cannot be reverted: %v; rerun to resume", e.Step, e.PointOfNoReturn, e.Err)
+}
+
+func (e *IncompleteError) Unwrap() error {
+	return e.Err
+}
+
+// journal persists which steps of an operation are done, so that a rerun
+// after an interruption skips them. A nil journal persists nothing.
+type journal struct {
+	store      dump.Store
+	project    string
+	serverName string
+	entry      *dump.Journal
+}
+
+func (j *journal) done(name string) bool {
+	if j == nil {
+		return false
+	}
+	return lo.Contains(j.entry.Steps, name)
+}
+
+func (j *journal) save(ctx context.Context) error {
+	return j.store.StoreJournal(ctx, j.project, j.serverName, j.entry)
+}
+
+func (j *journal) markDone(ctx context.Context, name string) error {
+	if j == nil || j.done(name) {
+		return nil
+	}
+	j.entry.Steps = append(j.entry.Steps, name)
+	return j.save(ctx)
+}
+
+func (j *journal) markUndone(ctx context.Context, name string) error {
+	if j == nil {
+		return nil
+	}
+	j.entry.Steps = lo.Without(j.entry.Steps, name)
+	if len(j.entry.Steps) == 0 {
+		return j.remove(ctx)
+	}
+	return j.save(ctx)
+}
+
+func (j *journal) remove(ctx context.Context) error {
+	if j == nil {
+		return nil
+	}
+	return j.store.RemoveJournal(ctx, j.project, j.serverName)
+}
+
+type transaction struct {
+	logger  *logrus.Logger
+	journal *journal
+	done    []step
+	// committed is the final step that was done, if any
+	committed string
+}
+
+func newTransaction(logger *logrus.Logger, j *journal) *transaction {
+	return &transaction{logger: logger, journal: j}
+}
+
+// run executes the steps in order, skipping the ones the journal records as
+// done. If a step fails or the context is cancelled, every step executed so
+// far, including the failed one, is undone in reverse order and a
+// *RollbackError is returned. Steps that cannot be undone stay in the journal,
+// so the operation can be resumed. Once a final step is done nothing is undone
+// anymore, failures return an *IncompleteError and keep the journal.
+func (t *transaction) run(ctx context.Context, steps []step) error {
+	for _, s := range steps {
+		if t.journal.done(s.name) {
+			t.logger.Infof("skip step '%s', already done", s.name)
+			t.done = append(t.done, s)
+			if s.final {
+				t.committed = s.name
+			}
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return t.fail(ctx, s.name, fmt.Errorf("operation cancelled: %w", err))
+		}
+		t.done = append(t.done, s)
+		if err := s.do(ctx); err != nil {
+			return t.fail(ctx, s.name, err)
+		}
+		if s.final {
+			t.committed = s.name
+		}
+		if err := t.journal.markDone(ctx, s.name); err != nil {
+			return t.fail(ctx, s.name, err)
+		}
+	}
+	return t.journal.remove(ctx)
+}
+
+// fail rolls the operation back, unless it is past its point of no return.
+func (t *transaction) fail(ctx context.Context, failed string, cause error) error {
+	if len(t.committed) == 0 {
+		return t.rollback(ctx, failed, cause)
+	}
+	t.logger.Errorf("step '%s' failed after '%s', keep the journal to resume: %v", failed, t.committed, cause)
+	return &IncompleteError{Step: failed, Err: cause, PointOfNoReturn: t.committed}
+}
+
+func (t *transaction) rollback(ctx context.Context, failed string, cause error) error {
+	t.logger.Errorf("step '%s' failed: %v", failed, cause)
+	// compensation must run even if the operation was cancelled
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackDeadline)
+	defer cancel()
+	rbErr := &RollbackError{Step: failed, Err: cause}
+	for i := len(t.done) - 1; i >= 0; i-- {
+		s := t.done[i]
+		if s.undo == nil {
+			rbErr.Uncompensated = append(rbErr.Uncompensated, s.name)
+			continue
+		}
+		t.logger.Infof("undo step '%s'", s.name)
+		if err := s.undo(ctx); err != nil {
+			t.logger.Errorf("could not undo step '%s': %v", s.name, err)
+			rbErr.UndoErrors = append(rbErr.UndoErrors, fmt.Errorf("failed to undo '%s': %w", s.name, err))
+			continue
+		}
+		rbErr.Compensated = append(rbErr.Compensated, s.name)
+		if err := t.journal.markUndone(ctx, s.name); err != nil {
+			rbErr.UndoErrors = append(rbErr.UndoErrors, err)
+		}
+	}
+	t.done = nil
+	return rbErr
+}
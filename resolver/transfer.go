@@ -0,0 +1,101 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+	"github.com/samber/lo"
+	"hetzner-freezer/dump"
+)
+
+// inProject returns a copy of p that unfreezes into the project of client.
+// The project of p is still used to find the dumps and to look up the names
+// of the resources they refer to.
+func (p *resolverService) inProject(client *hcloud.Client) *resolverService {
+	target := *p
+	target.source = p.client
+	target.client = client
+	return &target
+}
+
+// resolveDump translates the dump into the project of p.client, which is
+// another project if p.source is set. It returns the problems that keep the
+// server from being unfrozen there.
+func (p *resolverService) resolveDump(ctx context.Context, serverDump *dump.ServerDump, opts UnfreezeOptions) (*dump.ServerDump, []string, error) {
+	var problems []string
+	if p.source != nil {
+		translated, found, err := p.transferDump(ctx, serverDump, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		serverDump = translated
+		problems = append(problems, found...)
+	}
+	serverDump, err := p.resolveSSHKeys(ctx, serverDump)
+	if err != nil {
+		return nil, nil, err
+	}
+	serverDump, err = p.resolveVolumeNames(ctx, serverDump)
+	if err != nil {
+		return nil, nil, err
+	}
+	translated, found, err := p.resolveDefinitions(ctx, serverDump)
+	if err != nil {
+		return nil, nil, err
+	}
+	return translated, append(problems, found...), nil
+}
+
+// transferDump translates the dump into the project of p.client, so the
+// server can be unfrozen there. Resources that cannot be moved between
+// projects are left out and the workaround is logged. It returns problems if the dump cannot be translated.
+func (p *resolverService) transferDump(ctx context.Context, serverDump *dump.ServerDump, opts UnfreezeOptions) (*dump.ServerDump, []string, error) {
+	translated := *serverDump
+	var notes, problems []string
+
+	// the snapshot is left out until an image of the project replaces it
+	translated.Snapshot = schema.Image{}
+	if len(opts.TargetImage) == 0 {
+		problems = append(problems, fmt.Sprintf("snapshot %d cannot be transferred to another project, set a target image to create the server from", serverDump.Snapshot.ID))
+	} else {
+		img, resp, err := p.client.Image.Get(ctx, opts.TargetImage)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer resp.Body.Close()
+		if img == nil {
+			problems = append(problems, fmt.Sprintf("image %s does not exist in the target project", opts.TargetImage))
+		} else {
+			notes = append(notes, fmt.Sprintf("snapshot %d cannot be transferred to another project, the server is created from image %s", serverDump.Snapshot.ID, describeID(img.Name, img.ID)))
+			translated.Snapshot = hcloud.SchemaFromImage(img)
+		}
+	}
+
+	publicNet := serverDump.Server.PublicNet
+	if (publicNet.IPv4.ID != 0 || publicNet.IPv6.ID != 0) && serverDump.PrimaryIPs.Policy != IPPolicyRelease {
+		notes = append(notes, "primary ips cannot be transferred to another project, the server gets new addresses")
+		translated.PrimaryIPs.Policy = IPPolicyRelease
+	}
+	for _, fIP := range serverDump.FloatingIPs {
+		notes = append(notes, fmt.Sprintf("floating ip %s cannot be transferred to another project, it stays in the source project", fIP.IP))
+	}
+	translated.FloatingIPs = nil
+	translated.ReverseDNS = lo.Filter(serverDump.ReverseDNS, func(item dump.ReverseDNS, index int) bool { return item.FloatingIPID == 0 })
+
+	translated.Volumes = nil
+	translated.Server.Volumes = nil
+	for _, dumped := range serverDump.Volumes {
+		if dumped.Archived {
+			translated.Volumes = append(translated.Volumes, dumped)
+			continue
+		}
+		notes = append(notes, fmt.Sprintf("volume %s cannot be transferred to another project, freeze with volume mode %s to move its data", dumped.Name, VolumeModeArchive))
+	}
+
+	for _, note := range notes {
+		p.logger.Warnf("%s", note)
+	}
+	return &translated, problems, nil
+}
@@ -0,0 +1,135 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"hetzner-freezer/fakehcloud"
+)
+
+// newTransferSource creates server web with an ssh key, a firewall, a
+// network, a placement group and a floating ip.
+func newTransferSource(t *testing.T) (*fakehcloud.Fake, *resolverService) {
+	t.Helper()
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	img := fake.AddImage("ubuntu-22.04", 20)
+	key := fake.AddSSHKey("alice")
+	fwRes, _, err := p.client.Firewall.Create(ctx, hcloud.FirewallCreateOpts{
+		Name: "web",
+		Rules: []hcloud.FirewallRule{{
+			Direction: hcloud.FirewallRuleDirectionIn,
+			SourceIPs: []net.IPNet{{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}},
+			Protocol:  hcloud.FirewallRuleProtocolTCP,
+			Port:      hcloud.Ptr("443"),
+		}},
+		ApplyTo: []hcloud.FirewallResource{{
+			Type:          hcloud.FirewallResourceTypeLabelSelector,
+			LabelSelector: &hcloud.FirewallResourceLabelSelector{Selector: "role=web"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("could not create firewall: %v", err)
+	}
+	fw := fwRes.Firewall
+	network := fake.AddNetwork("backend", "10.0.0.0/16")
+	pg := fake.AddPlacementGroup("spread")
+	res, _, err := p.client.Server.Create(ctx, hcloud.ServerCreateOpts{
+		Name:           "web",
+		ServerType:     &hcloud.ServerType{Name: "cx11"},
+		Image:          &hcloud.Image{ID: img.ID},
+		SSHKeys:        []*hcloud.SSHKey{{ID: key.ID}},
+		Firewalls:      []*hcloud.ServerCreateFirewall{{Firewall: hcloud.Firewall{ID: fw.ID}}},
+		Networks:       []*hcloud.Network{{ID: network.ID}},
+		PlacementGroup: &hcloud.PlacementGroup{ID: pg.ID},
+	})
+	if err != nil {
+		t.Fatalf("could not create server: %v", err)
+	}
+	fake.AddFloatingIP("198.51.100.10", res.Server.ID)
+	return fake, p
+}
+
+func TestUnfreezeIntoAnotherProject(t *testing.T) {
+	ctx := context.Background()
+	source, p := newTransferSource(t)
+	if _, err := p.FreezeServer(ctx, "web", FreezeOptions{SSHKeys: []string{"alice"}}); err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+
+	target := fakehcloud.New()
+	t.Cleanup(target.Close)
+	img := target.AddImage("ubuntu-22.04", 20)
+	fw := target.AddFirewall("web")
+
+	opts := UnfreezeOptions{Target: target.Client(), TargetImage: "ubuntu-22.04"}
+	if err := p.UnfreezeServer(ctx, "web", "", opts); err != nil {
+		t.Fatalf("unfreeze failed: %v", err)
+	}
+	if source.Server("web") != nil {
+		t.Error("server was recreated in the source project")
+	}
+	restored := target.Server("web")
+	if restored == nil {
+		t.Fatal("server not restored in the target project")
+	}
+	if restored.Image == nil || restored.Image.ID != img.ID {
+		t.Errorf("server created from image %+v, want %d", restored.Image, img.ID)
+	}
+	if len(restored.PublicNet.Firewalls) != 1 || restored.PublicNet.Firewalls[0].ID != fw.ID {
+		t.Errorf("server has firewalls %+v, want %d", restored.PublicNet.Firewalls, fw.ID)
+	}
+	network := target.Network("backend")
+	if network == nil || network.IPRange != "10.0.0.0/16" {
+		t.Fatalf("network not created from its definition: %+v", network)
+	}
+	if len(restored.PrivateNet) != 1 || restored.PrivateNet[0].Network != network.ID {
+		t.Errorf("server has networks %+v, want %d", restored.PrivateNet, network.ID)
+	}
+	if restored.PlacementGroup == nil || restored.PlacementGroup.Name != "spread" {
+		t.Errorf("server has placement group %+v, want spread", restored.PlacementGroup)
+	}
+	key, _, err := target.Client().SSHKey.GetByName(ctx, "alice")
+	if err != nil || key == nil {
+		t.Fatalf("ssh key not created in the target project: %v", err)
+	}
+	if !strings.HasSuffix(key.PublicKey, " alice") {
+		t.Errorf("ssh key created with public key %q", key.PublicKey)
+	}
+	if restored.PublicNet.IPv4.IP == "198.51.100.10" || len(restored.PublicNet.FloatingIPs) > 0 {
+		t.Errorf("floating ip was transferred: %+v", restored.PublicNet)
+	}
+}
+
+func TestUnfreezeIntoAnotherProjectReportsProblems(t *testing.T) {
+	ctx := context.Background()
+	_, p := newTransferSource(t)
+	if _, err := p.FreezeServer(ctx, "web", FreezeOptions{}); err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+
+	target := fakehcloud.New()
+	t.Cleanup(target.Close)
+
+	err := p.UnfreezeServer(ctx, "web", "", UnfreezeOptions{Target: target.Client()})
+	var preflightErr *PreflightError
+	if !errors.As(err, &preflightErr) {
+		t.Fatalf("unfreeze returned %v, want a preflight error", err)
+	}
+	want := []string{"snapshot"}
+	if len(preflightErr.Problems) != len(want) {
+		t.Fatalf("problems %v, want %d", preflightErr.Problems, len(want))
+	}
+	for i, problem := range preflightErr.Problems {
+		if !strings.HasPrefix(problem, want[i]) {
+			t.Errorf("problem %q, want %s", problem, want[i])
+		}
+	}
+	if target.Server("web") != nil {
+		t.Error("server was created")
+	}
+}
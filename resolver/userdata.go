@@ -0,0 +1,59 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"hetzner-freezer/cloudinit"
+	"hetzner-freezer/dump"
+)
+
+// readUserData returns the cloud-init user data in the file, or an empty
+// string if no file is set.
+func readUserData(file string) (string, error) {
+	if len(file) == 0 {
+		return "", nil
+	}
+	bb, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read user data: %w", err)
+	}
+	if err := cloudinit.Validate(string(bb)); err != nil {
+		return "", fmt.Errorf("invalid user data in %s: %w", file, err)
+	}
+	return string(bb), nil
+}
+
+// serverUserData returns the user data to dump for the server: the one of
+// the freeze options, or else the one of the previous dump of the server.
+func (p *resolverService) serverUserData(ctx context.Context, svr *hcloud.Server, opts FreezeOptions) (string, error) {
+	if len(opts.UserDataFile) > 0 {
+		return readUserData(opts.UserDataFile)
+	}
+	previous, err := p.previousServerDump(ctx, svr.Name)
+	if err != nil || previous == nil {
+		return "", err
+	}
+	return previous.UserData, nil
+}
+
+// unfreezeUserData returns the user data the server is recreated with: the
+// one of the unfreeze options or the dump, with the config of the floating
+// ips added.
+func unfreezeUserData(serverDump *dump.ServerDump, floatingIPs []*hcloud.FloatingIP, opts UnfreezeOptions) (string, error) {
+	userData := serverDump.UserData
+	if len(opts.UserDataFile) > 0 {
+		var err error
+		userData, err = readUserData(opts.UserDataFile)
+		if err != nil {
+			return "", err
+		}
+	}
+	cfg := cloudinit.Config{UserData: userData, Renderer: opts.NetworkRenderer}
+	for _, fIP := range floatingIPs {
+		cfg.Addresses = append(cfg.Addresses, cloudinit.FloatingIPAddress(fIP))
+	}
+	return cloudinit.Compose(cfg)
+}
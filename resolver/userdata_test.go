@@ -0,0 +1,72 @@
+package resolver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hetzner-freezer/cloudinit"
+)
+
+func TestUnfreezeKeepsUserData(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	svr := fake.AddServer("web", nil)
+	fake.AddFloatingIP("198.51.100.10", svr.ID)
+	fake.AddFloatingIP("2001:db8:1::/64", svr.ID)
+	script := "#!/bin/sh\necho hello\n"
+	userDataFile := filepath.Join(t.TempDir(), "user-data")
+	if err := os.WriteFile(userDataFile, []byte(script), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.FreezeServer(ctx, "web", FreezeOptions{UserDataFile: userDataFile}); err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+	if err := p.UnfreezeServer(ctx, "web", "", UnfreezeOptions{}); err != nil {
+		t.Fatalf("unfreeze failed: %v", err)
+	}
+	userData := fake.UserData("web")
+	for _, want := range []string{script, "198.51.100.10/32", "2001:db8:1::1/64", "/etc/netplan/60-floating-ip.yaml"} {
+		if !strings.Contains(userData, want) {
+			t.Errorf("user data does not contain %q:\n%s", want, userData)
+		}
+	}
+
+	// the next freeze keeps the user data of the previous dump
+	dumpID, err := p.FreezeServer(ctx, "web", FreezeOptions{})
+	if err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+	serverDump, err := p.store.Get(ctx, testProject, "web", dumpID)
+	if err != nil {
+		t.Fatalf("could not load dump: %v", err)
+	}
+	if serverDump.UserData != script {
+		t.Errorf("dump has user data %q, want %q", serverDump.UserData, script)
+	}
+	if err := p.UnfreezeServer(ctx, "web", "", UnfreezeOptions{NetworkRenderer: cloudinit.RendererNetworkd}); err != nil {
+		t.Fatalf("unfreeze failed: %v", err)
+	}
+	if userData := fake.UserData("web"); !strings.Contains(userData, script) || !strings.Contains(userData, "Address=2001:db8:1::1/64") {
+		t.Errorf("user data does not contain the script and the networkd config:\n%s", userData)
+	}
+}
+
+func TestFreezeRejectsUnsupportedUserData(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	fake.AddServer("web", nil)
+	userDataFile := filepath.Join(t.TempDir(), "user-data")
+	if err := os.WriteFile(userDataFile, []byte("hello"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.FreezeServer(ctx, "web", FreezeOptions{UserDataFile: userDataFile}); err == nil {
+		t.Fatal("freeze with unsupported user data succeeded")
+	}
+	if fake.Server("web") == nil {
+		t.Error("server was deleted")
+	}
+}
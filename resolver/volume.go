@@ -0,0 +1,175 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/samber/lo"
+	"hetzner-freezer/dump"
+)
+
+// serverVolumes returns the specs of the volumes attached to the server.
+func (p *resolverService) serverVolumes(ctx context.Context, svr *hcloud.Server) ([]dump.Volume, error) {
+	var volumes []dump.Volume
+	for _, attached := range svr.Volumes {
+		vol, resp, err := p.client.Volume.GetByID(ctx, attached.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get volume %d: %w", attached.ID, err)
+		}
+		defer resp.Body.Close()
+		if vol == nil {
+			return nil, fmt.Errorf("volume %d of server %s not found", attached.ID, svr.Name)
+		}
+		format, err := p.volumeFormat(ctx, vol.ID)
+		if err != nil {
+			return nil, err
+		}
+		var location string
+		if vol.Location != nil {
+			location = vol.Location.Name
+		}
+		volumes = append(volumes, dump.Volume{
+			ID:       vol.ID,
+			Name:     vol.Name,
+			Size:     vol.Size,
+			Location: location,
+			Format:   format,
+			// the api does not tell how a volume is mounted, but only volumes
+			// formatted by hetzner can be automounted
+			Automount:   len(format) > 0,
+			LinuxDevice: vol.LinuxDevice,
+		})
+	}
+	return volumes, nil
+}
+
+// volumeFormat returns the filesystem a volume was formatted with on
+// creation, which the client library does not expose.
+func (p *resolverService) volumeFormat(ctx context.Context, volumeID int64) (string, error) {
+	req, err := p.client.NewRequest(ctx, "GET", fmt.Sprintf("/volumes/%d", volumeID), nil)
+	if err != nil {
+		return "", err
+	}
+	var body struct {
+		Volume struct {
+			Format *string `json:"format"`
+		} `json:"volume"`
+	}
+	resp, err := p.client.Do(req, &body)
+	if err != nil {
+		return "", fmt.Errorf("failed to get format of volume %d: %w", volumeID, err)
+	}
+	defer resp.Body.Close()
+	return lo.FromPtr(body.Volume.Format), nil
+}
+
+// resolveVolume returns the volume the dumped volume refers to, looking it up
+// by name if it no longer exists under its id and byName is set. It returns
+// nil if there is no such volume.
+func (p *resolverService) resolveVolume(ctx context.Context, dumped dump.Volume, byName bool) (*hcloud.Volume, error) {
+	vol, resp, err := p.client.Volume.GetByID(ctx, dumped.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// volumes of dumps written before volume specs were recorded have no
+	// name to look them up by
+	if vol != nil || !byName || len(dumped.Name) == 0 {
+		return vol, nil
+	}
+	vol, resp, err = p.client.Volume.GetByName(ctx, dumped.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if vol != nil {
+		p.logger.Infof("volume %d not found, use volume %d with name %s", dumped.ID, vol.ID, vol.Name)
+	}
+	return vol, nil
+}
+
+// resolveVolumeNames returns the dump with the names of volumes it did not
+// record, looked up by their ids. Volumes that no longer exist keep no name.
+func (p *resolverService) resolveVolumeNames(ctx context.Context, serverDump *dump.ServerDump) (*dump.ServerDump, error) {
+	if !lo.ContainsBy(serverDump.Volumes, func(item dump.Volume) bool { return len(item.Name) == 0 }) {
+		return serverDump, nil
+	}
+	resolved := *serverDump
+	resolved.Volumes = slices.Clone(serverDump.Volumes)
+	for i, dumped := range resolved.Volumes {
+		if len(dumped.Name) > 0 {
+			continue
+		}
+		vol, resp, err := p.client.Volume.GetByID(ctx, dumped.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get volume %d: %w", dumped.ID, err)
+		}
+		defer resp.Body.Close()
+		if vol != nil {
+			resolved.Volumes[i].Name = vol.Name
+		}
+	}
+	return &resolved, nil
+}
+
+// volumeName returns the name of the dumped volume for messages, or its id if
+// the dump did not record the name.
+func volumeName(dumped dump.Volume) string {
+	if len(dumped.Name) == 0 {
+		return fmt.Sprintf("%d", dumped.ID)
+	}
+	return dumped.Name
+}
+
+func (p *resolverService) detachVolumeStep(svr *hcloud.Server, vol dump.Volume) step {
+	return step{
+		name: fmt.Sprintf("detach volume %s", vol.Name),
+		do: func(ctx context.Context) error {
+			current, resp, err := p.client.Volume.GetByID(ctx, vol.ID)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if current == nil {
+				return fmt.Errorf("volume %d not found", vol.ID)
+			}
+			if current.Server == nil {
+				return nil
+			}
+			p.logger.Infof("detach volume %s from server", vol.Name)
+			return p.runAction(ctx, "detach volume", func() (*hcloud.Action, *hcloud.Response, error) {
+				return p.client.Volume.Detach(ctx, current)
+			})
+		},
+		undo: func(ctx context.Context) error {
+			return p.attachVolume(ctx, vol.ID, svr, vol.Automount)
+		},
+	}
+}
+
+// attachVolume attaches the volume to the server unless it is already
+// attached to it.
+func (p *resolverService) attachVolume(ctx context.Context, volumeID int64, svr *hcloud.Server, automount bool) error {
+	vol, resp, err := p.client.Volume.GetByID(ctx, volumeID)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if vol == nil {
+		return fmt.Errorf("volume %d not found", volumeID)
+	}
+	if vol.Server != nil {
+		if vol.Server.ID == svr.ID {
+			return nil
+		}
+		return fmt.Errorf("volume %s is attached to server %d", vol.Name, vol.Server.ID)
+	}
+	return p.runAction(ctx, "attach volume", func() (*hcloud.Action, *hcloud.Response, error) {
+		return p.client.Volume.AttachWithOpts(ctx, vol, hcloud.VolumeAttachOpts{
+			Server:    svr,
+			Automount: &automount,
+		})
+	})
+}
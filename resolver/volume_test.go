@@ -0,0 +1,100 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"hetzner-freezer/dump"
+)
+
+func TestFreezeUnfreezeVolumes(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	svr := fake.AddServer("web", nil)
+	vol := fake.AddVolume("data", 50, "ext4", svr.ID)
+
+	dumpID, err := p.FreezeServer(ctx, "web", FreezeOptions{})
+	if err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+	if got := fake.Volume(vol.ID); got.Server != nil {
+		t.Errorf("volume still attached to server %d", *got.Server)
+	}
+	serverDump, err := p.store.Get(ctx, testProject, "web", dumpID)
+	if err != nil {
+		t.Fatalf("could not load dump: %v", err)
+	}
+	if len(serverDump.Volumes) != 1 {
+		t.Fatalf("dump has volumes %+v, want one", serverDump.Volumes)
+	}
+	dumped := serverDump.Volumes[0]
+	if dumped.Name != "data" || dumped.Size != 50 || dumped.Format != "ext4" || !dumped.Automount || dumped.Location != "fsn1" {
+		t.Errorf("dumped volume is %+v", dumped)
+	}
+
+	if err := p.UnfreezeServer(ctx, "web", "", UnfreezeOptions{}); err != nil {
+		t.Fatalf("unfreeze failed: %v", err)
+	}
+	restored := fake.Server("web")
+	if got := fake.Volume(vol.ID); restored == nil || got.Server == nil || *got.Server != restored.ID {
+		t.Fatal("volume not attached to restored server")
+	}
+	if !fake.VolumeAutomounted(vol.ID) {
+		t.Error("volume attached without automount")
+	}
+}
+
+func TestUnfreezeVolumesByName(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	svr := fake.AddServer("web", nil)
+	vol := fake.AddVolume("data", 50, "", svr.ID)
+	if _, err := p.FreezeServer(ctx, "web", FreezeOptions{}); err != nil {
+		t.Fatalf("freeze failed: %v", err)
+	}
+	fake.DeleteVolume(vol.ID)
+	replacement := fake.AddVolume("data", 50, "", 0)
+
+	err := p.UnfreezeServer(ctx, "web", "", UnfreezeOptions{})
+	var preflightErr *PreflightError
+	if !errors.As(err, &preflightErr) {
+		t.Fatalf("unfreeze returned %v, want a preflight error", err)
+	}
+
+	if err := p.UnfreezeServer(ctx, "web", "", UnfreezeOptions{VolumesByName: true}); err != nil {
+		t.Fatalf("unfreeze failed: %v", err)
+	}
+	restored := fake.Server("web")
+	if got := fake.Volume(replacement.ID); restored == nil || got.Server == nil || *got.Server != restored.ID {
+		t.Error("volume with the same name not attached to restored server")
+	}
+	if fake.VolumeAutomounted(replacement.ID) {
+		t.Error("unformatted volume attached with automount")
+	}
+}
+
+func TestResolveVolumeNames(t *testing.T) {
+	ctx := context.Background()
+	fake, p := newTestResolver(t)
+	vol := fake.AddVolume("data", 50, "", 0)
+	gone := fake.AddVolume("logs", 10, "", 0)
+	fake.DeleteVolume(gone.ID)
+	// dumps written before volume specs were recorded only know the ids
+	serverDump := &dump.ServerDump{Volumes: []dump.Volume{{ID: vol.ID}, {ID: gone.ID}}}
+
+	resolved, err := p.resolveVolumeNames(ctx, serverDump)
+	if err != nil {
+		t.Fatalf("could not resolve volume names: %v", err)
+	}
+	if resolved.Volumes[0].Name != "data" || len(resolved.Volumes[1].Name) > 0 {
+		t.Errorf("resolved volumes %+v, want the name of the existing one only", resolved.Volumes)
+	}
+	if len(serverDump.Volumes[0].Name) > 0 {
+		t.Error("loaded dump changed")
+	}
+	missing, err := p.resolveVolume(ctx, resolved.Volumes[1], true)
+	if err != nil || missing != nil {
+		t.Errorf("volume without a name resolved to %+v, error %v", missing, err)
+	}
+}
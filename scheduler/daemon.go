@@ -0,0 +1,251 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"hetzner-freezer/dump"
+	"hetzner-freezer/resolver"
+
+	// the timezones of schedules do not depend on the zoneinfo of the host
+	_ "time/tzdata"
+)
+
+// maxWait is the longest the daemon sleeps, so changes of the clock are
+// noticed.
+const maxWait = time.Minute
+
+// Resolver runs the operations of the daemon, see resolver.Resolver.
+type Resolver interface {
+	FreezeServer(ctx context.Context, serverName string, opts resolver.FreezeOptions) (string, error)
+	UnfreezeServer(ctx context.Context, serverName string, serverDumpID string, opts resolver.UnfreezeOptions) error
+	FreezeGroup(ctx context.Context, selector string, parallelism int, opts resolver.FreezeOptions) (*resolver.GroupResult, error)
+	UnfreezeGroup(ctx context.Context, selector string, groupID string, parallelism int, opts resolver.UnfreezeOptions) (*resolver.GroupResult, error)
+}
+
+// Options configure the daemon.
+type Options struct {
+	// StateFile persists the runs of the schedules between restarts.
+	StateFile string
+	// CatchUp is how late a run missed while the daemon was stopped is
+	// still started.
+	CatchUp time.Duration
+	// Parallelism is the number of servers of a selector processed at the
+	// same time.
+	Parallelism int
+	// Freeze are the options of freezes, schedule entries can replace them.
+	Freeze   resolver.FreezeOptions
+	Unfreeze resolver.UnfreezeOptions
+}
+
+// Daemon freezes and unfreezes servers on their schedules. Operations of an
+// entry never overlap, and the resolver refuses concurrent operations on
+// the same server.
+type Daemon struct {
+	logger   *logrus.Logger
+	resolver Resolver
+	schedule *Schedule
+	opts     Options
+	now      func() time.Time
+
+	mu    sync.Mutex
+	state *State
+	// running are the names of the entries with a running operation
+	running map[string]bool
+	wg      sync.WaitGroup
+}
+
+func NewDaemon(logger *logrus.Logger, r Resolver, schedule *Schedule, opts Options) *Daemon {
+	return &Daemon{
+		logger:   logger,
+		resolver: r,
+		schedule: schedule,
+		opts:     opts,
+		now:      time.Now,
+		running:  map[string]bool{},
+	}
+}
+
+// Run runs the schedules until ctx is done and waits for running operations
+// to finish.
+func (d *Daemon) Run(ctx context.Context) error {
+	unlock, err := lockFile(d.opts.StateFile + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := d.load(); err != nil {
+		return err
+	}
+	d.resume(ctx)
+	for {
+		now := d.now()
+		d.tick(ctx, now)
+		wait := maxWait
+		if next := d.next(now); !next.IsZero() && next.Sub(now) < wait {
+			wait = next.Sub(now)
+		}
+		select {
+		case <-ctx.Done():
+			d.logger.Infof("stop daemon, waiting for running operations")
+			d.wg.Wait()
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// load reads the state file.
+func (d *Daemon) load() error {
+	state, err := loadState(d.opts.StateFile)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.state = state
+	return nil
+}
+
+// resume starts the operations the daemon was stopped during again, the
+// resolver continues them from their journals.
+func (d *Daemon) resume(ctx context.Context) {
+	for _, e := range d.schedule.entries {
+		d.mu.Lock()
+		st := d.state.Schedules[e.name]
+		d.mu.Unlock()
+		if st == nil || !st.interrupted() {
+			continue
+		}
+		d.logger.Infof("resume interrupted %s of %s", st.Operation, e.target())
+		d.start(ctx, e, st.Operation, st.Scheduled)
+	}
+}
+
+// tick starts the operations of the entries that are due at now.
+func (d *Daemon) tick(ctx context.Context, now time.Time) {
+	for _, e := range d.schedule.entries {
+		operation, at, ok := d.due(e, now)
+		if !ok {
+			continue
+		}
+		if late := now.Sub(at); late > d.opts.CatchUp {
+			d.logger.Warnf("skip %s of %s scheduled at %s, it is %s late", operation, e.target(), at.Format(time.RFC3339), late.Round(time.Second))
+			continue
+		}
+		if reason := e.skipReason(at); len(reason) > 0 {
+			d.logger.Infof("skip %s of %s scheduled at %s on a %s", operation, e.target(), at.Format(time.RFC3339), reason)
+			continue
+		}
+		d.start(ctx, e, operation, at)
+	}
+	d.save()
+}
+
+// due returns the latest run of the entry since it was last checked and
+// marks it checked up to now. Entries with a running operation are not
+// checked until it finishes.
+func (d *Daemon) due(e *entry, now time.Time) (string, time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.running[e.name] {
+		return "", time.Time{}, false
+	}
+	st := d.state.Schedules[e.name]
+	if st == nil {
+		// runs before the entry was added are not caught up
+		d.state.Schedules[e.name] = &ScheduleState{Checked: now}
+		return "", time.Time{}, false
+	}
+	operation, at := e.due(st.Checked, now)
+	st.Checked = now
+	return operation, at, !at.IsZero()
+}
+
+// next returns the time of the next run of any entry after now.
+func (d *Daemon) next(now time.Time) time.Time {
+	var next time.Time
+	for _, e := range d.schedule.entries {
+		if n := e.next(now); !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+	return next
+}
+
+// start runs the operation of the entry in the background. It is not
+// canceled with ctx, so stopping the daemon does not roll it back.
+func (d *Daemon) start(ctx context.Context, e *entry, operation string, scheduled time.Time) {
+	d.mu.Lock()
+	d.running[e.name] = true
+	st := d.state.Schedules[e.name]
+	if st == nil {
+		st = &ScheduleState{Checked: scheduled}
+		d.state.Schedules[e.name] = st
+	}
+	st.Operation = operation
+	st.Scheduled = scheduled
+	st.Started = d.now()
+	st.Finished = time.Time{}
+	st.Error = ""
+	d.mu.Unlock()
+	d.save()
+
+	d.logger.Infof("start %s of %s scheduled at %s", operation, e.target(), scheduled.Format(time.RFC3339))
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		err := d.run(context.WithoutCancel(ctx), e, operation)
+		if err != nil {
+			d.logger.Errorf("could not %s %s: %v", operation, e.target(), err)
+		} else {
+			d.logger.Infof("finish %s of %s", operation, e.target())
+		}
+		d.mu.Lock()
+		delete(d.running, e.name)
+		st.Finished = d.now()
+		if err != nil {
+			st.Error = err.Error()
+		}
+		d.mu.Unlock()
+		d.save()
+	}()
+}
+
+// run runs the operation of the entry through the resolver.
+func (d *Daemon) run(ctx context.Context, e *entry, operation string) error {
+	var res *resolver.GroupResult
+	var err error
+	switch {
+	case operation == dump.OperationFreeze && len(e.server) > 0:
+		_, err = d.resolver.FreezeServer(ctx, e.server, e.freezeOptions(d.opts.Freeze))
+	case operation == dump.OperationFreeze:
+		res, err = d.resolver.FreezeGroup(ctx, e.selector, d.opts.Parallelism, e.freezeOptions(d.opts.Freeze))
+	case operation == dump.OperationUnfreeze && len(e.server) > 0:
+		err = d.resolver.UnfreezeServer(ctx, e.server, "", d.opts.Unfreeze)
+	case operation == dump.OperationUnfreeze:
+		res, err = d.resolver.UnfreezeGroup(ctx, e.selector, "", d.opts.Parallelism, d.opts.Unfreeze)
+	default:
+		return fmt.Errorf("unknown operation %s", operation)
+	}
+	if err != nil {
+		return err
+	}
+	if res != nil {
+		return res.Err()
+	}
+	return nil
+}
+
+// save writes the state file, failures are logged and retried with the next
+// save.
+func (d *Daemon) save() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := saveState(d.opts.StateFile, d.state); err != nil {
+		d.logger.Errorf("could not save state: %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"hetzner-freezer/resolver"
+)
+
+// stubResolver records the operations of the daemon. Operations wait for
+// release if it is set.
+type stubResolver struct {
+	mu      sync.Mutex
+	calls   []string
+	release chan struct{}
+	err     error
+}
+
+func (s *stubResolver) record(call string) error {
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	release, err := s.release, s.err
+	s.mu.Unlock()
+	if release != nil {
+		<-release
+	}
+	return err
+}
+
+func (s *stubResolver) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+func (s *stubResolver) FreezeServer(_ context.Context, serverName string, _ resolver.FreezeOptions) (string, error) {
+	return "", s.record("freeze " + serverName)
+}
+
+func (s *stubResolver) UnfreezeServer(_ context.Context, serverName string, _ string, _ resolver.UnfreezeOptions) error {
+	return s.record("unfreeze " + serverName)
+}
+
+func (s *stubResolver) FreezeGroup(_ context.Context, selector string, _ int, _ resolver.FreezeOptions) (*resolver.GroupResult, error) {
+	return &resolver.GroupResult{}, s.record("freeze " + selector)
+}
+
+func (s *stubResolver) UnfreezeGroup(_ context.Context, selector string, _ string, _ int, _ resolver.UnfreezeOptions) (*resolver.GroupResult, error) {
+	return &resolver.GroupResult{}, s.record("unfreeze " + selector)
+}
+
+func newTestDaemon(t *testing.T, stub *stubResolver, stateFile string) *Daemon {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	schedule := mustParse(t, testSchedule)
+	d := NewDaemon(logger, stub, schedule, Options{StateFile: stateFile, CatchUp: time.Hour, Parallelism: 1})
+	if err := d.load(); err != nil {
+		t.Fatalf("could not load state: %v", err)
+	}
+	return d
+}
+
+func TestDaemonRunsDueOperations(t *testing.T) {
+	ctx := context.Background()
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	stub := &stubResolver{}
+	d := newTestDaemon(t, stub, stateFile)
+
+	// the first tick only records the entries
+	d.tick(ctx, utc("2026-10-16T12:00:00Z"))
+	d.tick(ctx, utc("2026-10-16T17:00:30Z"))
+	d.wg.Wait()
+	if calls := stub.Calls(); !slices.Equal(calls, []string{"freeze env=dev"}) {
+		t.Fatalf("operations %v, want freeze of env=dev", calls)
+	}
+
+	// the runs of the weekend are skipped, the late freeze of ci as well
+	d.tick(ctx, utc("2026-10-17T05:00:00Z"))
+	d.tick(ctx, utc("2026-10-18T05:00:00Z"))
+	d.wg.Wait()
+	if calls := stub.Calls(); !slices.Equal(calls, []string{"freeze env=dev"}) {
+		t.Fatalf("operations %v, want no further ones", calls)
+	}
+
+	state, err := loadState(stateFile)
+	if err != nil {
+		t.Fatalf("could not load state: %v", err)
+	}
+	st := state.Schedules["dev"]
+	if st == nil || st.Operation != "freeze" || st.Finished.IsZero() || !st.Checked.Equal(utc("2026-10-18T05:00:00Z")) {
+		t.Errorf("state of dev is %+v", st)
+	}
+}
+
+func TestDaemonSkipsRunningEntries(t *testing.T) {
+	ctx := context.Background()
+	stub := &stubResolver{release: make(chan struct{})}
+	d := newTestDaemon(t, stub, filepath.Join(t.TempDir(), "state.json"))
+
+	d.tick(ctx, utc("2026-10-16T12:00:00Z"))
+	d.tick(ctx, utc("2026-10-16T17:00:00Z"))
+	// the freeze still runs when the next run is due
+	d.tick(ctx, utc("2026-10-16T17:10:00Z"))
+	close(stub.release)
+	d.wg.Wait()
+	if calls := stub.Calls(); !slices.Equal(calls, []string{"freeze env=dev"}) {
+		t.Fatalf("operations %v, want one freeze of env=dev", calls)
+	}
+}
+
+func TestDaemonResumesInterruptedOperation(t *testing.T) {
+	ctx := context.Background()
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	stub := &stubResolver{err: errors.New("failed")}
+	err := saveState(stateFile, &State{Schedules: map[string]*ScheduleState{
+		"ci": {
+			Checked:   utc("2026-10-16T23:00:00Z"),
+			Operation: "freeze",
+			Scheduled: utc("2026-10-16T23:00:00Z"),
+			Started:   utc("2026-10-16T23:00:00Z"),
+		},
+	}})
+	if err != nil {
+		t.Fatalf("could not save state: %v", err)
+	}
+	d := newTestDaemon(t, stub, stateFile)
+
+	d.resume(ctx)
+	d.wg.Wait()
+	if calls := stub.Calls(); !slices.Equal(calls, []string{"freeze ci"}) {
+		t.Fatalf("operations %v, want the freeze of ci", calls)
+	}
+	state, err := loadState(stateFile)
+	if err != nil {
+		t.Fatalf("could not load state: %v", err)
+	}
+	if st := state.Schedules["ci"]; st.interrupted() || st.Error != "failed" {
+		t.Errorf("state of ci is %+v, want the failed freeze", st)
+	}
+}
+
+func TestDaemonLocksStateFile(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	unlock, err := lockFile(stateFile + ".lock")
+	if err != nil {
+		t.Fatalf("could not lock: %v", err)
+	}
+	defer unlock()
+	d := newTestDaemon(t, &stubResolver{}, stateFile)
+	if err := d.Run(context.Background()); err == nil {
+		t.Error("daemon ran with a locked state file")
+	}
+}
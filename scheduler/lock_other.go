@@ -0,0 +1,22 @@
+//go:build !unix
+
+package scheduler
+
+import (
+	"fmt"
+	"os"
+)
+
+// lockFile creates the file exclusively, so only one daemon uses a state
+// file, and returns the function that removes it. A daemon that crashed
+// leaves the file behind, remove it before starting another one.
+func lockFile(file string) (func(), error) {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %s, remove it if no daemon is running: %w", file, err)
+	}
+	f.Close()
+	return func() {
+		os.Remove(file)
+	}, nil
+}
@@ -0,0 +1,280 @@
+// Package scheduler freezes and unfreezes servers on the schedules of a
+// schedule file.
+package scheduler
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+	"hetzner-freezer/dump"
+	"hetzner-freezer/resolver"
+)
+
+// dateLayout is the layout of holidays in the schedule file.
+const dateLayout = "2006-01-02"
+
+// scheduleFile is the format of the schedule file.
+type scheduleFile struct {
+	// Timezone of the schedules, defaults to UTC.
+	Timezone string `yaml:"timezone"`
+	// Holidays are the dates schedules with skipHolidays do not run on.
+	Holidays  []string        `yaml:"holidays"`
+	Schedules []scheduleEntry `yaml:"schedules"`
+}
+
+// scheduleEntry freezes and unfreezes a server or the servers matching a
+// label selector.
+type scheduleEntry struct {
+	// Name identifies the entry in the state file.
+	Name     string `yaml:"name"`
+	Server   string `yaml:"server"`
+	Selector string `yaml:"selector"`
+	// Freeze and Unfreeze are cron expressions, either may be empty.
+	Freeze   string `yaml:"freeze"`
+	Unfreeze string `yaml:"unfreeze"`
+	// Timezone replaces the timezone of the file.
+	Timezone string `yaml:"timezone"`
+	// SkipWeekends skips runs on saturdays and sundays.
+	SkipWeekends bool `yaml:"skipWeekends"`
+	// SkipHolidays skips runs on the holidays of the file.
+	SkipHolidays bool `yaml:"skipHolidays"`
+	// Holidays are further dates the entry does not run on.
+	Holidays []string `yaml:"holidays"`
+	// FreezeOptions replace the freeze flags of the daemon for the entry.
+	FreezeOptions freezeOptions `yaml:"freezeOptions"`
+}
+
+// freezeOptions are the freeze flags a schedule entry can set, unset ones
+// keep the value of the flag.
+type freezeOptions struct {
+	// Volumes is keep or archive.
+	Volumes string `yaml:"volumes"`
+	// PrimaryIPs is keep, release or keep-ipv4.
+	PrimaryIPs   string   `yaml:"primaryIPs"`
+	SSHKeys      []string `yaml:"sshKeys"`
+	UserDataFile string   `yaml:"userDataFile"`
+	Force        *bool    `yaml:"force"`
+}
+
+// Schedule is a parsed schedule file.
+type Schedule struct {
+	entries []*entry
+}
+
+// entry is a parsed schedule entry.
+type entry struct {
+	name     string
+	server   string
+	selector string
+	location *time.Location
+	// operations are the schedules of the freeze and unfreeze
+	operations   []operationSchedule
+	skipWeekends bool
+	// holidays are dates in location
+	holidays map[string]bool
+	freeze   freezeOptions
+}
+
+// operationSchedule is when an operation runs.
+type operationSchedule struct {
+	operation string
+	schedule  cron.Schedule
+}
+
+// Load reads and parses the schedule file.
+func Load(file string) (*Schedule, error) {
+	bb, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedule: %w", err)
+	}
+	s, err := Parse(bb)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %s: %w", file, err)
+	}
+	return s, nil
+}
+
+// Parse parses a schedule file.
+func Parse(bb []byte) (*Schedule, error) {
+	var f scheduleFile
+	if err := yaml.Unmarshal(bb, &f); err != nil {
+		return nil, err
+	}
+	holidays, err := parseDates(f.Holidays)
+	if err != nil {
+		return nil, err
+	}
+	s := &Schedule{}
+	names := map[string]bool{}
+	for i, e := range f.Schedules {
+		if len(e.Name) == 0 {
+			return nil, fmt.Errorf("schedule %d has no name", i+1)
+		}
+		if names[e.Name] {
+			return nil, fmt.Errorf("schedule %s is defined twice", e.Name)
+		}
+		names[e.Name] = true
+		parsed, err := parseEntry(e, f.Timezone, holidays)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %s: %w", e.Name, err)
+		}
+		s.entries = append(s.entries, parsed)
+	}
+	if len(s.entries) == 0 {
+		return nil, fmt.Errorf("no schedules defined")
+	}
+	return s, nil
+}
+
+func parseEntry(e scheduleEntry, timezone string, holidays map[string]bool) (*entry, error) {
+	if (len(e.Server) == 0) == (len(e.Selector) == 0) {
+		return nil, fmt.Errorf("set either a server or a selector")
+	}
+	if len(e.Timezone) > 0 {
+		timezone = e.Timezone
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %s: %w", timezone, err)
+	}
+	if v := e.FreezeOptions.Volumes; len(v) > 0 && v != resolver.VolumeModeKeep && v != resolver.VolumeModeArchive {
+		return nil, fmt.Errorf("unknown volume mode %s, use %s or %s", v, resolver.VolumeModeKeep, resolver.VolumeModeArchive)
+	}
+	if v := e.FreezeOptions.PrimaryIPs; len(v) > 0 && v != resolver.IPPolicyKeep && v != resolver.IPPolicyRelease && v != resolver.IPPolicyKeepIPv4 {
+		return nil, fmt.Errorf("unknown primary ip policy %s, use %s, %s or %s", v, resolver.IPPolicyKeep, resolver.IPPolicyRelease, resolver.IPPolicyKeepIPv4)
+	}
+	parsed := &entry{
+		name:         e.Name,
+		server:       e.Server,
+		selector:     e.Selector,
+		location:     location,
+		skipWeekends: e.SkipWeekends,
+		holidays:     map[string]bool{},
+		freeze:       e.FreezeOptions,
+	}
+	specs := []struct {
+		operation string
+		spec      string
+	}{
+		{dump.OperationFreeze, e.Freeze},
+		{dump.OperationUnfreeze, e.Unfreeze},
+	}
+	for _, op := range specs {
+		operation, spec := op.operation, op.spec
+		if len(spec) == 0 {
+			continue
+		}
+		// the timezone of the entry applies unless the expression sets one
+		if !strings.HasPrefix(spec, "CRON_TZ=") && !strings.HasPrefix(spec, "TZ=") {
+			spec = fmt.Sprintf("CRON_TZ=%s %s", location.String(), spec)
+		}
+		schedule, err := cron.ParseStandard(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s schedule: %w", operation, err)
+		}
+		parsed.operations = append(parsed.operations, operationSchedule{operation: operation, schedule: schedule})
+	}
+	if len(parsed.operations) == 0 {
+		return nil, fmt.Errorf("set a freeze or unfreeze schedule")
+	}
+	own, err := parseDates(e.Holidays)
+	if err != nil {
+		return nil, err
+	}
+	for date := range own {
+		parsed.holidays[date] = true
+	}
+	if e.SkipHolidays {
+		for date := range holidays {
+			parsed.holidays[date] = true
+		}
+	}
+	return parsed, nil
+}
+
+func parseDates(dates []string) (map[string]bool, error) {
+	parsed := map[string]bool{}
+	for _, date := range dates {
+		if _, err := time.Parse(dateLayout, date); err != nil {
+			return nil, fmt.Errorf("invalid holiday %s, use YYYY-MM-DD", date)
+		}
+		parsed[date] = true
+	}
+	return parsed, nil
+}
+
+// target describes what the entry freezes and unfreezes.
+func (e *entry) target() string {
+	if len(e.server) > 0 {
+		return fmt.Sprintf("server %s", e.server)
+	}
+	return fmt.Sprintf("servers matching %s", e.selector)
+}
+
+// freezeOptions returns the options to freeze the servers of the entry with,
+// the options of the entry replace the flags.
+func (e *entry) freezeOptions(flags resolver.FreezeOptions) resolver.FreezeOptions {
+	opts := flags
+	if len(e.freeze.Volumes) > 0 {
+		opts.VolumeMode = e.freeze.Volumes
+	}
+	if len(e.freeze.PrimaryIPs) > 0 {
+		opts.IPPolicy = e.freeze.PrimaryIPs
+	}
+	if e.freeze.SSHKeys != nil {
+		opts.SSHKeys = e.freeze.SSHKeys
+	}
+	if len(e.freeze.UserDataFile) > 0 {
+		opts.UserDataFile = e.freeze.UserDataFile
+	}
+	if e.freeze.Force != nil {
+		opts.Force = *e.freeze.Force
+	}
+	return opts
+}
+
+// due returns the operation of the latest run after from and not after to,
+// and its time. Earlier runs in the interval are superseded by it. The time
+// is zero if no run is due.
+func (e *entry) due(from, to time.Time) (string, time.Time) {
+	var operation string
+	var latest time.Time
+	for _, op := range e.operations {
+		var last time.Time
+		for t := op.schedule.Next(from); !t.IsZero() && !t.After(to); t = op.schedule.Next(t) {
+			last = t
+		}
+		if last.After(latest) {
+			operation, latest = op.operation, last
+		}
+	}
+	return operation, latest
+}
+
+// next returns the time of the next run after t.
+func (e *entry) next(t time.Time) time.Time {
+	var next time.Time
+	for _, op := range e.operations {
+		if n := op.schedule.Next(t); !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+	return next
+}
+
+// skipReason returns why a run at t is skipped, or an empty string if it is
+// not.
+func (e *entry) skipReason(t time.Time) string {
+	local := t.In(e.location)
+	if e.skipWeekends && (local.Weekday() == time.Saturday || local.Weekday() == time.Sunday) {
+		return "weekend"
+	}
+	if e.holidays[local.Format(dateLayout)] {
+		return "holiday"
+	}
+	return ""
+}
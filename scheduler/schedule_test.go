@@ -0,0 +1,148 @@
+package scheduler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"hetzner-freezer/dump"
+	"hetzner-freezer/resolver"
+)
+
+const testSchedule = `
+timezone: Europe/Berlin
+holidays:
+- 2026-10-19
+schedules:
+- name: dev
+  selector: env=dev
+  freeze: "0 19 * * *"
+  unfreeze: "0 7 * * *"
+  skipWeekends: true
+  skipHolidays: true
+- name: ci
+  server: ci
+  timezone: America/New_York
+  freeze: "0 19 * * *"
+  holidays: [2026-10-20]
+`
+
+func mustParse(t *testing.T, s string) *Schedule {
+	t.Helper()
+	schedule, err := Parse([]byte(s))
+	if err != nil {
+		t.Fatalf("could not parse schedule: %v", err)
+	}
+	return schedule
+}
+
+func utc(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestEntryDue(t *testing.T) {
+	schedule := mustParse(t, testSchedule)
+	dev, ci := schedule.entries[0], schedule.entries[1]
+	tests := []struct {
+		name      string
+		entry     *entry
+		from, to  string
+		operation string
+		at        string
+	}{
+		{name: "none due", entry: dev, from: "2026-10-16T12:00:00Z", to: "2026-10-16T16:59:00Z"},
+		{name: "in timezone", entry: dev, from: "2026-10-16T12:00:00Z", to: "2026-10-16T17:00:00Z", operation: dump.OperationFreeze, at: "2026-10-16T17:00:00Z"},
+		{name: "other timezone", entry: ci, from: "2026-10-16T12:00:00Z", to: "2026-10-17T00:00:00Z", operation: dump.OperationFreeze, at: "2026-10-16T23:00:00Z"},
+		{name: "latest supersedes", entry: dev, from: "2026-10-16T12:00:00Z", to: "2026-10-17T06:00:00Z", operation: dump.OperationUnfreeze, at: "2026-10-17T05:00:00Z"},
+		{name: "after dst change", entry: dev, from: "2026-10-26T12:00:00Z", to: "2026-10-26T18:00:00Z", operation: dump.OperationFreeze, at: "2026-10-26T18:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			operation, at := tt.entry.due(utc(tt.from), utc(tt.to))
+			if operation != tt.operation {
+				t.Errorf("due operation %q, want %q", operation, tt.operation)
+			}
+			if len(tt.at) > 0 && !at.Equal(utc(tt.at)) {
+				t.Errorf("due at %s, want %s", at, tt.at)
+			}
+			if len(tt.at) == 0 && !at.IsZero() {
+				t.Errorf("due at %s, want none", at)
+			}
+		})
+	}
+}
+
+func TestEntrySkipReason(t *testing.T) {
+	schedule := mustParse(t, testSchedule)
+	dev, ci := schedule.entries[0], schedule.entries[1]
+	tests := []struct {
+		entry *entry
+		at    string
+		want  string
+	}{
+		{entry: dev, at: "2026-10-16T17:00:00Z"},
+		// saturday in Berlin
+		{entry: dev, at: "2026-10-16T22:30:00Z", want: "weekend"},
+		{entry: dev, at: "2026-10-19T05:00:00Z", want: "holiday"},
+		{entry: ci, at: "2026-10-17T23:00:00Z"},
+		{entry: ci, at: "2026-10-19T23:00:00Z"},
+		// still the 20th in New York
+		{entry: ci, at: "2026-10-21T02:00:00Z", want: "holiday"},
+	}
+	for _, tt := range tests {
+		if got := tt.entry.skipReason(utc(tt.at)); got != tt.want {
+			t.Errorf("%s at %s skipped for %q, want %q", tt.entry.name, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestParseRejectsInvalidSchedules(t *testing.T) {
+	tests := map[string]string{
+		"no name":             "schedules:\n- server: web\n  freeze: \"0 19 * * *\"\n",
+		"no target":           "schedules:\n- name: web\n  freeze: \"0 19 * * *\"\n",
+		"server and selector": "schedules:\n- name: web\n  server: web\n  selector: env=dev\n  freeze: \"0 19 * * *\"\n",
+		"no operation":        "schedules:\n- name: web\n  server: web\n",
+		"invalid cron":        "schedules:\n- name: web\n  server: web\n  freeze: \"0 25 * * *\"\n",
+		"unknown timezone":    "timezone: Mars/Olympus\nschedules:\n- name: web\n  server: web\n  freeze: \"0 19 * * *\"\n",
+		"invalid holiday":     "holidays: [24.12.2026]\nschedules:\n- name: web\n  server: web\n  freeze: \"0 19 * * *\"\n",
+		"duplicate name":      "schedules:\n- name: web\n  server: web\n  freeze: \"0 19 * * *\"\n- name: web\n  server: db\n  freeze: \"0 19 * * *\"\n",
+		"no schedules":        "timezone: UTC\n",
+		"unknown volume mode": "schedules:\n- name: web\n  server: web\n  freeze: \"0 19 * * *\"\n  freezeOptions:\n    volumes: copy\n",
+		"unknown ip policy":   "schedules:\n- name: web\n  server: web\n  freeze: \"0 19 * * *\"\n  freezeOptions:\n    primaryIPs: drop\n",
+	}
+	for name, s := range tests {
+		if _, err := Parse([]byte(s)); err == nil {
+			t.Errorf("%s: schedule accepted", name)
+		}
+	}
+}
+
+func TestEntryFreezeOptions(t *testing.T) {
+	schedule := mustParse(t, `
+schedules:
+- name: web
+  server: web
+  freeze: "0 19 * * *"
+- name: ci
+  server: ci
+  freeze: "0 19 * * *"
+  freezeOptions:
+    volumes: archive
+    primaryIPs: release
+    sshKeys: [ci]
+    userDataFile: ci.yaml
+    force: false
+`)
+	flags := resolver.FreezeOptions{VolumeMode: resolver.VolumeModeKeep, IPPolicy: resolver.IPPolicyKeep, SSHKeys: []string{"admin"}, UserDataFile: "web.yaml", Force: true}
+	if got := schedule.entries[0].freezeOptions(flags); !reflect.DeepEqual(got, flags) {
+		t.Errorf("entry without options freezes with %+v, want the flags", got)
+	}
+	want := resolver.FreezeOptions{VolumeMode: resolver.VolumeModeArchive, IPPolicy: resolver.IPPolicyRelease, SSHKeys: []string{"ci"}, UserDataFile: "ci.yaml"}
+	if got := schedule.entries[1].freezeOptions(flags); !reflect.DeepEqual(got, want) {
+		t.Errorf("entry freezes with %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,81 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// State is what the daemon persists between restarts.
+type State struct {
+	Schedules map[string]*ScheduleState `json:"schedules"`
+}
+
+// ScheduleState records the runs of a schedule entry.
+type ScheduleState struct {
+	// Checked is the time up to which runs of the entry were handled.
+	Checked time.Time `json:"checked"`
+	// Operation is the last operation started, Scheduled its run.
+	Operation string    `json:"operation,omitempty"`
+	Scheduled time.Time `json:"scheduled,omitempty"`
+	Started   time.Time `json:"started,omitempty"`
+	// Finished is zero while the operation runs or if the daemon stopped
+	// before it finished, in which case it is resumed on start.
+	Finished time.Time `json:"finished,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// interrupted reports whether the daemon stopped during the operation.
+func (s *ScheduleState) interrupted() bool {
+	return !s.Started.IsZero() && s.Finished.IsZero()
+}
+
+// loadState reads the state file, a missing file is an empty state.
+func loadState(file string) (*State, error) {
+	state := &State{Schedules: map[string]*ScheduleState{}}
+	bb, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+	if err := json.Unmarshal(bb, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state %s: %w", file, err)
+	}
+	if state.Schedules == nil {
+		state.Schedules = map[string]*ScheduleState{}
+	}
+	return state, nil
+}
+
+// saveState replaces the state file, a crash leaves the old or the new state.
+func saveState(file string, state *State) error {
+	bb, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to process state: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bb); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	return nil
+}